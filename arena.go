@@ -0,0 +1,74 @@
+package bencode
+
+// defaultArenaChunk is the size of the chunks of a ByteArena created with a non-positive size.
+const defaultArenaChunk = 64 << 10
+
+// ByteArena is a caller-owned region that decoded byte strings, and only
+// they, are allocated from, so that services decoding and discarding many
+// small messages create a few large, reusable chunks instead of one small
+// object per string.
+//
+// Strings, []byte slices and byte strings in interface{} values decoded with
+// a ByteArena alias its memory: after Reset they must no longer be used, as
+// their bytes are overwritten by the next decode. Everything else is
+// allocated on the heap as usual: byte strings larger than a quarter of a
+// chunk, and the backing arrays of slices, the maps, and the values of lists
+// and dicts decoded into interface{} values. Those can hold pointers, which
+// the garbage collector must see, so they cannot live in untyped chunks.
+// A ByteArena must not be used by several decodes at the same time.
+type ByteArena struct {
+	chunkSize int
+	chunks    [][]byte
+	next      int    // index in chunks of the chunk after cur
+	cur       []byte // the chunk being filled, sliced to its used part
+}
+
+// NewByteArena returns an arena that allocates chunks of the given size.
+func NewByteArena(chunkSize int) *ByteArena {
+	if chunkSize <= 0 {
+		chunkSize = defaultArenaChunk
+	}
+	return &ByteArena{chunkSize: chunkSize}
+}
+
+// Reset releases everything allocated from a at once, keeping its chunks for reuse.
+func (a *ByteArena) Reset() {
+	a.next, a.cur = 0, nil
+}
+
+// Size returns the memory held by a.
+func (a *ByteArena) Size() int {
+	return len(a.chunks) * a.chunkSize
+}
+
+// alloc returns a slice of n bytes whose capacity is n.
+func (a *ByteArena) alloc(n int) []byte {
+	if n > a.chunkSize/4 {
+		return make([]byte, n)
+	}
+	if len(a.cur)+n > cap(a.cur) {
+		if a.next == len(a.chunks) {
+			a.chunks = append(a.chunks, make([]byte, a.chunkSize))
+		}
+		a.cur = a.chunks[a.next][:0]
+		a.next++
+	}
+	start := len(a.cur)
+	a.cur = a.cur[:start+n]
+	return a.cur[start : start+n : start+n]
+}
+
+// UnmarshalByteArena is like Unmarshal, but allocates the decoded byte strings from a.
+func UnmarshalByteArena(data []byte, v interface{}, a *ByteArena) error {
+	d := newDecodeState(data)
+	d.arena = a
+	err := withContext(d.unmarshal(v), data)
+	d.release()
+	return err
+}
+
+// SetByteArena makes the decoder allocate decoded byte strings from a, or
+// from the heap if a is nil.
+func (dec *Decoder) SetByteArena(a *ByteArena) {
+	dec.d.arena = a
+}
@@ -0,0 +1,57 @@
+//go:build !bencode_lite
+
+package bencode
+
+import (
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func TestByteArena(t *testing.T) {
+	a := NewByteArena(1024)
+	var v struct {
+		A    string        `bencode:"a"`
+		B    []byte        `bencode:"b"`
+		Big  string        `bencode:"big"`
+		List []interface{} `bencode:"list"`
+	}
+	big := strings.Repeat("x", 300)
+	data := []byte("d1:a3:abc1:b3:def3:big300:" + big + "4:listl3:ghiee")
+	if err := UnmarshalByteArena(data, &v, a); err != nil {
+		t.Fatal(err)
+	}
+	if v.A != "abc" || string(v.B) != "def" || v.Big != big || v.List[0] != "ghi" {
+		t.Fatalf("got %+v", v)
+	}
+	if a.Size() != 1024 {
+		t.Fatalf("Size = %d, want one chunk", a.Size())
+	}
+	inArena := func(p *byte) bool {
+		c := a.chunks[0]
+		start := uintptr(unsafe.Pointer(&c[0]))
+		return uintptr(unsafe.Pointer(p)) >= start && uintptr(unsafe.Pointer(p)) < start+uintptr(len(c))
+	}
+	if !inArena(unsafe.StringData(v.A)) || !inArena(&v.B[0]) || !inArena(unsafe.StringData(v.List[0].(string))) {
+		t.Error("small byte strings are not allocated from the arena")
+	}
+	if inArena(unsafe.StringData(v.Big)) {
+		t.Error("a byte string larger than a quarter of a chunk is allocated from the arena")
+	}
+	if cap(v.B) != len(v.B) {
+		t.Errorf("cap(B) = %d, want %d so that appending cannot overwrite the arena", cap(v.B), len(v.B))
+	}
+
+	// After Reset, the chunk is reused and the old strings are overwritten.
+	a.Reset()
+	old := v.A
+	var w struct {
+		A string `bencode:"a"`
+	}
+	if err := UnmarshalByteArena([]byte("d1:a3:xyze"), &w, a); err != nil {
+		t.Fatal(err)
+	}
+	if w.A != "xyz" || old != "xyz" || a.Size() != 1024 {
+		t.Errorf("after Reset: got %q and %q, size %d", w.A, old, a.Size())
+	}
+}
@@ -0,0 +1,92 @@
+package bencode
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// typeCacheLimit bounds the number of types each cache holds; 0 means no bound.
+var typeCacheLimit int64
+
+// SetTypeCacheLimit bounds the number of types for which encoders and struct
+// field tables are kept, so that programs marshaling values of many
+// dynamically created types, such as plugin hosts, do not accumulate them
+// forever. Once a cache is full, each type added evicts an arbitrary other
+// one, which is rebuilt the next time it is needed. n <= 0 removes the bound,
+// which is the default.
+func SetTypeCacheLimit(n int) {
+	if n < 0 {
+		n = 0
+	}
+	atomic.StoreInt64(&typeCacheLimit, int64(n))
+	for _, c := range typeCaches {
+		c.evict()
+	}
+}
+
+// ResetTypeCaches drops every cached encoder and struct field table, such as
+// after unloading the code that defined the types they describe.
+func ResetTypeCaches() {
+	for _, c := range typeCaches {
+		c.clear()
+	}
+}
+
+var typeCaches = []*typeCache{&encoderCache, &encodeFieldCache, &decodeFieldCache}
+
+// typeCache is a concurrent map keyed by reflect.Type, bounded by typeCacheLimit.
+// Its size is counted approximately under concurrent use.
+type typeCache struct {
+	m sync.Map
+	n int64
+}
+
+func (c *typeCache) Load(t reflect.Type) (interface{}, bool) {
+	return c.m.Load(t)
+}
+
+func (c *typeCache) LoadOrStore(t reflect.Type, v interface{}) (interface{}, bool) {
+	actual, loaded := c.m.LoadOrStore(t, v)
+	if !loaded {
+		c.added()
+	}
+	return actual, loaded
+}
+
+func (c *typeCache) Store(t reflect.Type, v interface{}) {
+	if _, loaded := c.m.Swap(t, v); !loaded {
+		c.added()
+	}
+}
+
+func (c *typeCache) Delete(t reflect.Type) {
+	if _, loaded := c.m.LoadAndDelete(t); loaded {
+		atomic.AddInt64(&c.n, -1)
+	}
+}
+
+// clear deletes every entry of c.
+func (c *typeCache) clear() {
+	c.m.Range(func(k, _ interface{}) bool {
+		c.Delete(k.(reflect.Type))
+		return true
+	})
+}
+
+func (c *typeCache) added() {
+	atomic.AddInt64(&c.n, 1)
+	c.evict()
+}
+
+// evict deletes entries while c holds more than the limit.
+func (c *typeCache) evict() {
+	limit := atomic.LoadInt64(&typeCacheLimit)
+	if limit == 0 || atomic.LoadInt64(&c.n) <= limit {
+		return
+	}
+	c.m.Range(func(k, _ interface{}) bool {
+		c.Delete(k.(reflect.Type))
+		return atomic.LoadInt64(&c.n) > limit
+	})
+}
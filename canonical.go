@@ -0,0 +1,101 @@
+package bencode
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+)
+
+// DuplicateKeyPolicy selects what Canonicalize does with repeated dict keys.
+type DuplicateKeyPolicy uint8
+
+const (
+	// DuplicateKeepLast keeps the last occurrence of a repeated key, matching Unmarshal.
+	DuplicateKeepLast DuplicateKeyPolicy = iota
+	// DuplicateKeepFirst keeps the first occurrence of a repeated key.
+	DuplicateKeepFirst
+	// DuplicateReject fails on the first repeated key with a
+	// *DuplicateKeyError.
+	DuplicateReject
+)
+
+// Canonicalize re-emits data in canonical form: dict keys sorted by their raw
+// bytes, repeated keys resolved according to policy, and integers and string
+// lengths written without leading zeros or negative zero. It reports whether
+// the result differs from data. A policy other than those defined is an error.
+func Canonicalize(data []byte, policy DuplicateKeyPolicy) ([]byte, bool, error) {
+	if policy > DuplicateReject {
+		return nil, false, newError("unknown duplicate key policy %d", policy)
+	}
+	v, err := Parse(data)
+	if err != nil {
+		return nil, false, err
+	}
+	out, err := appendCanonical(make([]byte, 0, len(data)), v, nil, policy)
+	if err != nil {
+		return nil, false, err
+	}
+	return out, !bytes.Equal(out, data), nil
+}
+
+// appendCanonical appends the canonical encoding of v, found at path, to b.
+func appendCanonical(b []byte, v Value, path Path, policy DuplicateKeyPolicy) ([]byte, error) {
+	var err error
+	switch v.Kind() {
+	case IntegerKind:
+		b = append(b, 'i')
+		b = v.BigInt().Append(b, 10)
+		b = append(b, 'e')
+	case StringKind:
+		b = appendString(b, v.Bytes())
+	case ListKind:
+		b = append(b, 'l')
+		for i, e := range v.List() {
+			if b, err = appendCanonical(b, e, append(path, PathElem{Index: i, IsIndex: true}), policy); err != nil {
+				return nil, err
+			}
+		}
+		b = append(b, 'e')
+	case DictKind:
+		keys := v.Keys()
+		index := make(map[string]int, len(keys))
+		for i, k := range keys {
+			if first, dup := index[k]; dup {
+				if policy == DuplicateReject {
+					return nil, &DuplicateKeyError{
+						Key:         k,
+						Path:        append(append(Path(nil), path...), PathElem{Key: k}),
+						FirstOffset: int64(v.keySpan[first][0]),
+						Offset:      int64(v.keySpan[i][0]),
+					}
+				}
+				if policy == DuplicateKeepFirst {
+					continue
+				}
+			}
+			index[k] = i
+		}
+		sorted := make([]string, 0, len(index))
+		for k := range index {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+
+		b = append(b, 'd')
+		for _, k := range sorted {
+			b = appendString(b, stringAsBytes(k))
+			if b, err = appendCanonical(b, v.list[index[k]], append(path, PathElem{Key: k}), policy); err != nil {
+				return nil, err
+			}
+		}
+		b = append(b, 'e')
+	}
+	return b, nil
+}
+
+// appendString appends the encoding of the byte string s to b.
+func appendString(b, s []byte) []byte {
+	b = strconv.AppendInt(b, int64(len(s)), 10)
+	b = append(b, ':')
+	return append(b, s...)
+}
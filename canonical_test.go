@@ -0,0 +1,31 @@
+//go:build !bencode_lite
+
+package bencode
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCanonicalizePolicies(t *testing.T) {
+	in := []byte("d1:bi1e1:ai2e1:bi3ee")
+	tests := []struct {
+		policy DuplicateKeyPolicy
+		want   string
+	}{
+		{DuplicateKeepLast, "d1:ai2e1:bi3ee"},
+		{DuplicateKeepFirst, "d1:ai2e1:bi1ee"},
+	}
+	for _, tt := range tests {
+		out, changed, err := Canonicalize(in, tt.policy)
+		if err != nil || string(out) != tt.want || !changed {
+			t.Errorf("Canonicalize(%d) = %q, %v, %v; want %q", tt.policy, out, changed, err, tt.want)
+		}
+	}
+	if _, _, err := Canonicalize(in, DuplicateReject); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("Canonicalize(DuplicateReject) = %v, want a *DuplicateKeyError", err)
+	}
+	if _, _, err := Canonicalize([]byte("de"), DuplicateKeyPolicy(9)); err == nil {
+		t.Error("Canonicalize accepted an unknown policy")
+	}
+}
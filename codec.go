@@ -0,0 +1,22 @@
+//go:build !bencode_lite
+
+package bencode
+
+import "reflect"
+
+// marshal and unmarshal are the entry points of Marshal, Unmarshal, Encoder
+// and Decoder. With the bencode_lite build tag they are replaced by versions
+// that do without the reflection-driven encoders and decoders.
+
+func (e *encodeState) marshal(v interface{}) (err error) {
+	defer recoverEncoding(&err)
+	return e.reflectValue(reflect.ValueOf(v))
+}
+
+func (d *decodeState) unmarshal(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return newError("invalid unmarshal arg error")
+	}
+	return d.unmarshalValue(rv.Elem())
+}
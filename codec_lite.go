@@ -0,0 +1,306 @@
+//go:build bencode_lite
+
+package bencode
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// With the bencode_lite build tag, Marshal, Unmarshal, Encoder and Decoder do
+// not call the reflection-driven encoders and decoders, which need
+// reflect.MakeSlice, MakeMap and friends that TinyGo and small WASM targets
+// lack or pay for in binary size. They handle instead:
+//
+//   - types registered with RegisterTypeEncoder and RegisterTypeDecoder,
+//   - Marshaler and Unmarshaler implementations, such as generated codecs,
+//   - strings, []byte, integers and bool,
+//   - []interface{}, map[string]interface{}, []string, []int64, [][]byte and
+//     map[string]RawMessage, and pointers to all of the above when encoding.
+//
+// Other types, structs included, fail with an error. Integers too large for
+// their destination are an *UnmarshalTypeError.
+//
+// The tag does not remove the reflection-driven code from the package: it is
+// still compiled, and MarshalValue, UnmarshalValue and Precompile keep using
+// it. Only a program that calls none of them leaves it out at link time.
+// Decoded byte strings are always copies, whatever the zero-copy and arena
+// settings.
+//
+// The subpackages whose messages are structs, metainfo, krpc, metadata, pex,
+// resume and tracker, need the reflection-driven Marshal and Unmarshal and are
+// not built with the tag; compact is.
+
+func (e *encodeState) marshal(v interface{}) (err error) {
+	defer recoverEncoding(&err)
+	return e.liteValue(v)
+}
+
+// liteValue encodes v, which is nested e.ptrLevel pointers, lists and dicts
+// deep. Without reflection to tell cycles apart, nesting is bounded instead.
+func (e *encodeState) liteValue(v interface{}) error {
+	if e.ptrLevel > maxNestingDepth {
+		return &UnsupportedValueError{Value: reflect.ValueOf(v), Str: "exceeded max depth, or encountered a cycle"}
+	}
+	if v == nil {
+		return &UnsupportedValueError{Str: "nil"}
+	}
+	if enc, ok := registeredEncoder(reflect.TypeOf(v)); ok {
+		return enc(e, reflect.ValueOf(v))
+	}
+
+	switch x := v.(type) {
+	case Marshaler:
+		b, err := callMarshaler(x)
+		if err != nil {
+			return err
+		}
+		_, err = e.Write(b)
+		return err
+	case string:
+		return e.writeString(x)
+	case []byte:
+		if err := e.writeStringHeader(len(x)); err != nil {
+			return err
+		}
+		_, err := e.Write(x)
+		return err
+	case int:
+		return e.writeInt(int64(x))
+	case int8:
+		return e.writeInt(int64(x))
+	case int16:
+		return e.writeInt(int64(x))
+	case int32:
+		return e.writeInt(int64(x))
+	case int64:
+		return e.writeInt(x)
+	case uint:
+		return e.writeUint(uint64(x))
+	case uint8:
+		return e.writeUint(uint64(x))
+	case uint16:
+		return e.writeUint(uint64(x))
+	case uint32:
+		return e.writeUint(uint64(x))
+	case uint64:
+		return e.writeUint(x)
+	case bool:
+		if x {
+			return e.writeInt(1)
+		}
+		return e.writeInt(0)
+	case []interface{}:
+		return liteList(e, x)
+	case []string:
+		return liteList(e, x)
+	case []int64:
+		return liteList(e, x)
+	case [][]byte:
+		return liteList(e, x)
+	case map[string]interface{}:
+		return liteDict(e, x)
+	case map[string]RawMessage:
+		return liteDict(e, x)
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		e.ptrLevel++
+		defer func() { e.ptrLevel-- }()
+		if rv.IsNil() {
+			return e.liteValue(reflect.Zero(rv.Type().Elem()).Interface())
+		}
+		return e.liteValue(rv.Elem().Interface())
+	}
+	// Without reflection, types other than the above need a Marshaler or a
+	// registered encoder.
+	return &UnsupportedTypeError{Type: rv.Type()}
+}
+
+func liteList[T any](e *encodeState, l []T) error {
+	if _, err := e.WriteString("l"); err != nil {
+		return err
+	}
+	e.ptrLevel++
+	defer func() { e.ptrLevel-- }()
+	for i, x := range l {
+		if err := e.liteValue(x); err != nil {
+			return atElem(err, PathElem{Index: i, IsIndex: true})
+		}
+	}
+	_, err := e.WriteString("e")
+	return err
+}
+
+func liteDict[T any](e *encodeState, m map[string]T) error {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if _, err := e.WriteString("d"); err != nil {
+		return err
+	}
+	e.ptrLevel++
+	defer func() { e.ptrLevel-- }()
+	for _, k := range keys {
+		if err := e.writeString(k); err != nil {
+			return err
+		}
+		if err := e.liteValue(m[k]); err != nil {
+			return atElem(err, PathElem{Key: k})
+		}
+	}
+	_, err := e.WriteString("e")
+	return err
+}
+
+func (d *decodeState) unmarshal(v interface{}) error {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Ptr || reflect.ValueOf(v).IsNil() {
+		return newError("invalid unmarshal arg error")
+	}
+	start := d.Offset
+	d.Reset()
+	if ok, err := d.readValue(); err != nil {
+		return err
+	} else if !ok {
+		return d.syntaxError(d.Offset, errors.New("unexpected 'e'"))
+	}
+	raw := d.Bytes()
+
+	if dec, ok := typeDecoders.Load(t.Elem()); ok {
+		data := append([]byte(nil), raw...)
+		if u, ok := dec.(*union); ok {
+			return u.decode(d, data, start, reflect.ValueOf(v).Elem())
+		}
+		return dec.(func([]byte, reflect.Value) error)(data, reflect.ValueOf(v).Elem())
+	}
+	switch p := v.(type) {
+	case Unmarshaler:
+		if err := p.UnmarshalBencode(raw); err != nil {
+			return &MarshalerError{Type: t, Err: err, sourceFunc: "UnmarshalBencode"}
+		}
+		return nil
+	case *map[string]RawMessage:
+		if raw[0] != 'd' {
+			return d.typeError(kindOf(raw), t.Elem())
+		}
+		return unmarshalRawDict(raw, p, false)
+	}
+
+	val, err := Parse(raw)
+	if err != nil {
+		return err
+	}
+	return liteAssign(v, val)
+}
+
+// liteAssign stores val into the value v points to.
+func liteAssign(v interface{}, val Value) error {
+	ok := true
+	switch p := v.(type) {
+	case *interface{}:
+		*p = val.Interface()
+	case *string:
+		if ok = val.Kind() == StringKind; ok {
+			*p = val.String()
+		}
+	case *[]byte:
+		if ok = val.Kind() == StringKind; ok {
+			*p = val.Bytes()
+		}
+	case *int:
+		return liteInt(p, val)
+	case *int8:
+		return liteInt(p, val)
+	case *int16:
+		return liteInt(p, val)
+	case *int32:
+		return liteInt(p, val)
+	case *int64:
+		return liteInt(p, val)
+	case *uint:
+		return liteInt(p, val)
+	case *uint8:
+		return liteInt(p, val)
+	case *uint16:
+		return liteInt(p, val)
+	case *uint32:
+		return liteInt(p, val)
+	case *uint64:
+		return liteInt(p, val)
+	case *bool:
+		if ok = val.Kind() == IntegerKind; ok {
+			*p = val.Int() != 0
+		}
+	case *[]interface{}:
+		if ok = val.Kind() == ListKind; ok {
+			*p = val.Interface().([]interface{})
+		}
+	case *map[string]interface{}:
+		if ok = val.Kind() == DictKind; ok {
+			*p = val.Interface().(map[string]interface{})
+		}
+	case *[]string:
+		return liteSlice(p, val)
+	case *[]int64:
+		return liteSlice(p, val)
+	case *[][]byte:
+		return liteSlice(p, val)
+	default:
+		// Without reflection, types other than the above need an
+		// Unmarshaler or a registered decoder.
+		return &UnsupportedTypeError{Type: reflect.TypeOf(v).Elem()}
+	}
+	if !ok {
+		return liteTypeError(val, reflect.TypeOf(v).Elem())
+	}
+	return nil
+}
+
+// liteTypeError reports that val cannot be stored in a value of type t. The
+// values are parsed apart from the input, so their offset is not known.
+func liteTypeError(val Value, t reflect.Type) error {
+	return &UnmarshalTypeError{Value: val.Kind().String(), Type: t, Offset: -1}
+}
+
+// liteInt stores the integer val in *p, parsing it as unsigned for unsigned
+// types so that their whole range is accepted.
+func liteInt[T int | int8 | int16 | int32 | int64 | uint | uint8 | uint16 | uint32 | uint64](p *T, val Value) error {
+	t := reflect.TypeOf(p).Elem()
+	if val.Kind() != IntegerKind {
+		return liteTypeError(val, t)
+	}
+	if k := t.Kind(); k >= reflect.Uint && k <= reflect.Uint64 {
+		n, err := strconv.ParseUint(string(val.str), 10, t.Bits())
+		if err != nil {
+			return liteTypeError(val, t)
+		}
+		*p = T(n)
+		return nil
+	}
+	n, err := strconv.ParseInt(string(val.str), 10, t.Bits())
+	if err != nil {
+		return liteTypeError(val, t)
+	}
+	*p = T(n)
+	return nil
+}
+
+func liteSlice[T any](p *[]T, val Value) error {
+	if val.Kind() != ListKind {
+		return liteTypeError(val, reflect.TypeOf(p).Elem())
+	}
+	s := make([]T, val.Len())
+	for i, e := range val.List() {
+		if err := liteAssign(&s[i], e); err != nil {
+			return err
+		}
+	}
+	*p = s
+	return nil
+}
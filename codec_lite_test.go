@@ -0,0 +1,53 @@
+//go:build bencode_lite
+
+package bencode
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLiteIntegers(t *testing.T) {
+	var u64 uint64
+	if err := Unmarshal([]byte("i18446744073709551615e"), &u64); err != nil || u64 != math.MaxUint64 {
+		t.Fatalf("uint64: got %d, %v", u64, err)
+	}
+	var i64 int64
+	if err := Unmarshal([]byte("i-9223372036854775808e"), &i64); err != nil || i64 != math.MinInt64 {
+		t.Fatalf("int64: got %d, %v", i64, err)
+	}
+
+	tests := []struct {
+		in string
+		v  interface{}
+	}{
+		{"i18446744073709551616e", new(uint64)},
+		{"i9223372036854775808e", new(int64)},
+		{"i-1e", new(uint)},
+		{"i256e", new(uint8)},
+		{"i128e", new(int8)},
+		{"i-129e", new(int8)},
+		{"4:spam", new(int)},
+	}
+	for _, tt := range tests {
+		err := Unmarshal([]byte(tt.in), tt.v)
+		if _, ok := err.(*UnmarshalTypeError); !ok {
+			t.Errorf("Unmarshal(%q, %T) = %v, want an *UnmarshalTypeError", tt.in, tt.v, err)
+		}
+	}
+}
+
+func TestLiteRoundTrip(t *testing.T) {
+	in := map[string]interface{}{"a": []interface{}{int64(1), "x"}, "b": uint64(math.MaxUint64)}
+	b, err := Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "d1:ali1e1:xe1:bi18446744073709551615ee"; string(b) != want {
+		t.Fatalf("Marshal = %q, want %q", b, want)
+	}
+	var out struct{}
+	if err = Unmarshal(b, &out); err == nil {
+		t.Fatal("struct decoded without reflection")
+	}
+}
@@ -0,0 +1,128 @@
+// Package compact implements the compact peer formats used by trackers, the
+// DHT and peer exchange: 6 bytes per IPv4 peer (BEP 23) and 18 bytes per IPv6
+// peer (BEP 7), each an address followed by a big-endian port.
+package compact
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+
+	"go.x2ox.com/bencode"
+)
+
+// PeerLen is the size of one compact IPv4 peer.
+const PeerLen = 6
+
+// ParsePeers decodes a compact IPv4 peer string.
+func ParsePeers(b []byte) ([]netip.AddrPort, error) {
+	if len(b)%PeerLen != 0 {
+		return nil, fmt.Errorf("compact: peers length %d is not a multiple of %d", len(b), PeerLen)
+	}
+	peers := make([]netip.AddrPort, 0, len(b)/PeerLen)
+	for ; len(b) > 0; b = b[PeerLen:] {
+		addr := netip.AddrFrom4([4]byte{b[0], b[1], b[2], b[3]})
+		peers = append(peers, netip.AddrPortFrom(addr, binary.BigEndian.Uint16(b[4:])))
+	}
+	return peers, nil
+}
+
+// AppendPeers appends the compact IPv4 encoding of peers to b.
+// IPv4-mapped IPv6 addresses are accepted; other IPv6 addresses are an error.
+func AppendPeers(b []byte, peers []netip.AddrPort) ([]byte, error) {
+	for _, p := range peers {
+		addr := p.Addr().Unmap()
+		if !addr.Is4() {
+			return nil, fmt.Errorf("compact: %s is not an IPv4 peer", p)
+		}
+		a4 := addr.As4()
+		b = append(b, a4[:]...)
+		b = binary.BigEndian.AppendUint16(b, p.Port())
+	}
+	return b, nil
+}
+
+// Peers is a list of IPv4 peers that is encoded as a compact peer string,
+// for use as a field type in bencoded messages.
+type Peers []netip.AddrPort
+
+// MarshalBencode encodes ps as a compact peer string.
+func (ps Peers) MarshalBencode() ([]byte, error) {
+	b, err := AppendPeers(make([]byte, 0, len(ps)*PeerLen), ps)
+	if err != nil {
+		return nil, err
+	}
+	return bencode.Marshal(b)
+}
+
+// UnmarshalBencode decodes a compact peer string.
+func (ps *Peers) UnmarshalBencode(data []byte) error {
+	var b []byte
+	if err := bencode.Unmarshal(data, &b); err != nil {
+		return err
+	}
+	peers, err := ParsePeers(b)
+	if err != nil {
+		return err
+	}
+	*ps = peers
+	return nil
+}
+
+// Peer6Len is the size of one compact IPv6 peer.
+const Peer6Len = 18
+
+// ParsePeers6 decodes a compact IPv6 peer string.
+func ParsePeers6(b []byte) ([]netip.AddrPort, error) {
+	if len(b)%Peer6Len != 0 {
+		return nil, fmt.Errorf("compact: peers6 length %d is not a multiple of %d", len(b), Peer6Len)
+	}
+	peers := make([]netip.AddrPort, 0, len(b)/Peer6Len)
+	for ; len(b) > 0; b = b[Peer6Len:] {
+		var a16 [16]byte
+		copy(a16[:], b)
+		peers = append(peers, netip.AddrPortFrom(netip.AddrFrom16(a16), binary.BigEndian.Uint16(b[16:])))
+	}
+	return peers, nil
+}
+
+// AppendPeers6 appends the compact IPv6 encoding of peers to b.
+// IPv4 addresses are written in their IPv4-mapped form.
+func AppendPeers6(b []byte, peers []netip.AddrPort) ([]byte, error) {
+	for _, p := range peers {
+		if !p.Addr().IsValid() {
+			return nil, fmt.Errorf("compact: invalid peer address %s", p)
+		}
+		a16 := p.Addr().As16()
+		b = append(b, a16[:]...)
+		b = binary.BigEndian.AppendUint16(b, p.Port())
+	}
+	return b, nil
+}
+
+// Peers6 is a list of IPv6 peers that is encoded as a compact peers6 string,
+// for use as a field type in bencoded messages.
+type Peers6 []netip.AddrPort
+
+// MarshalBencode encodes ps as a compact peers6 string.
+func (ps Peers6) MarshalBencode() ([]byte, error) {
+	b, err := AppendPeers6(make([]byte, 0, len(ps)*Peer6Len), ps)
+	if err != nil {
+		return nil, err
+	}
+	return bencode.Marshal(b)
+}
+
+// UnmarshalBencode decodes a compact peers6 string.
+func (ps *Peers6) UnmarshalBencode(data []byte) error {
+	var b []byte
+	if err := bencode.Unmarshal(data, &b); err != nil {
+		return err
+	}
+	peers, err := ParsePeers6(b)
+	if err != nil {
+		return err
+	}
+	*ps = peers
+	return nil
+}
@@ -0,0 +1,78 @@
+package compact
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"go.x2ox.com/bencode"
+)
+
+func TestPeersRoundTrip(t *testing.T) {
+	ps := Peers{
+		netip.MustParseAddrPort("10.0.0.1:6881"),
+		netip.MustParseAddrPort("[::ffff:192.168.1.2]:80"),
+	}
+	b, err := bencode.Marshal(ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "12:\x0a\x00\x00\x01\x1a\xe1\xc0\xa8\x01\x02\x00\x50"; string(b) != want {
+		t.Fatalf("Marshal = %q, want %q", b, want)
+	}
+	var got Peers
+	if err = bencode.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := Peers{ps[0], netip.MustParseAddrPort("192.168.1.2:80")}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("round trip = %v, want %v", got, want)
+	}
+}
+
+func TestParsePeersRejectsBadLength(t *testing.T) {
+	for _, n := range []int{1, 5, 7, 13} {
+		if _, err := ParsePeers(make([]byte, n)); err == nil {
+			t.Errorf("ParsePeers of %d bytes succeeded", n)
+		}
+	}
+	if peers, err := ParsePeers(nil); err != nil || len(peers) != 0 {
+		t.Errorf("ParsePeers(nil) = %v, %v", peers, err)
+	}
+}
+
+func TestAppendPeersRejectsIPv6(t *testing.T) {
+	if _, err := AppendPeers(nil, []netip.AddrPort{netip.MustParseAddrPort("[2001:db8::1]:1")}); err == nil {
+		t.Fatal("AppendPeers accepted an IPv6 peer")
+	}
+}
+
+func TestPeers6RoundTrip(t *testing.T) {
+	ps := Peers6{
+		netip.MustParseAddrPort("[2001:db8::1]:6881"),
+		netip.MustParseAddrPort("10.0.0.1:80"),
+	}
+	b, err := bencode.Marshal(ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != len("36:")+2*Peer6Len {
+		t.Fatalf("Marshal = %q, want two %d-byte peers", b, Peer6Len)
+	}
+	var got Peers6
+	if err = bencode.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := Peers6{ps[0], netip.MustParseAddrPort("[::ffff:10.0.0.1]:80")}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("round trip = %v, want %v", got, want)
+	}
+}
+
+func TestParsePeers6RejectsBadLength(t *testing.T) {
+	for _, n := range []int{6, 17, 19} {
+		if _, err := ParsePeers6(make([]byte, n)); err == nil {
+			t.Errorf("ParsePeers6 of %d bytes succeeded", n)
+		}
+	}
+}
@@ -1,14 +1,23 @@
 package bencode
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"math/big"
 	"reflect"
 	"strconv"
+	"sync"
+	"unicode/utf8"
 )
 
+// Unmarshaler is the interface implemented by types that can unmarshal a
+// bencode description of themselves. UnmarshalBencode is handed the raw
+// encoding of one value wherever it appears, as the top-level value, a list
+// element or a dict value, and must copy it to keep it after returning.
 type Unmarshaler interface {
 	UnmarshalBencode([]byte) error
 }
@@ -20,67 +29,380 @@ var unmarshalerType = reflect.TypeOf(func() *Unmarshaler {
 
 type decodeState struct {
 	bytes.Buffer
+	decOpts
 	Scanner interface {
 		io.ByteScanner
 		io.Reader
 	}
 	Offset int64
+	// open is the number of lists and dicts left open by a failed decode,
+	// and broken is set if it failed on malformed input or a read error.
+	open   int
+	broken bool
+	// start is the offset of the byte string whose length was read last.
+	start int64
+	// src holds the input of the Unmarshal functions, for Scanner to point to.
+	src bytes.Buffer
+	// stats describes the input read by the last Decode; see Decoder.Stats.
+	stats DecodeStats
 }
 
+// decodeStatePool holds the states of the Unmarshal functions, and lends their
+// scratch buffers to Decoders for the duration of each Decode.
+var decodeStatePool sync.Pool
+
+// maxPooledScratch is the largest scratch buffer kept in the pool, so that
+// decoding one huge raw value does not pin its memory.
+const maxPooledScratch = 64 << 10
+
+// newDecodeState returns a state, from the pool if possible, reading data.
+func newDecodeState(data []byte) *decodeState {
+	d, _ := decodeStatePool.Get().(*decodeState)
+	if d == nil {
+		d = new(decodeState)
+	}
+	d.Reset()
+	d.src = *bytes.NewBuffer(data)
+	d.Scanner = &d.src
+	return d
+}
+
+// release returns d to the pool. Nothing it holds may be used afterwards,
+// which is why Unmarshalers are asked to copy the data they are given.
+func (d *decodeState) release() {
+	d.decOpts = decOpts{}
+	d.Scanner, d.src, d.Offset, d.stats = nil, bytes.Buffer{}, 0, DecodeStats{}
+	if d.Cap() > maxPooledScratch {
+		d.Buffer = bytes.Buffer{}
+	}
+	decodeStatePool.Put(d)
+}
+
+type decOpts struct {
+	// zeroCopy makes byte strings alias the input; see UnmarshalZeroCopy.
+	zeroCopy bool
+	// arena, when set, holds the decoded byte strings; see UnmarshalByteArena.
+	arena *ByteArena
+	// keys, when set, interns dict keys; see UnmarshalInterned.
+	keys map[string]string
+	// limits bounds the input; see Decoder.SetLimits.
+	limits Limits
+	// disallowUnknownKeys makes dict keys without a struct field an error
+	// rather than skipped; see Decoder.SetDisallowUnknownKeys.
+	disallowUnknownKeys bool
+	// validateUTF8 rejects dict keys and fields tagged utf8 that are not
+	// valid UTF-8; see Decoder.SetValidateUTF8.
+	validateUTF8 bool
+	// depth is the nesting of lists and dicts at the current position.
+	depth int
+	// path leads to the value being decoded. It is left as it is when
+	// decoding fails, for the error to tell where.
+	path Path
+	// trace, when set, is called with every token read; see Decoder.SetTrace.
+	trace func(TraceEvent)
+}
+
+// Unmarshal parses the bencode-encoded data and stores the result in the
+// value pointed to by v. Bytes after the first value are ignored; Valid or
+// Limits.Check tell whether there are any.
+//
+// A list decodes into a slice, an array, a map[K]struct{} set, or an empty
+// interface as a []interface{}. An array takes as many elements as it holds:
+// the rest of a longer list is decoded and dropped, and the elements past a
+// shorter one are zeroed. A dict decodes into a struct, a map, or an empty
+// interface as a map[string]interface{}. Lists and dicts decoded into other
+// types are an *UnmarshalTypeError. A byte string decodes into a string, a
+// []byte, a [N]byte, filled like an array from a list, or an empty interface
+// as a string.
+//
+// Decoding reuses what v already holds: a non-nil slice keeps its capacity,
+// an existing map receives the decoded entries, and an interface{} holding a
+// []interface{} or map[string]interface{} has it cleared and refilled. Servers
+// can thus recycle result structures across requests, as long as nothing else
+// still refers to them.
+//
+// If decoding fails partway, v keeps everything decoded until then, including
+// what was decoded of the value that failed, so that tools can salvage
+// corrupt files. The error tells where decoding stopped: a *SyntaxError,
+// *UnmarshalTypeError or *DecodeError holds the input offset and the path of
+// the value that failed. A dict decoded into a map[string]RawMessage is
+// checked before anything is stored, and is left alone if it is malformed.
 func Unmarshal(data []byte, v interface{}) error {
-	return (&decodeState{Scanner: bytes.NewBuffer(data)}).unmarshal(v)
+	if m, ok := v.(*map[string]RawMessage); ok && len(data) > 0 && data[0] == 'd' {
+		return withContext(unmarshalRawDict(data, m, false), data)
+	}
+	d := newDecodeState(data)
+	err := withContext(d.unmarshal(v), data)
+	d.release()
+	return err
 }
 
-func (d *decodeState) unmarshal(v interface{}) (err error) {
-	defer func() {
-		ee, ok := recover().(Error)
-		if ee != nil {
-			if ok {
-				err = ee
-			} else {
-				panic(ee)
-			}
-		}
-	}()
+// UnmarshalZeroCopy is like Unmarshal, but the strings, []byte slices and
+// byte strings in interface{} values it stores in v alias data instead of
+// being copied out of it. data is thus owned by the result: it must not be
+// modified or reused while the decoded values are in use, or they change
+// with it. Values handed to Unmarshalers are still copies.
+func UnmarshalZeroCopy(data []byte, v interface{}) error {
+	if m, ok := v.(*map[string]RawMessage); ok && len(data) > 0 && data[0] == 'd' {
+		return withContext(unmarshalRawDict(data, m, true), data)
+	}
+	d := newDecodeState(data)
+	d.zeroCopy = true
+	err := withContext(d.unmarshal(v), data)
+	d.release()
+	return err
+}
+
+// Interning bounds, so that a long-lived Decoder cannot be made to hold on to
+// arbitrary amounts of memory: longer keys, and keys seen once the table is
+// full, are allocated as usual.
+const (
+	maxInternedKeyLen = 64
+	maxInternedKeys   = 4096
+)
+
+// UnmarshalInterned is like Unmarshal, but the dict keys it stores in maps and
+// interface{} values are interned: equal keys share a single string. Decoded
+// trees of documents that repeat the same keys many times, such as the file
+// lists of large torrents, then hold one copy of each key.
+func UnmarshalInterned(data []byte, v interface{}) error {
+	d := newDecodeState(data)
+	d.keys = make(map[string]string)
+	err := withContext(d.unmarshal(v), data)
+	d.release()
+	return err
+}
 
-	rv := reflect.ValueOf(v)
-	if rv.Kind() != reflect.Ptr || rv.IsNil() {
-		return newError("invalid unmarshal arg error")
+// UnmarshalValue parses the bencode-encoded data and stores the result in v,
+// which must be settable, such as a field reached through an addressable struct.
+func UnmarshalValue(data []byte, v reflect.Value) error {
+	if !v.CanSet() {
+		return newError("invalid unmarshal value: %s is not settable", v.Type())
 	}
+	d := newDecodeState(data)
+	err := withContext(d.unmarshalValue(v), data)
+	d.release()
+	return err
+}
+
+// A Decoder reads and decodes bencode values from an input stream.
+type Decoder struct {
+	d decodeState
+	// err is the error of the last call to Decode or ReadToken.
+	err error
+	// tokens holds the lists and dicts opened by ReadToken.
+	tokens tokenStack
+}
+
+// NewDecoder returns a new decoder that reads from r.
+// If r does not implement io.ByteScanner, the decoder introduces its own buffering.
+func NewDecoder(r io.Reader) *Decoder {
+	s, ok := r.(interface {
+		io.ByteScanner
+		io.Reader
+	})
+	if !ok {
+		s = bufio.NewReader(r)
+	}
+	return &Decoder{d: decodeState{Scanner: s}}
+}
+
+// SetZeroCopy makes the decoder store byte strings that alias its input
+// instead of copies, as UnmarshalZeroCopy does. It has an effect only if the
+// decoder reads from a *bytes.Buffer, whose contents must then be left
+// untouched while the decoded values are in use.
+func (dec *Decoder) SetZeroCopy(on bool) {
+	dec.d.zeroCopy = on
+}
+
+// SetInternKeys makes the decoder share one string among all the equal dict
+// keys it decodes into maps and interface{} values, across calls to Decode.
+// See UnmarshalInterned.
+func (dec *Decoder) SetInternKeys(on bool) {
+	if !on {
+		dec.d.keys = nil
+	} else if dec.d.keys == nil {
+		dec.d.keys = make(map[string]string)
+	}
+}
+
+// SetLimits bounds the values the decoder accepts: byte strings longer than
+// l.MaxStringLen, integers of more than l.MaxIntDigits digits and nesting
+// deeper than l.MaxDepth fail to decode, before anything is allocated for
+// them. Zero fields mean the defaults of Limits.
+func (dec *Decoder) SetLimits(l Limits) {
+	dec.d.limits = l
+}
+
+// SetDisallowUnknownKeys makes the decoder fail with an *UnknownKeyError on
+// dict keys that match no exported field of the struct they are decoded into.
+// By default, the values of such keys are skipped without being decoded.
+func (dec *Decoder) SetDisallowUnknownKeys(on bool) {
+	dec.d.disallowUnknownKeys = on
+}
+
+// SetValidateUTF8 makes the decoder reject dict keys, and the strings and byte
+// strings of struct fields tagged utf8, that are not valid UTF-8, such as a
+// "name.utf-8" holding a name in another encoding. The utf8 option can tag
+// fields of strings, byte strings, and lists of them:
+//
+//	Name     string   `bencode:"name.utf-8,utf8"`
+//	PathUTF8 []string `bencode:"path.utf-8,utf8"`
+//
+// It also makes a []rune field a UTF-8 byte string rather than a list of
+// integers. As rune is int32, this applies to []int32 fields too, which are
+// lists of integers only without the option.
+func (dec *Decoder) SetValidateUTF8(on bool) {
+	dec.d.validateUTF8 = on
+}
 
-	var ok bool
+// Decode reads the next bencode value from its input and stores it in the value pointed to by v.
+// It returns io.EOF if the input is exhausted before a value starts.
+func (dec *Decoder) Decode(v interface{}) error {
+	dec.d.open, dec.d.broken = 0, false
+	dec.d.stats = DecodeStats{}
+	start := dec.d.Offset
+	dec.err = dec.decode(v)
+	dec.d.stats.Bytes = dec.d.Offset - start
+	if dec.err == nil {
+		dec.tokens.value()
+	}
+	return dec.err
+}
 
-	if ok, err = parseValue(d, rv.Elem()); err != nil {
+func (dec *Decoder) decode(v interface{}) error {
+	if _, err := dec.d.Scanner.ReadByte(); err != nil {
+		dec.d.broken = true
+		return err
+	}
+	if err := dec.d.Scanner.UnreadByte(); err != nil {
+		dec.d.broken = true
 		return err
+	}
+	return dec.withScratch(func() error { return dec.d.unmarshal(v) })
+}
+
+// withScratch calls fn with a scratch buffer borrowed for the call, so that
+// idle decoders hold none.
+func (dec *Decoder) withScratch(fn func() error) error {
+	s := newDecodeState(nil)
+	dec.d.Buffer, s.Buffer = s.Buffer, bytes.Buffer{}
+	err := fn()
+	dec.d.Reset()
+	s.Buffer, dec.d.Buffer = dec.d.Buffer, bytes.Buffer{}
+	s.release()
+	return err
+}
+
+// InputOffset returns the input offset of the next byte the decoder reads.
+// After a failed Decode, it is the offset at which decoding stopped.
+func (dec *Decoder) InputOffset() int64 {
+	return dec.d.Offset
+}
+
+// CanResync reports whether the last call to Decode failed on a value that
+// is well-formed, such as one of the wrong type for its destination, so that
+// Resync can skip the rest of it. After malformed input or a read error, the
+// decoder has no way to tell where the next value starts, and the caller has
+// to find it by other means, such as the next datagram.
+func (dec *Decoder) CanResync() bool {
+	return dec.err != nil && !dec.d.broken
+}
+
+// Resync skips the rest of the value the last call to Decode failed on, so
+// that the next call decodes the value after it. It fails if CanResync
+// reports false.
+func (dec *Decoder) Resync() error {
+	if !dec.CanResync() {
+		return newError("cannot resynchronize the input")
+	}
+	// The statistics remain those of the failed Decode.
+	stats := dec.d.stats
+	defer func() { dec.d.stats = stats }()
+	err := dec.withScratch(func() error {
+		for ; dec.d.open > 0; dec.d.open-- {
+			for {
+				ok, err := dec.d.skipValue()
+				if err != nil {
+					return err
+				}
+				if !ok {
+					break
+				}
+			}
+			if _, err := dec.d.readByte(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	dec.err = err
+	return err
+}
+
+func (d *decodeState) unmarshalValue(rv reflect.Value) error {
+	if ok, err := parseValue(d, rv); err != nil {
+		return d.locate(err)
 	} else if !ok {
-		err = newError("syntax error (Offset: %d): unexpected 'e'", d.Offset-1)
+		return d.syntaxError(d.Offset-1, errors.New("unexpected 'e'"))
 	}
-	return
+	return nil
 }
 
 func parseValue(d *decodeState, v reflect.Value) (bool, error) {
-	if v.Kind() == reflect.Ptr {
+	if ok, end, err := registeredDecoder(d, v); ok {
+		return end, err
+	}
+	for v.Kind() == reflect.Ptr {
 		if v.IsNil() {
 			v.Set(reflect.New(v.Type().Elem()))
 		}
 		v = v.Elem()
+		if ok, end, err := registeredDecoder(d, v); ok {
+			return end, err
+		}
 	}
 	if v.Type().Implements(unmarshalerType) ||
 		(v.Type().Kind() != reflect.Ptr && reflect.PtrTo(v.Type()).Implements(unmarshalerType)) {
-		if err := unmarshalerDecoder(d, v); err != nil {
-			return false, err
-		}
-		return true, nil
+		return unmarshalerDecoder(d, v)
 	}
+	return parseToken(d, v)
+}
 
-	b := d.readByte()
+// parsePlainValue is parseValue for a value that is neither a pointer nor an
+// Unmarshaler, as known in advance for the fields of a struct.
+func parsePlainValue(d *decodeState, v reflect.Value) (bool, error) {
+	if ok, end, err := registeredDecoder(d, v); ok {
+		return end, err
+	}
+	return parseToken(d, v)
+}
+
+// parseToken decodes the next value into v by the kind of its first byte.
+func parseToken(d *decodeState, v reflect.Value) (bool, error) {
+	b, err := d.readByte()
+	if err != nil {
+		return false, err
+	}
 	switch b {
 	case 'e':
+		d.emit(TraceEnd, d.Offset-1, d.depth-1, nil)
 		return false, nil
-	case 'd':
-		return true, parseDict(d, v)
-	case 'l':
-		return true, parseList(d, v)
+	case 'd', 'l':
+		d.emitOpen(b)
+		if err = d.enter(); err != nil {
+			return false, err
+		}
+		if b == 'd' {
+			err = parseDict(d, v)
+		} else {
+			err = parseList(d, v)
+		}
+		if err != nil && d.open == 0 {
+			d.open = d.depth
+		}
+		d.depth--
+		return true, err
 	case 'i':
 		return true, parseInteger(d, v)
 	default:
@@ -93,93 +415,164 @@ func parseValue(d *decodeState, v reflect.Value) (bool, error) {
 		}
 	}
 
-	return false, newUnknownValueType(d.Offset-1, b)
+	return false, d.unknownValueType(b)
 }
 
 func parseByteString(d *decodeState, v reflect.Value) error {
-	length := d.readStringLength() // 读取长度
-	b := d.readLength(length)      // 根据长度读取数据
+	length, err := d.readStringLength() // 读取长度
+	if err != nil {
+		return err
+	}
+	b, err := d.readLength(length) // 根据长度读取数据
+	if err != nil {
+		return err
+	}
 
 	switch v.Kind() {
 	case reflect.String:
 		v.SetString(bytesAsString(b))
 		return nil
 	case reflect.Slice:
-		if v.Type().Elem().Kind() != reflect.Uint8 {
-			break
+		switch v.Type().Elem().Kind() {
+		case reflect.Uint8:
+			v.SetBytes(b)
+			return nil
 		}
-		v.SetBytes(b)
-		return nil
 	case reflect.Array:
 		if v.Type().Elem().Kind() != reflect.Uint8 {
 			break
 		}
-		reflect.Copy(v, reflect.ValueOf(b))
+		// Like a list, a byte string fills as much of the array as it can,
+		// and the bytes past a shorter one are zeroed.
+		n := reflect.Copy(v, reflect.ValueOf(b))
+		for ; n < v.Len(); n++ {
+			v.Index(n).SetUint(0)
+		}
 		return nil
 	case reflect.Interface:
 		v.Set(reflect.ValueOf(bytesAsString(b)))
 		return nil
 	}
-	return newError("cannot unmarshal a bencode %s into a %s", v, v.Type())
+	return d.typeError(StringKind, v.Type())
 }
 
 func parseInteger(d *decodeState, v reflect.Value) error {
-	s := d.readInt()
+	s, err := d.readInt()
+	if err != nil {
+		return err
+	}
 	if v.Type() == bigIntType || (v.Kind() == reflect.Ptr && v.Elem().Type() == bigIntType) {
-		return bigIntDecoder(d, v)
+		return setBigInt(d, v, s)
 	}
 	switch v.Kind() {
 	case reflect.Interface:
 		n, err := strconv.ParseInt(s, 10, 64)
 		if err != nil {
-			return newError("cannot unmarshal a bencode %s into a %s", v, v.Type)
+			return d.typeError(IntegerKind, v.Type())
 		}
 		v.Set(reflect.ValueOf(n))
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		n, err := strconv.ParseInt(s, 10, 64)
 		if err != nil || v.OverflowInt(n) {
-			return newError("cannot unmarshal a bencode %s into a %s", v, v.Type)
+			return d.typeError(IntegerKind, v.Type())
 		}
 		v.SetInt(n)
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 		n, err := strconv.ParseUint(s, 10, 64)
 		if err != nil || v.OverflowUint(n) {
-			return newError("cannot unmarshal a bencode %s into a %s", v, v.Type)
+			return d.typeError(IntegerKind, v.Type())
 		}
 		v.SetUint(n)
 	case reflect.Bool:
 		v.SetBool(s != "0")
 	default:
-		return newUnknownType()
+		return d.typeError(IntegerKind, v.Type())
 	}
 	return nil
 }
 func parseList(d *decodeState, v reflect.Value) error {
 	switch v.Kind() {
 	case reflect.Slice:
-		v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+		if ok, err := parsePrimitiveList(d, v); ok {
+			return err
+		}
+		// Grow the slice by doubling its capacity ahead of need, and decode
+		// every element in place, rather than appending them one by one.
+		// The capacity of a non-nil slice is reused; the elements it held
+		// are zeroed before being decoded into.
+		reused := v.Cap()
+		if v.IsNil() {
+			v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+		} else {
+			v.SetLen(0)
+		}
 		for i := 0; ; i++ {
-			v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
-			if end, err := parseValue(d, v.Index(i)); err != nil {
+			if i == v.Cap() {
+				grown := reflect.MakeSlice(v.Type(), i, 2*i+4)
+				reflect.Copy(grown, v)
+				v.Set(grown)
+			}
+			v.SetLen(i + 1)
+			if i < reused {
+				v.Index(i).Set(reflect.Zero(v.Type().Elem()))
+			}
+			d.pushIndex(i)
+			end, err := parseValue(d, v.Index(i))
+			if err != nil {
 				return err
-			} else if end {
+			}
+			d.pop()
+			if !end {
+				v.SetLen(i)
 				break
 			}
 		}
 	case reflect.Array:
-		for i := 0; i < v.Len(); i++ {
-			if end, err := parseValue(d, v.Index(i)); err != nil {
+		for i := 0; ; i++ {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if i < v.Len() {
+				elem = v.Index(i)
+			}
+			d.pushIndex(i)
+			end, err := parseValue(d, elem)
+			if err != nil {
 				return err
-			} else if !end {
-				v.Index(i).Set(reflect.Zero(v.Type().Elem()))
 			}
+			d.pop()
+			if !end {
+				for ; i < v.Len(); i++ {
+					v.Index(i).Set(reflect.Zero(v.Type().Elem()))
+				}
+				break
+			}
+		}
+	case reflect.Map:
+		if !isSetType(v.Type()) {
+			return d.typeError(ListKind, v.Type())
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for i := 0; ; i++ {
+			key := reflect.New(v.Type().Key()).Elem()
+			d.pushIndex(i)
+			end, err := parseValue(d, key)
+			if err != nil {
+				return err
+			}
+			d.pop()
+			if !end {
+				break
+			}
+			v.SetMapIndex(key, reflect.Zero(v.Type().Elem()))
 		}
 	case reflect.Interface:
-		var x []interface{}
-		v.Set(reflect.ValueOf(&x).Elem())
-		return parseList(d, v.Elem())
+		x, _ := v.Interface().([]interface{})
+		err := parseList(d, reflect.ValueOf(&x).Elem())
+		v.Set(reflect.ValueOf(x))
+		return err
 	default:
-
+		return d.typeError(ListKind, v.Type())
 	}
 
 	return nil
@@ -187,14 +580,30 @@ func parseList(d *decodeState, v reflect.Value) error {
 
 func parseDict(d *decodeState, v reflect.Value) error {
 	if v.Kind() == reflect.Interface {
-		var x map[string]interface{}
-		v.Set(reflect.ValueOf(&x).Elem())
-		return parseDict(d, v.Elem())
+		x, ok := v.Interface().(map[string]interface{})
+		if ok && x != nil {
+			for k := range x {
+				delete(x, k)
+			}
+		} else {
+			x = make(map[string]interface{})
+		}
+		err := parseDict(d, reflect.ValueOf(x))
+		v.Set(reflect.ValueOf(x))
+		return err
+	}
+
+	if v.Kind() == reflect.Struct {
+		return parseStruct(d, v)
+	}
+	// Dict keys are byte strings, which only convert to string keys.
+	if v.Kind() == reflect.Map && v.Type().Key().Kind() != reflect.String {
+		return d.typeError(DictKind, v.Type())
 	}
 
 	for {
-		var key string
-		if end, err := parseValue(d, reflect.ValueOf(&key).Elem()); err != nil {
+		key, end, err := d.readDictKey()
+		if err != nil {
 			return err
 		} else if !end {
 			return nil
@@ -203,56 +612,248 @@ func parseDict(d *decodeState, v reflect.Value) error {
 		switch v.Kind() {
 		case reflect.Map:
 			value := reflect.New(v.Type().Elem()).Elem()
-			if end, err := parseValue(d, value); err != nil {
-				return newParseError(key, err)
-			} else if !end {
-				return fmt.Errorf("missing value for key %q", key)
+			d.pushKey(key)
+			end, err := parseValue(d, value)
+			// A value that failed is stored as far as it was decoded.
+			if end {
+				if v.IsNil() {
+					v.Set(reflect.MakeMap(v.Type()))
+				}
+				v.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), value)
 			}
-			if v.IsNil() {
-				v.Set(reflect.MakeMap(v.Type()))
+			if err != nil {
+				return err
+			} else if !end {
+				return d.syntaxError(d.Offset-1, errors.New("missing value"))
 			}
-			v.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), value)
-		case reflect.Struct:
-			sf, ok := getStructFieldForKey(v.Type(), key)
-			if !ok || sf.r.PkgPath != "" {
-				return newError("")
+			d.pop()
+		default:
+			return d.typeError(DictKind, v.Type())
+		}
+	}
+
+}
+
+// parseStruct decodes the entries of a dict into the fields of the struct v
+// following the precompiled plan of its type. Keys are looked up without
+// being allocated as strings.
+func parseStruct(d *decodeState, v reflect.Value) error {
+	fields := cachedFieldDecoders(v.Type())
+	for {
+		key, ok, err := d.readKey()
+		if err != nil || !ok {
+			return err
+		}
+		if err = d.checkKey(key); err != nil {
+			return err
+		}
+		f, ok := fields[string(key)]
+		if !ok || !f.exported {
+			d.pushKey(string(key))
+			d.Reset()
+			if d.disallowUnknownKeys {
+				return &UnknownKeyError{Key: string(key), Type: v.Type(), Offset: d.start}
 			}
-			value := v.FieldByIndex(sf.r.Index)
-			if end, err := parseValue(d, value); err != nil {
-				return newParseError(key, err)
+			if end, err := d.skipValue(); err != nil {
+				return err
 			} else if !end {
-				return newError("missing value for key %q", key)
+				return d.syntaxError(d.Offset-1, errors.New("missing value"))
+			}
+			d.pop()
+			continue
+		}
+		d.Reset()
+		d.pushKey(f.key)
+		if end, err := f.parse(d, v.Field(f.index)); err != nil {
+			return err
+		} else if !end {
+			return d.syntaxError(d.Offset-1, errors.New("missing value"))
+		}
+		d.pop()
+	}
+}
+
+// readDictKey reads a dict key as a string, interned if the decoder interns
+// keys. Like parseValue, it reports false at the end of the dict.
+func (d *decodeState) readDictKey() (string, bool, error) {
+	if d.keys == nil {
+		var key string
+		end, err := parseValue(d, reflect.ValueOf(&key).Elem())
+		if err == nil && end {
+			err = d.checkKey(stringAsBytes(key))
+		}
+		return key, end, err
+	}
+	b, ok, err := d.readKey()
+	if err != nil || !ok {
+		return "", false, err
+	}
+	if err = d.checkKey(b); err != nil {
+		return "", false, err
+	}
+	key, ok := d.keys[string(b)]
+	if !ok {
+		key = string(b)
+		if len(key) <= maxInternedKeyLen && len(d.keys) < maxInternedKeys {
+			d.keys[key] = key
+		}
+	}
+	d.Reset()
+	return key, true, nil
+}
+
+// checkKey rejects a dict key that is not valid UTF-8 if the decoder
+// validates UTF-8.
+func (d *decodeState) checkKey(key []byte) error {
+	if d.validateUTF8 && !utf8.Valid(key) {
+		return newError("dict key %q is not valid UTF-8", key)
+	}
+	return nil
+}
+
+// parseUTF8Value decodes a field tagged utf8 with parse, then checks that its
+// strings are valid UTF-8 if the decoder validates UTF-8.
+func parseUTF8Value(parse func(d *decodeState, v reflect.Value) (bool, error)) func(d *decodeState, v reflect.Value) (bool, error) {
+	return func(d *decodeState, v reflect.Value) (bool, error) {
+		end, err := parse(d, v)
+		if err == nil && end && d.validateUTF8 && !validUTF8(v) {
+			return true, newError("%s value is not valid UTF-8", v.Type())
+		}
+		return end, err
+	}
+}
+
+// validUTF8 reports whether the strings and byte strings held by v are valid
+// UTF-8.
+func validUTF8(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String:
+		return utf8.ValidString(v.String())
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil() || validUTF8(v.Elem())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return utf8.Valid(v.Bytes())
+		}
+		for i := 0; i < v.Len(); i++ {
+			if !validUTF8(v.Index(i)) {
+				return false
 			}
 		}
 	}
+	return true
+}
+
+// readKey reads a dict key into the buffer and returns it, or reports false
+// at the end of the dict. The key is only valid until the next read.
+func (d *decodeState) readKey() ([]byte, bool, error) {
+	b, err := d.readByte()
+	if err != nil {
+		return nil, false, err
+	}
+	if b == 'e' {
+		d.emit(TraceEnd, d.Offset-1, d.depth-1, nil)
+		return nil, false, nil
+	}
+	if b < '0' || b > '9' {
+		return nil, false, d.unknownValueType(b)
+	}
+	d.Reset()
+	if err = d.WriteByte(b); err != nil {
+		return nil, false, err
+	}
+	length, err := d.readStringLength()
+	if err != nil {
+		return nil, false, err
+	}
+	for i := int64(0); i < length; i++ {
+		if b, err = d.readByte(); err != nil {
+			return nil, false, err
+		}
+		if err = d.WriteByte(b); err != nil {
+			return nil, false, err
+		}
+	}
+	d.emit(TraceString, d.start, d.depth, d.Bytes())
+	return d.Bytes(), true, nil
+}
+
+// parseHexValue decodes a hex byte string into a []byte or [N]byte.
+func parseHexValue(d *decodeState, v reflect.Value) (bool, error) {
+	var s string
+	if end, err := parseValue(d, reflect.ValueOf(&s).Elem()); err != nil || !end {
+		return end, err
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return true, newError("invalid hex string: %s", err)
+	}
+
+	switch {
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		v.SetBytes(b)
+	case v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8:
+		if len(b) != v.Len() {
+			return true, newError("hex string decodes to %d bytes, want %d", len(b), v.Len())
+		}
+		reflect.Copy(v, reflect.ValueOf(b))
+	default:
+		return true, d.typeError(StringKind, v.Type())
+	}
+	return true, nil
+}
 
+// parseRunesValue decodes a byte string into a []rune or []int32 field tagged
+// utf8, one element per code point. Invalid UTF-8 is rejected if the decoder
+// validates UTF-8, and decodes to U+FFFD otherwise.
+func parseRunesValue(d *decodeState, v reflect.Value) (bool, error) {
+	var s string
+	if end, err := parseValue(d, reflect.ValueOf(&s).Elem()); err != nil || !end {
+		return end, err
+	}
+	if d.validateUTF8 && !utf8.ValidString(s) {
+		return true, newError("%s value is not valid UTF-8", v.Type())
+	}
+	r := []rune(s)
+	rv := reflect.MakeSlice(v.Type(), len(r), len(r))
+	for i := range r {
+		rv.Index(i).SetInt(int64(r[i]))
+	}
+	v.Set(rv)
+	return true, nil
 }
 
-func unmarshalerDecoder(d *decodeState, v reflect.Value) error {
+// unmarshalerDecoder hands the raw encoding of the next value to v's UnmarshalBencode.
+// Like parseValue, it reports false if it finds the end of the enclosing list or dict instead.
+func unmarshalerDecoder(d *decodeState, v reflect.Value) (bool, error) {
 	if !v.Type().Implements(unmarshalerType) && v.Addr().Type().Implements(unmarshalerType) {
 		v = v.Addr()
 	}
 	m, ok := v.Interface().(Unmarshaler)
 	if !ok {
-		return newError("reflect.Value.Addr of unaddressable value: %s", v.Type())
+		return false, newError("reflect.Value.Addr of unaddressable value: %s", v.Type())
 	}
 	d.Reset()
-	if !d.readValue() {
-		return newError("a")
+	if ok, err := d.readValue(); err != nil || !ok {
+		return false, d.skipEnd(err)
 	}
 
-	return m.UnmarshalBencode(d.Bytes())
+	if err := m.UnmarshalBencode(d.Bytes()); err != nil {
+		return true, &MarshalerError{Type: v.Type(), Err: err, sourceFunc: "UnmarshalBencode"}
+	}
+	return true, nil
 }
 
-func bigIntDecoder(d *decodeState, v reflect.Value) error {
-	s := d.readInt()
+// setBigInt stores the integer of digits s, just read, in the big.Int or
+// *big.Int v.
+func setBigInt(d *decodeState, v reflect.Value, s string) error {
 	if s == "" {
-		return newError("")
+		return d.typeError(IntegerKind, bigIntType)
 	}
 
 	bi, ok := new(big.Int).SetString(s, 10)
 	if !ok {
-		return newError("")
+		return d.typeError(IntegerKind, bigIntType)
 	}
 
 	if v.Type() != bigIntType {
@@ -263,102 +864,317 @@ func bigIntDecoder(d *decodeState, v reflect.Value) error {
 	return nil
 }
 
-func (d *decodeState) readByte() byte {
+func (d *decodeState) readByte() (byte, error) {
 	b, err := d.Scanner.ReadByte()
 	if err != nil {
-		panic(newSyntaxError(d.Offset, err))
+		return 0, d.truncated(err)
 	}
 	d.Offset++
-	return b
+	return b, nil
 }
-func (d *decodeState) unreadByte() {
+func (d *decodeState) unreadByte() error {
 	if err := d.Scanner.UnreadByte(); err != nil {
-		panic(newSyntaxError(d.Offset, err))
+		return d.syntaxError(d.Offset, err)
 	}
 	d.Offset--
+	return nil
 }
-func (d *decodeState) readUntil(sep byte) {
+func (d *decodeState) readUntil(sep byte) error {
 	for {
-		b := d.readByte()
+		b, err := d.readByte()
+		if err != nil {
+			return err
+		}
 		if b == sep {
-			return
+			return nil
 		}
-		if err := d.WriteByte(b); err != nil {
-			panic(Error(err))
+		if err = d.WriteByte(b); err != nil {
+			return err
 		}
 	}
 }
-func (d *decodeState) readInt() string {
-	d.readUntil('e')
+
+// readIntDigits appends the digits of an integer, whose 'i' was just read, to
+// the buffer and consumes its closing 'e', failing on more digits than the
+// limits allow before buffering them.
+func (d *decodeState) readIntDigits() error {
+	start, n, max := d.Len(), 0, d.limits.intDigits()
+	for {
+		b, err := d.readByte()
+		if err != nil {
+			return err
+		}
+		if b == 'e' {
+			return nil
+		}
+		if b != '-' {
+			if n++; n > max {
+				return d.syntaxError(d.Offset-int64(d.Len()-start)-2, ErrIntegerTooLong)
+			}
+		}
+		if err = d.WriteByte(b); err != nil {
+			return err
+		}
+	}
+}
+
+// readInt reads the digits of an integer up to its closing 'e'. The string
+// aliases the buffer, and is only valid until the next read.
+func (d *decodeState) readInt() (string, error) {
+	if err := d.readIntDigits(); err != nil {
+		return "", err
+	}
+	d.emit(TraceInteger, d.Offset-int64(d.Len())-2, d.depth, d.Bytes())
 	if d.Len() == 0 {
-		return ""
+		return "", nil
 	}
 	defer d.Reset()
-	return bytesAsString(d.Bytes())
+	return bytesAsString(d.Bytes()), nil
 }
 
-func (d *decodeState) readValue() bool {
-	b := d.readByte()
+// readValue appends the raw encoding of the next value to the buffer, or
+// reports false, leaving it unread, if the next byte ends the enclosing list or dict.
+func (d *decodeState) readValue() (bool, error) {
+	b, err := d.readByte()
+	if err != nil {
+		return false, err
+	}
 	if b == 'e' {
-		d.unreadByte()
-		return false
+		return false, d.unreadByte()
 	}
-	if err := d.WriteByte(b); err != nil {
-		panic(Error(err))
+	if err = d.WriteByte(b); err != nil {
+		return false, err
 	}
 
 	switch b {
 	case 'd', 'l':
-		for d.readValue() {
+		d.emitOpen(b)
+		if err = d.enter(); err != nil {
+			return false, err
+		}
+		for {
+			ok, err := d.readValue()
+			if err != nil {
+				d.depth--
+				return false, err
+			}
+			if !ok {
+				break
+			}
 		}
-		b = d.readByte()
-		if err := d.WriteByte(b); err != nil {
-			panic(Error(err))
+		d.depth--
+		if b, err = d.readByte(); err != nil {
+			return false, err
+		}
+		d.emit(TraceEnd, d.Offset-1, d.depth, nil)
+		if err = d.WriteByte(b); err != nil {
+			return false, err
 		}
 	case 'i':
-		d.readUntil('e')
-		if _, err := d.WriteString("e"); err != nil {
-			panic(Error(err))
+		start := d.Len()
+		if err = d.readIntDigits(); err != nil {
+			return false, err
+		}
+		d.emit(TraceInteger, d.Offset-int64(d.Len()-start)-2, d.depth, d.Bytes()[start:])
+		if err = d.WriteByte('e'); err != nil {
+			return false, err
 		}
 	default:
-		if b >= '0' && b <= '9' {
-			start := d.Len() - 1
-			d.readUntil(':')
-			length, err := strconv.ParseInt(bytesAsString(d.Bytes()[start:]), 10, 64)
+		if b < '0' || b > '9' {
+			return false, d.unknownValueType(b)
+		}
+		offset, start := d.Offset-1, d.Len()-1
+		if err = d.readUntil(':'); err != nil {
+			return false, err
+		}
+		length, err := strconv.ParseInt(bytesAsString(d.Bytes()[start:]), 10, 64)
+		if err != nil {
+			return false, d.syntaxError(d.Offset, fmt.Errorf("invalid byte string length %q", d.Bytes()[start:]))
+		}
+		if err = d.checkLength(length); err != nil {
+			return false, err
+		}
+		if err = d.WriteByte(':'); err != nil {
+			return false, err
+		}
+		payload := d.Len()
+		length, err = io.CopyN(d, d.Scanner, length)
+		d.Offset += length
+		if err != nil {
+			return false, d.truncated(err)
+		}
+		d.emit(TraceString, offset, d.depth, d.Bytes()[payload:])
+	}
+	return true, nil
+}
+
+// skipValue reads past the next value without keeping it, or reports false,
+// leaving it unread, if the next byte ends the enclosing list or dict. Byte
+// strings are discarded as they are read, and nothing is allocated for them.
+func (d *decodeState) skipValue() (bool, error) {
+	b, err := d.readByte()
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case b == 'e':
+		return false, d.unreadByte()
+	case b == 'd' || b == 'l':
+		d.emitOpen(b)
+		if err = d.enter(); err != nil {
+			return false, err
+		}
+		for {
+			ok, err := d.skipValue()
 			if err != nil {
-				panic(Error(err))
+				d.depth--
+				return false, err
 			}
-			if _, err = d.WriteString(":"); err != nil {
-				panic(Error(err))
+			if !ok {
+				break
 			}
-			length, err = io.CopyN(d, d.Scanner, length)
+		}
+		d.depth--
+		if _, err = d.readByte(); err == nil {
+			d.emit(TraceEnd, d.Offset-1, d.depth, nil)
+		}
+	case b == 'i':
+		_, err = d.readInt()
+		d.Reset()
+	case b >= '0' && b <= '9':
+		d.Reset()
+		if err = d.WriteByte(b); err != nil {
+			return false, err
+		}
+		var length int64
+		if length, err = d.readStringLength(); err != nil {
+			return false, err
+		}
+		if buf, ok := d.Scanner.(*bytes.Buffer); ok && int64(buf.Len()) >= length {
+			buf.Next(int(length))
+			d.Offset += length
+		} else if length, err = io.CopyN(io.Discard, d.Scanner, length); err != nil {
+			d.Offset += length
+			return false, d.truncated(err)
+		} else {
 			d.Offset += length
-			if err != nil {
-				panic(Error(err))
-			}
-			break
 		}
-		panic(newUnknownValueType(d.Offset-1, b))
+		d.emitSkipped(d.start, d.depth, length)
+	default:
+		return false, d.unknownValueType(b)
 	}
-	return true
+	return err == nil, err
 }
 
-func (d *decodeState) readStringLength() int64 {
-	d.readUntil(':')
+func (d *decodeState) readStringLength() (int64, error) {
+	d.start = d.Offset - int64(d.Len())
+	if err := d.readUntil(':'); err != nil {
+		return 0, err
+	}
+	// The *strconv.NumError would keep the buffer alive under a string
+	// aliasing it, so errors quote a copy of the length instead.
 	length, err := strconv.ParseInt(bytesAsString(d.Bytes()), 10, 0)
 	if err != nil {
-		panic(Error(err))
+		err = d.syntaxError(d.Offset, fmt.Errorf("invalid byte string length %q", d.Bytes()))
+	} else {
+		err = d.checkLength(length)
 	}
-	defer d.Reset()
-	return length
+	d.Reset()
+	return length, err
 }
 
-func (d *decodeState) readLength(length int64) []byte {
-	b := make([]byte, length)
-	n, err := io.ReadFull(d.Scanner, b)
-	d.Offset += int64(n)
-	if err != nil {
-		panic(Error(err))
+// checkLength rejects the declared length of a byte string if it is negative
+// or over the limit.
+func (d *decodeState) checkLength(length int64) error {
+	if length < 0 {
+		return d.syntaxError(d.Offset, fmt.Errorf("negative byte string length %d", length))
+	}
+	if d.limits.MaxStringLen > 0 && length > int64(d.limits.MaxStringLen) {
+		return d.syntaxError(d.Offset, ErrStringTooLong)
+	}
+	return nil
+}
+
+// enter accounts for a list or dict being opened, failing past the max depth.
+func (d *decodeState) enter() error {
+	d.depth++
+	if d.depth > maxNestingDepth || d.limits.MaxDepth > 0 && d.depth > d.limits.MaxDepth {
+		d.depth--
+		return d.syntaxError(d.Offset-1, ErrDepthExceeded)
+	}
+	return nil
+}
+
+// skipEnd consumes the 'e' that readValue left unread when it reported the
+// end of a list or dict, unless err is set.
+func (d *decodeState) skipEnd(err error) error {
+	if err == nil {
+		if _, err = d.readByte(); err == nil {
+			d.emit(TraceEnd, d.Offset-1, d.depth-1, nil)
+		}
+	}
+	return err
+}
+
+// readChunk is the most readLength allocates ahead of the data it has read
+// from a reader of unknown length.
+const readChunk = 64 << 10
+
+// readLength reads the payload of a byte string of the given length, whose
+// length was just read by readStringLength.
+func (d *decodeState) readLength(length int64) ([]byte, error) {
+	b, err := d.readPayload(length)
+	if err == nil {
+		d.emit(TraceString, d.start, d.depth, b)
+	}
+	return b, err
+}
+
+// readPayload reads a byte string of the given length. The length is declared
+// by the input and cannot be trusted: it is checked against what remains of a
+// *bytes.Buffer before anything is allocated, and large strings from other
+// readers are read in chunks that grow only as their data arrives.
+func (d *decodeState) readPayload(length int64) ([]byte, error) {
+	buf, known := d.Scanner.(*bytes.Buffer)
+	if known && int64(buf.Len()) < length {
+		d.Offset += int64(buf.Len())
+		return nil, d.syntaxError(d.Offset, ErrUnexpectedEOF)
+	}
+	if known && d.zeroCopy {
+		d.Offset += length
+		b := buf.Next(int(length))
+		return b[:len(b):len(b)], nil
+	}
+	if known || length <= readChunk {
+		var b []byte
+		if d.arena != nil {
+			b = d.arena.alloc(int(length))
+		} else {
+			b = make([]byte, length)
+		}
+		n, err := io.ReadFull(d.Scanner, b)
+		d.Offset += int64(n)
+		if err != nil {
+			return nil, d.truncated(err)
+		}
+		return b, nil
+	}
+
+	b := make([]byte, 0, readChunk)
+	for int64(len(b)) < length {
+		if len(b) == cap(b) {
+			b = append(b, 0)[:len(b)]
+		}
+		end := cap(b)
+		if int64(end) > length {
+			end = int(length)
+		}
+		n, err := io.ReadFull(d.Scanner, b[len(b):end])
+		d.Offset += int64(n)
+		b = b[:len(b)+n]
+		if err != nil {
+			return nil, d.truncated(err)
+		}
 	}
-	return b
+	return b[:len(b):len(b)], nil
 }
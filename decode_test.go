@@ -0,0 +1,659 @@
+//go:build !bencode_lite
+
+package bencode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func TestDecodeRuneSlice(t *testing.T) {
+	var ints struct {
+		V []int32 `bencode:"v"`
+	}
+	if err := Unmarshal([]byte("d1:v2:abe"), &ints); err == nil {
+		t.Fatalf("untagged []int32 decoded a byte string: %v", ints.V)
+	}
+
+	var text struct {
+		V []rune `bencode:"v,utf8"`
+	}
+	dec := NewDecoder(bytes.NewBufferString("d1:v2:\xff\xfee"))
+	dec.SetValidateUTF8(true)
+	if err := dec.Decode(&text); err == nil {
+		t.Fatalf("invalid UTF-8 decoded: %q", string(text.V))
+	}
+}
+
+func TestUnmarshalZeroCopyAliasing(t *testing.T) {
+	data := []byte("d1:b3:def1:s3:abc1:xl3:ghiee")
+	var v struct {
+		B []byte        `bencode:"b"`
+		S string        `bencode:"s"`
+		X []interface{} `bencode:"x"`
+	}
+	if err := UnmarshalZeroCopy(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	within := func(p uintptr) bool {
+		start := uintptr(unsafe.Pointer(&data[0]))
+		return p >= start && p < start+uintptr(len(data))
+	}
+	stringData := func(s string) uintptr {
+		return (*reflect.StringHeader)(unsafe.Pointer(&s)).Data
+	}
+	if !within(uintptr(unsafe.Pointer(&v.B[0]))) || !within(stringData(v.S)) || !within(stringData(v.X[0].(string))) {
+		t.Fatal("zero-copy values do not alias the input")
+	}
+	if cap(v.B) != len(v.B) {
+		t.Errorf("cap(B) = %d, want %d so that appending cannot overwrite the input", cap(v.B), len(v.B))
+	}
+	copy(data, "d1:b3:XYZ1:s3:ABC1:xl3:GHIee")
+	if string(v.B) != "XYZ" || v.S != "ABC" || v.X[0] != "GHI" {
+		t.Errorf("got %q %q %q after changing the input", v.B, v.S, v.X[0])
+	}
+
+	// Unmarshal copies.
+	data = []byte("d1:b3:def1:s3:abc1:xl3:ghiee")
+	if err := Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	if within(uintptr(unsafe.Pointer(&v.B[0]))) || within(stringData(v.S)) || within(stringData(v.X[0].(string))) {
+		t.Fatal("Unmarshal values alias the input")
+	}
+}
+
+func TestDecodeLists(t *testing.T) {
+	t.Run("slice", func(t *testing.T) {
+		var v []int
+		if err := Unmarshal([]byte("li1ei2ei3ee"), &v); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(v, []int{1, 2, 3}) {
+			t.Fatalf("got %v", v)
+		}
+		if err := Unmarshal([]byte("le"), &v); err != nil {
+			t.Fatal(err)
+		}
+		if v == nil || len(v) != 0 {
+			t.Fatalf("empty list decoded to %#v, want an empty slice", v)
+		}
+	})
+
+	t.Run("nested slices", func(t *testing.T) {
+		var v [][]string
+		if err := Unmarshal([]byte("ll1:a1:bel1:cee"), &v); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(v, [][]string{{"a", "b"}, {"c"}}) {
+			t.Fatalf("got %v", v)
+		}
+	})
+
+	t.Run("array", func(t *testing.T) {
+		tests := []struct {
+			in   string
+			want [3]int
+		}{
+			{"li1ei2ei3ee", [3]int{1, 2, 3}},
+			{"li1ee", [3]int{1, 0, 0}},
+			{"li1ei2ei3ei4ei5ee", [3]int{1, 2, 3}},
+			{"le", [3]int{}},
+		}
+		for _, tt := range tests {
+			v := [3]int{7, 8, 9}
+			if err := Unmarshal([]byte(tt.in), &v); err != nil {
+				t.Fatalf("%s: %v", tt.in, err)
+			}
+			if v != tt.want {
+				t.Errorf("%s: got %v, want %v", tt.in, v, tt.want)
+			}
+		}
+	})
+
+	t.Run("array in a list", func(t *testing.T) {
+		var v struct {
+			A [2]int `bencode:"a"`
+			B int    `bencode:"b"`
+		}
+		if err := Unmarshal([]byte("d1:ali1ei2ei3ee1:bi4ee"), &v); err != nil {
+			t.Fatal(err)
+		}
+		if v.A != [2]int{1, 2} || v.B != 4 {
+			t.Fatalf("got %+v", v)
+		}
+	})
+
+	t.Run("interface", func(t *testing.T) {
+		var v interface{}
+		if err := Unmarshal([]byte("li1e4:spamli2eed1:ai3eee"), &v); err != nil {
+			t.Fatal(err)
+		}
+		want := []interface{}{int64(1), "spam", []interface{}{int64(2)}, map[string]interface{}{"a": int64(3)}}
+		if !reflect.DeepEqual(v, want) {
+			t.Fatalf("got %#v, want %#v", v, want)
+		}
+	})
+
+	t.Run("empty dict in interface", func(t *testing.T) {
+		var v interface{}
+		if err := Unmarshal([]byte("de"), &v); err != nil {
+			t.Fatal(err)
+		}
+		if m, ok := v.(map[string]interface{}); !ok || m == nil || len(m) != 0 {
+			t.Fatalf("got %#v, want an empty map", v)
+		}
+	})
+}
+
+func TestDecodeContainerTypeErrors(t *testing.T) {
+	tests := []struct {
+		in string
+		v  interface{}
+	}{
+		{"li1ee", new(int)},
+		{"li1ee", new(string)},
+		{"li1ee", new(struct{})},
+		{"d1:ai1ee", new(int)},
+		{"d1:ai1ee", new([]int)},
+		{"d1:ai1ee", new([2]int)},
+	}
+	for _, tt := range tests {
+		err := Unmarshal([]byte(tt.in), tt.v)
+		var te *UnmarshalTypeError
+		if !errors.As(err, &te) {
+			t.Errorf("Unmarshal(%q, %T) = %v, want an *UnmarshalTypeError", tt.in, tt.v, err)
+		}
+	}
+}
+
+func TestDecodeByteArray(t *testing.T) {
+	tests := []struct {
+		in   string
+		want [4]byte
+	}{
+		{"4:abcd", [4]byte{'a', 'b', 'c', 'd'}},
+		{"2:ab", [4]byte{'a', 'b'}},
+		{"6:abcdef", [4]byte{'a', 'b', 'c', 'd'}},
+		{"li97ei98ee", [4]byte{'a', 'b'}},
+	}
+	for _, tt := range tests {
+		v := [4]byte{9, 9, 9, 9}
+		if err := Unmarshal([]byte(tt.in), &v); err != nil {
+			t.Fatalf("%q: %v", tt.in, err)
+		}
+		if v != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.in, v, tt.want)
+		}
+	}
+}
+
+// upper is an Unmarshaler that keeps a copy of the byte string it is given.
+type upper string
+
+func (u *upper) UnmarshalBencode(b []byte) error {
+	var s string
+	if err := Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*u = upper(strings.ToUpper(s))
+	return nil
+}
+
+func TestDecodeUnmarshalerInContainers(t *testing.T) {
+	var l []upper
+	if err := Unmarshal([]byte("l1:a2:bce"), &l); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(l, []upper{"A", "BC"}) {
+		t.Fatalf("list: got %q", l)
+	}
+
+	var m map[string]upper
+	if err := Unmarshal([]byte("d1:x1:a1:y1:be"), &m); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, map[string]upper{"x": "A", "y": "B"}) {
+		t.Fatalf("dict: got %q", m)
+	}
+
+	var empty []upper
+	if err := Unmarshal([]byte("le"), &empty); err != nil || len(empty) != 0 {
+		t.Fatalf("empty list: got %q, %v", empty, err)
+	}
+}
+
+type roundTripInner struct {
+	N int64  `bencode:"n"`
+	S string `bencode:"s"`
+}
+
+type roundTripStruct struct {
+	Int      int                        `bencode:"int"`
+	Int8     int8                       `bencode:"int8"`
+	Uint64   uint64                     `bencode:"uint64"`
+	Bool     bool                       `bencode:"bool"`
+	String   string                     `bencode:"string"`
+	Bytes    []byte                     `bencode:"bytes"`
+	Strings  []string                   `bencode:"strings"`
+	Int64s   []int64                    `bencode:"int64s"`
+	Blobs    [][]byte                   `bencode:"blobs"`
+	Inner    roundTripInner             `bencode:"inner"`
+	Ptr      *roundTripInner            `bencode:"ptr"`
+	Inners   []roundTripInner           `bencode:"inners"`
+	Map      map[string]int             `bencode:"map"`
+	Nested   map[string]*roundTripInner `bencode:"nested"`
+	Big      *big.Int                   `bencode:"big"`
+	Raw      RawMessage                 `bencode:"raw"`
+	Omitted  string                     `bencode:"omitted,omitempty"`
+	Ignored  int                        `bencode:"-"`
+	Renamed  int                        `bencode:"other name"`
+	internal int
+}
+
+func TestRoundTrip(t *testing.T) {
+	huge, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+	full := roundTripStruct{
+		Int:     -1,
+		Int8:    -128,
+		Uint64:  math.MaxUint64,
+		Bool:    true,
+		String:  "spam",
+		Bytes:   []byte{0, 1, 0xff},
+		Strings: []string{"a", "", "c"},
+		Int64s:  []int64{math.MinInt64, 0, math.MaxInt64},
+		Blobs:   [][]byte{{1}, {}},
+		Inner:   roundTripInner{N: 1, S: "x"},
+		Ptr:     &roundTripInner{N: 2},
+		Inners:  []roundTripInner{{N: 3}, {S: "y"}},
+		Map:     map[string]int{"b": 2, "a": 1},
+		Nested:  map[string]*roundTripInner{"k": {N: 4}},
+		Big:     huge,
+		Raw:     RawMessage("li1ee"),
+		Renamed: 5,
+	}
+	tests := []struct {
+		name string
+		in   interface{}
+		out  func() interface{}
+	}{
+		{"int", int64(-42), func() interface{} { return new(int64) }},
+		{"uint", uint32(math.MaxUint32), func() interface{} { return new(uint32) }},
+		{"string", "hello world", func() interface{} { return new(string) }},
+		{"empty string", "", func() interface{} { return new(string) }},
+		{"bytes", []byte("\x00\xffbinary"), func() interface{} { return new([]byte) }},
+		{"list", []interface{}{int64(1), "two", []interface{}{}}, func() interface{} { return new([]interface{}) }},
+		{"dict", map[string]interface{}{"a": int64(1), "b": map[string]interface{}{}}, func() interface{} { return new(map[string]interface{}) }},
+		{"struct", full, func() interface{} { return new(roundTripStruct) }},
+		{"zero struct", roundTripStruct{Raw: RawMessage("0:")}, func() interface{} { return new(roundTripStruct) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := Marshal(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !Valid(b) {
+				t.Fatalf("Marshal = %q, which is not valid", b)
+			}
+			for _, unmarshal := range []func([]byte, interface{}) error{Unmarshal, UnmarshalZeroCopy, UnmarshalInterned} {
+				out := tt.out()
+				if err = unmarshal(b, out); err != nil {
+					t.Fatal(err)
+				}
+				got := reflect.ValueOf(out).Elem().Interface()
+				if s, ok := got.(roundTripStruct); ok {
+					// Decoding leaves empty slices and maps non-nil.
+					b2, err := Marshal(s)
+					if err != nil || string(b2) != string(b) {
+						t.Fatalf("re-encoded as %q, %v, want %q", b2, err, b)
+					}
+					continue
+				}
+				if !reflect.DeepEqual(got, tt.in) {
+					t.Fatalf("got %#v, want %#v", got, tt.in)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeReusesSlices(t *testing.T) {
+	v := make([]roundTripInner, 1, 8)
+	v[0] = roundTripInner{N: 9, S: "old"}
+	backing := &v[:1][0]
+	if err := Unmarshal([]byte("ld1:ni1eed1:s1:yee"), &v); err != nil {
+		t.Fatal(err)
+	}
+	if &v[0] != backing {
+		t.Error("the capacity of the slice was not reused")
+	}
+	if !reflect.DeepEqual(v, []roundTripInner{{N: 1}, {S: "y"}}) {
+		t.Errorf("got %+v: reused elements were not zeroed", v)
+	}
+
+	// Slices grow past their capacity as needed.
+	var ints []int
+	if err := Unmarshal([]byte("l"+strings.Repeat("i7e", 100)+"e"), &ints); err != nil {
+		t.Fatal(err)
+	}
+	if len(ints) != 100 || ints[99] != 7 {
+		t.Errorf("got %d elements", len(ints))
+	}
+}
+
+func TestDecodeReadError(t *testing.T) {
+	errRead := errors.New("read failed")
+	dec := NewDecoder(io.MultiReader(strings.NewReader("d1:a"), errReader{errRead}))
+	var v map[string]string
+	if err := dec.Decode(&v); err == nil || !strings.Contains(err.Error(), errRead.Error()) {
+		t.Fatalf("Decode = %v, want the read error", err)
+	}
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+func TestDecodeDeclaredLengthBeyondInput(t *testing.T) {
+	// A stream cannot tell how much input is left: the length must not be
+	// allocated up front.
+	dec := NewDecoder(strings.NewReader("999999999999:abc"))
+	var s string
+	if err := dec.Decode(&s); err == nil {
+		t.Fatal("Decode of a truncated byte string succeeded")
+	}
+	if err := Unmarshal([]byte("999999999999:abc"), &s); err == nil {
+		t.Fatal("Unmarshal of a truncated byte string succeeded")
+	}
+}
+
+func TestDecodeErrorLocations(t *testing.T) {
+	type inner struct {
+		N int `bencode:"n"`
+	}
+	type outer struct {
+		List []inner `bencode:"list"`
+	}
+	tests := []struct {
+		name       string
+		in         string
+		v          interface{}
+		wantType   interface{}
+		wantOffset int64
+		wantPath   string
+	}{
+		{"type in list", "d4:listld1:ni1eed1:n1:xeee", new(outer), &UnmarshalTypeError{}, 23, "list.1.n"},
+		{"overflow", "d4:listld1:ni99999999999999999999eeee", new(outer), &UnmarshalTypeError{}, 34, "list.0.n"},
+		{"unknown value type", "d4:listld1:nx", new(outer), &SyntaxError{}, 12, "list.0.n"},
+		{"truncated", "d4:listld1:ni1", new(outer), &SyntaxError{}, 14, "list.0.n"},
+		{"missing value", "d4:liste", new(outer), &SyntaxError{}, 7, "list"},
+		{"top-level", "4:spam", new(int), &UnmarshalTypeError{}, 6, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Unmarshal([]byte(tt.in), tt.v)
+			var (
+				offset int64
+				path   Path
+			)
+			switch e := err.(type) {
+			case *SyntaxError:
+				offset, path = e.Offset, e.Path
+			case *UnmarshalTypeError:
+				offset, path = e.Offset, e.Path
+			}
+			if reflect.TypeOf(err) != reflect.TypeOf(tt.wantType) {
+				t.Fatalf("Unmarshal = %T %v, want a %T", err, err, tt.wantType)
+			}
+			if offset != tt.wantOffset || path.String() != tt.wantPath {
+				t.Fatalf("error at %d %q, want %d %q: %v", offset, path, tt.wantOffset, tt.wantPath, err)
+			}
+		})
+	}
+}
+
+func TestDecodeUnknownKeys(t *testing.T) {
+	type known struct {
+		A int `bencode:"a"`
+		C int `bencode:"c"`
+	}
+	in := "d1:ai1e1:bd1:xli1ei2eee1:ci3ee"
+	var v known
+	if err := Unmarshal([]byte(in), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v != (known{A: 1, C: 3}) {
+		t.Fatalf("got %+v", v)
+	}
+
+	dec := NewDecoder(strings.NewReader(in))
+	dec.SetDisallowUnknownKeys(true)
+	if err := dec.Decode(&v); err == nil {
+		t.Fatal("unknown key accepted")
+	}
+}
+
+func TestDecodePartial(t *testing.T) {
+	var v struct {
+		A int      `bencode:"a"`
+		B []string `bencode:"b"`
+		C int      `bencode:"c"`
+	}
+	err := Unmarshal([]byte("d1:ai1e1:bl1:x1:yi2ee1:ci3ee"), &v)
+	if err == nil {
+		t.Fatal("decoded an integer into a string")
+	}
+	if v.A != 1 || !reflect.DeepEqual(v.B[:2], []string{"x", "y"}) || v.C != 0 {
+		t.Fatalf("got %+v, want what was decoded before the error", v)
+	}
+}
+
+func TestDecoderStream(t *testing.T) {
+	dec := NewDecoder(strings.NewReader("i1e4:spamd1:ai2ee1:x i4e"))
+	var (
+		n int
+		s string
+		m map[string]int
+	)
+	if err := dec.Decode(&n); err != nil || n != 1 {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if err := dec.Decode(&s); err != nil || s != "spam" {
+		t.Fatalf("got %q, %v", s, err)
+	}
+	if err := dec.Decode(&m); err != nil || m["a"] != 2 {
+		t.Fatalf("got %v, %v", m, err)
+	}
+	if off := dec.InputOffset(); off != 17 {
+		t.Fatalf("InputOffset = %d, want 17", off)
+	}
+	// A value of the wrong type can be skipped.
+	if err := dec.Decode(&n); err == nil || !dec.CanResync() {
+		t.Fatalf("Decode = %v, CanResync = %v", err, dec.CanResync())
+	}
+	if err := dec.Resync(); err != nil {
+		t.Fatal(err)
+	}
+	// Malformed input cannot.
+	if err := dec.Decode(&n); err == nil || dec.CanResync() {
+		t.Fatalf("Decode = %v, CanResync = %v", err, dec.CanResync())
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     string
+		limits Limits
+		want   error
+	}{
+		{"depth", "llleee", Limits{MaxDepth: 2}, ErrDepthExceeded},
+		{"depth ok", "llee", Limits{MaxDepth: 2}, nil},
+		{"default depth", strings.Repeat("l", maxNestingDepth+1) + strings.Repeat("e", maxNestingDepth+1), Limits{}, ErrDepthExceeded},
+		{"string", "5:hello", Limits{MaxStringLen: 4}, ErrStringTooLong},
+		{"string ok", "4:hell", Limits{MaxStringLen: 4}, nil},
+		{"integer", "i12345e", Limits{MaxIntDigits: 4}, ErrIntegerTooLong},
+		{"negative integer ok", "i-1234e", Limits{MaxIntDigits: 4}, nil},
+		{"default integer", "i" + strings.Repeat("1", maxIntegerDigits+1) + "e", Limits{}, ErrIntegerTooLong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec := NewDecoder(strings.NewReader(tt.in))
+			dec.SetLimits(tt.limits)
+			var v interface{}
+			err := dec.Decode(&v)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Decode: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Decode = %v, want %v", err, tt.want)
+			}
+			var se *SyntaxError
+			if !errors.As(err, &se) {
+				t.Fatalf("Decode = %T, want a *SyntaxError", err)
+			}
+			if err = tt.limits.Check([]byte(tt.in)); !errors.Is(err, tt.want) {
+				t.Fatalf("Check = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalTypeErrorKey(t *testing.T) {
+	var v struct {
+		List []int          `bencode:"list"`
+		Map  map[string]int `bencode:"map"`
+	}
+	tests := []struct {
+		in      string
+		key     string
+		offset  int64
+		message string
+	}{
+		{"d4:listli1e1:xee", "", 14, "bencode: cannot unmarshal a bencode string into a int at list.1 (Offset: 14)"},
+		{"d3:mapd1:k1:vee", "k", 13, "bencode: cannot unmarshal a bencode string into a int at map.k (Offset: 13)"},
+		{"d4:list1:xe", "list", 10, "bencode: cannot unmarshal a bencode string into a []int at list (Offset: 10)"},
+	}
+	for _, tt := range tests {
+		err := Unmarshal([]byte(tt.in), &v)
+		var te *UnmarshalTypeError
+		if !errors.As(err, &te) {
+			t.Fatalf("%q: got %v, want an *UnmarshalTypeError", tt.in, err)
+		}
+		if te.Key != tt.key || te.Offset != tt.offset || te.Error() != tt.message {
+			t.Errorf("%q: got key %q, offset %d, %q; want %q, %d, %q", tt.in, te.Key, te.Offset, te.Error(), tt.key, tt.offset, tt.message)
+		}
+	}
+}
+
+func TestUnknownKeyError(t *testing.T) {
+	type inner struct {
+		A int `bencode:"a"`
+	}
+	var v struct {
+		Inner inner `bencode:"inner"`
+	}
+	dec := NewDecoder(strings.NewReader("d5:innerd1:ai1e7:unknowni2eee"))
+	dec.SetDisallowUnknownKeys(true)
+	err := dec.Decode(&v)
+	var ke *UnknownKeyError
+	if !errors.As(err, &ke) {
+		t.Fatalf("Decode = %v, want an *UnknownKeyError", err)
+	}
+	if ke.Key != "unknown" || ke.Offset != 15 || ke.Path.String() != "inner.unknown" || ke.Type != reflect.TypeOf(inner{}) {
+		t.Fatalf("got %+v", ke)
+	}
+	if want := `bencode: bencode.inner has no exported field for the key "unknown" at inner.unknown (Offset: 15)`; err.Error() != want {
+		t.Fatalf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestDecodeNonStringMapKeys(t *testing.T) {
+	var te *UnmarshalTypeError
+	var m map[int]int
+	if err := Unmarshal([]byte("d1:1i1ee"), &m); !errors.As(err, &te) {
+		t.Fatalf("Unmarshal into map[int]int = %v, want an *UnmarshalTypeError", err)
+	}
+	if _, err := Decode[map[int]int]([]byte("d1:1i1ee")); !errors.As(err, &te) {
+		t.Fatalf("Decode[map[int]int] = %v, want an *UnmarshalTypeError", err)
+	}
+}
+
+func TestDecodePointerChains(t *testing.T) {
+	var n **int
+	if err := Unmarshal([]byte("i42e"), &n); err != nil || n == nil || *n == nil || **n != 42 {
+		t.Fatalf("Unmarshal into **int = %v, want 42", err)
+	}
+	var b **big.Int
+	if err := Unmarshal([]byte("i123456789012345678901234567890e"), &b); err != nil || b == nil || *b == nil ||
+		(*b).String() != "123456789012345678901234567890" {
+		t.Fatalf("Unmarshal into **big.Int = %v, want the integer", err)
+	}
+	var v struct {
+		N **int `bencode:"n"`
+	}
+	if err := Unmarshal([]byte("d1:ni7ee"), &v); err != nil || **v.N != 7 {
+		t.Fatalf("Unmarshal into a **int field = %v, want 7", err)
+	}
+}
+
+func TestDepthErrorMessage(t *testing.T) {
+	in := strings.Repeat("l", maxNestingDepth+1) + strings.Repeat("e", maxNestingDepth+1)
+	var v interface{}
+	err := Unmarshal([]byte(in), &v)
+	var se *SyntaxError
+	if !errors.As(err, &se) || len(se.Path) < maxNestingDepth-1 {
+		t.Fatalf("Unmarshal = %v, want a *SyntaxError with the whole path", err)
+	}
+	want := fmt.Sprintf("0.0.0.0.<%d more>.0.0.0.0", len(se.Path)-8)
+	if msg := err.Error(); len(msg) > 200 || !strings.Contains(msg, want) {
+		t.Fatalf("Error() = %q, want the path shortened to %q", msg, want)
+	}
+}
+
+func TestSyntaxErrorExcerpt(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", "bencode: syntax error (Offset: 0): unexpected EOF"},
+		{"i1ex", "bencode: syntax error (Offset: 3): trailing data after top-level value near 69 31 65 >78 |i1ex|"},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.in))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("Parse(%q) = %v, want %q", tt.in, err, tt.want)
+		}
+	}
+}
+
+func TestTrailingData(t *testing.T) {
+	in := []byte("i1egarbage")
+	var n int
+	if err := Unmarshal(in, &n); err != nil || n != 1 {
+		t.Fatalf("Unmarshal = %d, %v; want 1 and the rest ignored", n, err)
+	}
+	checks := map[string]func() error{
+		"Parse":         func() error { _, err := Parse(in); return err },
+		"ParseLazyDict": func() error { _, err := ParseLazyDict([]byte("de1:x")); return err },
+		"Check":         func() error { return Limits{}.Check(in) },
+		"Walk":          func() error { return Walk(in, func(Path, Value) error { return nil }) },
+	}
+	for name, check := range checks {
+		var se *SyntaxError
+		if err := check(); !errors.Is(err, ErrTrailingData) || !errors.As(err, &se) {
+			t.Errorf("%s = %v, want a *SyntaxError wrapping ErrTrailingData", name, err)
+		}
+	}
+}
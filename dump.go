@@ -0,0 +1,220 @@
+package bencode
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode/utf8"
+)
+
+// DumpOptions tunes the output of Dump.
+type DumpOptions struct {
+	// Indent is written once per nesting level; two spaces if empty.
+	Indent string
+	// MaxBytes is the number of bytes of a byte string shown before the rest
+	// is cut: 64 if zero, and no limit if negative.
+	MaxBytes int
+}
+
+// Dump writes the bencode value in data to w in a readable form, one list
+// element or dict entry per line, for debugging. Integers are written in
+// decimal, byte strings holding text are quoted, and binary ones, such as
+// hashes, are written as their length and hex digits, like <20 bytes: 0a1b...>.
+// Long byte strings are cut as opts tells.
+func Dump(data []byte, w io.Writer, opts DumpOptions) error {
+	v, err := Parse(data)
+	if err != nil {
+		return err
+	}
+	if opts.Indent == "" {
+		opts.Indent = "  "
+	}
+	if opts.MaxBytes == 0 {
+		opts.MaxBytes = 64
+	}
+	b := opts.appendValue(nil, v, 0)
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+func (o DumpOptions) appendValue(b []byte, v Value, depth int) []byte {
+	switch v.Kind() {
+	case IntegerKind:
+		return append(b, v.str...)
+	case StringKind:
+		return o.appendString(b, v.Bytes())
+	case ListKind:
+		if v.Len() == 0 {
+			return append(b, "[]"...)
+		}
+		b = append(b, '[')
+		for _, e := range v.List() {
+			b = o.appendNewline(b, depth+1)
+			b = o.appendValue(b, e, depth+1)
+		}
+		b = o.appendNewline(b, depth)
+		return append(b, ']')
+	default:
+		if v.Len() == 0 {
+			return append(b, "{}"...)
+		}
+		b = append(b, '{')
+		for i, k := range v.Keys() {
+			b = o.appendNewline(b, depth+1)
+			b = o.appendString(b, []byte(k))
+			b = append(b, ": "...)
+			b = o.appendValue(b, v.list[i], depth+1)
+		}
+		b = o.appendNewline(b, depth)
+		return append(b, '}')
+	}
+}
+
+func (o DumpOptions) appendNewline(b []byte, depth int) []byte {
+	b = append(b, '\n')
+	for i := 0; i < depth; i++ {
+		b = append(b, o.Indent...)
+	}
+	return b
+}
+
+// appendString appends s quoted if it is text, or in hex, cut to MaxBytes.
+func (o DumpOptions) appendString(b, s []byte) []byte {
+	cut := s
+	if o.MaxBytes >= 0 && len(s) > o.MaxBytes {
+		cut = s[:o.MaxBytes]
+	}
+	if isText(s) {
+		for len(cut) < len(s) && !utf8.RuneStart(s[len(cut)]) {
+			cut = cut[:len(cut)-1]
+		}
+		b = strconv.AppendQuote(b, string(cut))
+		if len(cut) < len(s) {
+			b = append(b, "... ("...)
+			b = strconv.AppendInt(b, int64(len(s)), 10)
+			b = append(b, " bytes)"...)
+		}
+		return b
+	}
+	b = append(b, '<')
+	b = strconv.AppendInt(b, int64(len(s)), 10)
+	b = append(b, " bytes: "...)
+	n := len(b)
+	b = append(b, make([]byte, hex.EncodedLen(len(cut)))...)
+	hex.Encode(b[n:], cut)
+	if len(cut) < len(s) {
+		b = append(b, "..."...)
+	}
+	return append(b, '>')
+}
+
+// isText reports whether s is UTF-8 without control characters other than
+// tabs and line breaks.
+func isText(s []byte) bool {
+	if !utf8.Valid(s) {
+		return false
+	}
+	for _, c := range s {
+		if c < ' ' && c != '\t' && c != '\n' && c != '\r' || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// HexDump writes the bytes of data to w in hex and ASCII, 16 per line like
+// hexdump -C, with every token on lines of its own annotated with its kind
+// and path:
+//
+//	00000000  64                                               |d|                dict
+//	00000001  34 3a 69 6e 66 6f                                |4:info|           key     info
+//	00000007  64                                               |d|                dict    info
+//
+// It is meant to spot byte-level differences between encoders. Malformed
+// input is dumped up to the error, which is written on the line of the bytes
+// left and returned.
+func HexDump(data []byte, w io.Writer) error {
+	type frame struct{ dict, key bool } // key: a dict expecting a key
+	var (
+		bw     = bufio.NewWriter(w)
+		dec    = NewDecoder(bytes.NewBuffer(data))
+		path   Path
+		frames []frame
+		index  []int // index of the next element of each open list
+	)
+	dec.SetZeroCopy(true)
+	for {
+		start := dec.InputOffset()
+		t, err := dec.ReadToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			hexDumpLines(bw, data[start:], start, "error", err.Error())
+			if ferr := bw.Flush(); ferr != nil {
+				return ferr
+			}
+			return err
+		}
+		raw := data[start:dec.InputOffset()]
+		n := len(frames)
+		switch {
+		case t.Kind == TokenEnd:
+			frames, index = frames[:n-1], index[:n-1]
+			hexDumpLines(bw, raw, start, "end", path.String())
+		case n > 0 && frames[n-1].key:
+			frames[n-1].key = false
+			path = append(path, PathElem{Key: string(t.Data)})
+			hexDumpLines(bw, raw, start, "key", path.String())
+			continue
+		default:
+			if n > 0 && !frames[n-1].dict {
+				path = append(path, PathElem{Index: index[n-1], IsIndex: true})
+				index[n-1]++
+			}
+			hexDumpLines(bw, raw, start, t.Kind.String(), path.String())
+			if t.Kind == TokenList || t.Kind == TokenDict {
+				frames = append(frames, frame{dict: t.Kind == TokenDict, key: t.Kind == TokenDict})
+				index = append(index, 0)
+				continue
+			}
+		}
+		// A value has ended: leave its path element.
+		if n := len(frames); n > 0 {
+			path = path[:len(path)-1]
+			frames[n-1].key = frames[n-1].dict
+		}
+	}
+	return bw.Flush()
+}
+
+// hexDumpLines writes raw, found at offset, 16 bytes per line, annotating the
+// first line with kind and path.
+func hexDumpLines(w *bufio.Writer, raw []byte, offset int64, kind, path string) {
+	for i := 0; i == 0 || i < len(raw); i += 16 {
+		line := raw[i:]
+		if len(line) > 16 {
+			line = line[:16]
+		}
+		var hx, ascii []byte
+		for j, c := range line {
+			if j > 0 {
+				hx = append(hx, ' ')
+			}
+			hx = append(hx, "0123456789abcdef"[c>>4], "0123456789abcdef"[c&0xf])
+			if c < ' ' || c > '~' {
+				c = '.'
+			}
+			ascii = append(ascii, c)
+		}
+		if i > 0 {
+			fmt.Fprintf(w, "%08x  %-47s  |%s|\n", offset+int64(i), hx, ascii)
+			continue
+		}
+		line = []byte(fmt.Sprintf("%08x  %-47s  %-18s %-7s %s", offset, hx, "|"+string(ascii)+"|", kind, path))
+		w.Write(append(bytes.TrimRight(line, " "), '\n'))
+	}
+}
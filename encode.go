@@ -2,29 +2,215 @@ package bencode
 
 import (
 	"bytes"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
 	"math/big"
 	"reflect"
 	"sort"
 	"strconv"
 	"sync"
+	"unsafe"
 )
 
+// Marshal returns the bencode encoding of v.
+//
+// Slices and arrays of bytes, such as a [20]byte infohash or node ID, encode
+// as byte strings, and other slices and arrays as lists. Values implementing
+// Marshaler encode as what their MarshalBencode returns, which must be a
+// single valid bencode value.
 func Marshal(v interface{}) ([]byte, error) {
 	e := newEncodeState()
 	if err := e.marshal(v); err != nil {
+		encodeStatePool.Put(e)
 		return nil, err
 	}
-	buf := append([]byte(nil), e.Bytes()...)
+	buf := e.result()
 	encodeStatePool.Put(e)
 	return buf, nil
 }
 
+// detachSize is the output size from which the encoder's buffer is handed to
+// the caller instead of being copied out of it.
+const detachSize = 64 << 10
+
+// result returns the output for the caller to keep. Small outputs are copied,
+// so that the buffer returns to the pool with the encodeState; large ones take
+// the buffer along, saving the copy and keeping large buffers out of the pool.
+func (e *encodeState) result() []byte {
+	if e.Len() >= detachSize {
+		buf := e.Bytes()
+		e.Buffer = bytes.Buffer{}
+		return buf
+	}
+	return append([]byte(nil), e.Bytes()...)
+}
+
+// EncodeBuffer holds an encoding made by MarshalBuffer in memory borrowed
+// from the encoder's pool.
+type EncodeBuffer struct {
+	e *encodeState
+}
+
+// MarshalBuffer returns the bencode encoding of v without copying it out of
+// the encoder's buffer. The caller owns the result until it calls Release,
+// which makes the buffer available to later encodings.
+func MarshalBuffer(v interface{}) (*EncodeBuffer, error) {
+	e := newEncodeState()
+	if err := e.marshal(v); err != nil {
+		encodeStatePool.Put(e)
+		return nil, err
+	}
+	return &EncodeBuffer{e: e}, nil
+}
+
+// Bytes returns the encoding. It must not be used after Release.
+func (b *EncodeBuffer) Bytes() []byte {
+	return b.e.Bytes()
+}
+
+// Release returns the memory of b to the pool. It is safe to call twice.
+func (b *EncodeBuffer) Release() {
+	if b.e != nil {
+		encodeStatePool.Put(b.e)
+		b.e = nil
+	}
+}
+
+// MarshalAppend appends the bencode encoding of v to dst and returns the
+// extended buffer. On error, dst is returned unchanged in length, although
+// bytes past it in its capacity may have been overwritten.
+func MarshalAppend(dst []byte, v interface{}) ([]byte, error) {
+	e := newEncodeState()
+	pooled := e.Buffer
+	e.Buffer = *bytes.NewBuffer(dst)
+	err := e.marshal(v)
+	buf := e.Bytes()
+	e.Buffer = pooled
+	encodeStatePool.Put(e)
+	if err != nil {
+		return dst, err
+	}
+	return buf, nil
+}
+
+// MarshalTo writes the bencode encoding of v to w as it is produced, holding
+// only a small window of the output in memory instead of the whole document.
+// If an error occurs, part of the encoding may already have been written to w.
+func MarshalTo(w io.Writer, v interface{}) error {
+	e := newEncodeState()
+	defer encodeStatePool.Put(e)
+	e.out = w
+	if err := e.marshal(v); err != nil {
+		return err
+	}
+	_, err := w.Write(e.Bytes())
+	return err
+}
+
+// MarshalValue returns the bencode encoding of v without converting it to an interface{} first,
+// so that pointer-receiver Marshalers on addressable values are still honored.
+func MarshalValue(v reflect.Value) ([]byte, error) {
+	e := newEncodeState()
+	if err := e.marshalValue(v); err != nil {
+		encodeStatePool.Put(e)
+		return nil, err
+	}
+	buf := e.result()
+	encodeStatePool.Put(e)
+	return buf, nil
+}
+
+// An Encoder writes bencode values to an output stream.
+type Encoder struct {
+	w io.Writer
+	encOpts
+	// tokens holds the lists and dicts opened by WriteToken, and scratch
+	// the encoding of its tokens.
+	tokens  tokenStack
+	scratch []byte
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes the bencode encoding of v to the stream.
+func (enc *Encoder) Encode(v interface{}) error {
+	e := newEncodeState()
+	defer encodeStatePool.Put(e)
+	e.encOpts = enc.encOpts
+	if err := e.marshal(v); err != nil {
+		return err
+	}
+	if _, err := enc.w.Write(e.Bytes()); err != nil {
+		return err
+	}
+	enc.tokens.value()
+	return nil
+}
+
+// SetStringerFallback makes the encoder write values of otherwise unsupported types
+// that implement fmt.Stringer as the byte string returned by their String method.
+// Such values cannot be decoded back into their original type.
+func (enc *Encoder) SetStringerFallback(on bool) {
+	enc.stringerFallback = on
+}
+
+type encOpts struct {
+	// stringerFallback encodes unsupported fmt.Stringer values as byte strings.
+	stringerFallback bool
+}
+
 type encodeState struct {
 	bytes.Buffer
+	encOpts
 	scratch  [64]byte
 	ptrLevel uint
 	ptrSeen  map[interface{}]struct{}
+	// out, when set, receives the buffered output every time it reaches
+	// spillSize bytes; see MarshalTo.
+	out io.Writer
+}
+
+// spillSize is the amount of output buffered before it is written to out.
+const spillSize = 4 << 10
+
+// Write appends p to the buffer. When streaming, payloads larger than the
+// buffer go to out directly rather than through the buffer.
+func (e *encodeState) Write(p []byte) (int, error) {
+	if e.out != nil && len(p) >= spillSize {
+		if err := e.spill(0); err != nil {
+			return 0, err
+		}
+		return e.out.Write(p)
+	}
+	n, _ := e.Buffer.Write(p)
+	return n, e.spill(spillSize)
+}
+
+// WriteString appends s to the buffer, bypassing it for large strings like Write.
+func (e *encodeState) WriteString(s string) (int, error) {
+	if e.out != nil && len(s) >= spillSize {
+		if err := e.spill(0); err != nil {
+			return 0, err
+		}
+		return io.WriteString(e.out, s)
+	}
+	n, _ := e.Buffer.WriteString(s)
+	return n, e.spill(spillSize)
+}
+
+// spill writes the buffered output to out once it holds at least min bytes.
+func (e *encodeState) spill(min int) error {
+	if e.out == nil || e.Len() < min || e.Len() == 0 {
+		return nil
+	}
+	_, err := e.out.Write(e.Bytes())
+	e.Reset()
+	return err
 }
 
 // Marshaler is the interface implemented by types that
@@ -43,6 +229,8 @@ func newEncodeState() *encodeState {
 			panic("ptrEncoder.encode should have emptied ptrSeen via defers")
 		}
 		e.ptrLevel = 0
+		e.encOpts = encOpts{}
+		e.out = nil
 		return e
 	}
 	return &encodeState{ptrSeen: make(map[interface{}]struct{})}
@@ -53,29 +241,23 @@ func newEncodeState() *encodeState {
 // can distinguish intentional panics from this package.
 type bencodeError struct{ error }
 
-func (e *encodeState) marshal(v interface{}) (err error) {
-	// defer func() {
-	// 	if r := recover(); r != nil {
-	// 		if je, ok := r.(error); ok {
-	// 			err = je
-	// 		} else {
-	// 			panic(err)
-	// 		}
-	// 	}
-	// }()
-
-	return e.reflectValue(reflect.ValueOf(v))
+// marshalValue is reflectValue for the top-level value, recovering panics
+// like marshal.
+func (e *encodeState) marshalValue(v reflect.Value) (err error) {
+	defer recoverEncoding(&err)
+	return e.reflectValue(v)
 }
+
 func (e *encodeState) reflectValue(v reflect.Value) error {
 	if !v.IsValid() {
-		return fmt.Errorf("invalid Value Encoder")
+		return &UnsupportedValueError{Value: v, Str: "nil"}
 	}
 	return typeEncoder(v.Type())(e, v)
 }
 
 type encoderFunc func(e *encodeState, v reflect.Value) error
 
-var encoderCache sync.Map // map[reflect.Type]encoderFunc
+var encoderCache typeCache // map[reflect.Type]encoderFunc
 
 func typeEncoder(t reflect.Type) encoderFunc {
 	if fi, ok := encoderCache.Load(t); ok {
@@ -110,15 +292,23 @@ var marshalerType = reflect.TypeOf(func() *Marshaler {
 
 var bigIntType = reflect.TypeOf(big.Int{})
 
+var jsonNumberType = reflect.TypeOf(json.Number(""))
+
 // newTypeEncoder constructs an encoderFunc for a type.
 // The returned encoder only checks CanAddr when allowAddr is true.
 func newTypeEncoder(t reflect.Type) encoderFunc {
+	if f, ok := registeredEncoder(t); ok {
+		return f
+	}
 	if t.Implements(marshalerType) || (t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(marshalerType)) {
 		return marshalerEncoder
 	}
 	if t == bigIntType {
 		return bigIntEncoder
 	}
+	if t == jsonNumberType {
+		return jsonNumberEncoder
+	}
 
 	switch t.Kind() {
 	case reflect.Bool:
@@ -132,15 +322,26 @@ func newTypeEncoder(t reflect.Type) encoderFunc {
 	case reflect.Interface:
 		return interfaceEncoder
 	case reflect.Struct:
-		return newStructEncoder
+		return newStructEncoder(t)
 	case reflect.Map:
 		return newMapEncoder
 	case reflect.Slice:
+		if f, ok := primitiveSliceEncoder(t); ok {
+			return f
+		}
 		return newSliceEncoder
 	case reflect.Array:
 		return newArrayEncoder
 	case reflect.Ptr:
 		return newPtrEncoder
+	case reflect.Func:
+		if isSeqType(t) {
+			return seqEncoder
+		}
+		if isSeq2Type(t) {
+			return seq2Encoder
+		}
+		return unsupportedTypeEncoder
 	default:
 		return unsupportedTypeEncoder
 	}
@@ -150,14 +351,14 @@ func marshalerEncoder(e *encodeState, v reflect.Value) error {
 		v = v.Addr()
 	}
 	if v.Kind() == reflect.Ptr && v.IsNil() {
-		return fmt.Errorf("ptr is nil")
+		return &UnsupportedValueError{Value: v, Str: "nil " + v.Type().String()}
 	}
 
 	m, ok := v.Interface().(Marshaler)
 	if !ok {
-		return fmt.Errorf("reflect.Value.Addr of unaddressable value: %s", v.Type())
+		return newError("reflect.Value.Addr of unaddressable value: %s", v.Type())
 	}
-	b, err := m.MarshalBencode()
+	b, err := callMarshaler(m)
 	if err != nil {
 		return err
 	}
@@ -165,6 +366,27 @@ func marshalerEncoder(e *encodeState, v reflect.Value) error {
 	return err
 }
 
+// callMarshaler returns the encoding of m, checked to be valid unless m is a
+// RawMessage, which checks itself. A panic of the method is returned as its
+// error.
+func callMarshaler(m Marshaler) (b []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			b, err = nil, &MarshalerError{Type: reflect.TypeOf(m), Err: fmt.Errorf("panic: %v", r), sourceFunc: "MarshalBencode"}
+		}
+	}()
+	b, err = m.MarshalBencode()
+	if err == nil {
+		if _, ok := m.(RawMessage); !ok {
+			err = checkValid(b)
+		}
+	}
+	if err != nil {
+		return nil, &MarshalerError{Type: reflect.TypeOf(m), Err: err, sourceFunc: "MarshalBencode"}
+	}
+	return b, nil
+}
+
 func bigIntEncoder(e *encodeState, v reflect.Value) error {
 	if _, err := e.WriteString("i"); err != nil {
 		return err
@@ -178,6 +400,19 @@ func bigIntEncoder(e *encodeState, v reflect.Value) error {
 	}
 	return nil
 }
+
+// jsonNumberEncoder writes an integral json.Number as a bencode integer and
+// anything else (fractions, exponents) as a byte string, since bencode has no floats.
+func jsonNumberEncoder(e *encodeState, v reflect.Value) error {
+	bi, ok := new(big.Int).SetString(v.String(), 10)
+	if !ok {
+		return stringEncoder(e, v)
+	}
+	b := append(e.scratch[:0], 'i')
+	b = bi.Append(b, 10)
+	_, err := e.Write(append(b, 'e'))
+	return err
+}
 func boolEncoder(e *encodeState, v reflect.Value) (err error) {
 	if v.Bool() {
 		_, err = e.WriteString("i1e")
@@ -211,34 +446,88 @@ func uintEncoder(e *encodeState, v reflect.Value) error {
 	return nil
 }
 func stringEncoder(e *encodeState, v reflect.Value) error {
-	if _, err := e.Write(strconv.AppendInt(e.scratch[:0], int64(len(v.String())), 10)); err != nil {
-		return err
-	}
-	if _, err := e.WriteString(":" + v.String()); err != nil {
+	return e.writeString(v.String())
+}
+
+// writeString writes s as a byte string.
+func (e *encodeState) writeString(s string) error {
+	if err := e.writeStringHeader(len(s)); err != nil {
 		return err
 	}
-	return nil
+	_, err := e.WriteString(s)
+	return err
+}
+
+// writeInt writes n as an integer, formatted in the scratch buffer.
+func (e *encodeState) writeInt(n int64) error {
+	b := append(e.scratch[:0], 'i')
+	b = strconv.AppendInt(b, n, 10)
+	_, err := e.Write(append(b, 'e'))
+	return err
+}
+
+// writeUint is writeInt for unsigned integers.
+func (e *encodeState) writeUint(n uint64) error {
+	b := append(e.scratch[:0], 'i')
+	b = strconv.AppendUint(b, n, 10)
+	_, err := e.Write(append(b, 'e'))
+	return err
 }
+
+// writeStringHeader writes the length prefix of a byte string of n bytes,
+// formatted in the scratch buffer so that it costs no allocation.
+func (e *encodeState) writeStringHeader(n int) error {
+	b := strconv.AppendInt(e.scratch[:0], int64(n), 10)
+	_, err := e.Write(append(b, ':'))
+	return err
+}
+
 func interfaceEncoder(e *encodeState, v reflect.Value) error {
+	if v.IsNil() {
+		return &UnsupportedValueError{Value: v, Str: "nil " + v.Type().String()}
+	}
 	return e.reflectValue(v.Elem())
 }
-func newStructEncoder(e *encodeState, v reflect.Value) error {
+
+// structEncoder encodes a struct type with the encoders of its fields
+// resolved once, when the type's encoder is built.
+type structEncoder struct {
+	fields []encodeStructField
+	encs   []encoderFunc
+}
+
+func newStructEncoder(t reflect.Type) encoderFunc {
+	se := structEncoder{fields: cachedTypeFields(t)}
+	se.encs = make([]encoderFunc, len(se.fields))
+	for i, ef := range se.fields {
+		switch {
+		case ef.set:
+			se.encs[i] = setEncoder
+		case ef.hex:
+			se.encs[i] = hexEncoder
+		case ef.runes:
+			se.encs[i] = runesEncoder
+		default:
+			se.encs[i] = typeEncoder(t.Field(ef.i).Type)
+		}
+	}
+	return se.encode
+}
+
+func (se structEncoder) encode(e *encodeState, v reflect.Value) error {
 	if _, err := e.WriteString("d"); err != nil {
 		return err
 	}
-	for _, ef := range cachedTypeFields(v.Type()) {
+	for i, ef := range se.fields {
 		fieldValue := v.Field(ef.i)
-		if ef.omitEmpty && isEmptyValue(fieldValue) {
+		if ef.omitEmpty && isEmptyValue(fieldValue) || isNilInterface(fieldValue) {
 			continue
 		}
-		if _, err := e.Write(strconv.AppendInt(e.scratch[:0], int64(len(ef.tag)), 10)); err != nil {
-			return err
-		}
-		if _, err := e.WriteString(":" + ef.tag); err != nil {
+		if _, err := e.WriteString(ef.encodedKey); err != nil {
 			return err
 		}
-		if err := e.reflectValue(fieldValue); err != nil {
-			return err
+		if err := se.encs[i](e, fieldValue); err != nil {
+			return atElem(err, PathElem{Key: ef.tag})
 		}
 	}
 	if _, err := e.WriteString("e"); err != nil {
@@ -255,16 +544,44 @@ func newMapEncoder(e *encodeState, v reflect.Value) error {
 		_, err := e.WriteString("de")
 		return err
 	}
+	if err := e.enterRef(v); err != nil {
+		return err
+	}
+	defer e.leaveRef(v)
 	if _, err := e.WriteString("d"); err != nil {
 		return err
 	}
-	sv := stringValues(v.MapKeys())
-	sort.Sort(sv)
-	for _, key := range sv {
-		if err := stringEncoder(e, key); err != nil {
+	keys := sortedMapKeys(v)
+	defer releaseMapKeys(keys)
+	for _, kv := range *keys {
+		if isNilInterface(kv.value) {
+			continue
+		}
+		if err := e.writeString(kv.key); err != nil {
 			return err
 		}
-		if err := e.reflectValue(v.MapIndex(key)); err != nil {
+		if err := e.reflectValue(kv.value); err != nil {
+			return atElem(err, PathElem{Key: kv.key})
+		}
+	}
+	if _, err := e.WriteString("e"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// setEncoder writes a map[string]struct{} as a sorted list of its keys.
+func setEncoder(e *encodeState, v reflect.Value) error {
+	if v.Kind() != reflect.Map || !isSetType(v.Type()) {
+		return unsupportedTypeEncoder(e, v)
+	}
+	if _, err := e.WriteString("l"); err != nil {
+		return err
+	}
+	keys := sortedMapKeys(v)
+	defer releaseMapKeys(keys)
+	for _, kv := range *keys {
+		if err := e.writeString(kv.key); err != nil {
 			return err
 		}
 	}
@@ -274,33 +591,58 @@ func newMapEncoder(e *encodeState, v reflect.Value) error {
 	return nil
 }
 
+// hexEncoder writes a []byte or [N]byte as a lowercase hex byte string.
+func hexEncoder(e *encodeState, v reflect.Value) error {
+	if (v.Kind() != reflect.Slice && v.Kind() != reflect.Array) || v.Type().Elem().Kind() != reflect.Uint8 {
+		return unsupportedTypeEncoder(e, v)
+	}
+	b := make([]byte, v.Len())
+	reflect.Copy(reflect.ValueOf(b), v)
+	return stringEncoder(e, reflect.ValueOf(hex.EncodeToString(b)))
+}
+
 func newSliceEncoder(e *encodeState, v reflect.Value) error {
 	if v.Type().Elem().Kind() == reflect.Uint8 {
 		s := v.Bytes()
-		_, err := e.Write(strconv.AppendInt(e.scratch[:0], int64(len(s)), 10))
-		if err != nil {
-			return err
-		}
-		if _, err = e.WriteString(":"); err != nil {
+		if err := e.writeStringHeader(len(s)); err != nil {
 			return err
 		}
-		_, err = e.Write(s)
+		_, err := e.Write(s)
 		return err
 	}
 	if v.IsNil() {
 		_, err := e.WriteString("le")
 		return err
 	}
-
+	if err := e.enterRef(v); err != nil {
+		return err
+	}
+	defer e.leaveRef(v)
 	return newArrayEncoder(e, v)
 }
+
+// runesEncoder writes a []rune or []int32 field tagged utf8 as its UTF-8 byte
+// string rather than a list of integers. Elements that are not valid code
+// points are written as U+FFFD.
+func runesEncoder(e *encodeState, v reflect.Value) error {
+	r := make([]rune, v.Len())
+	for i := range r {
+		r[i] = rune(v.Index(i).Int())
+	}
+	return stringEncoder(e, reflect.ValueOf(string(r)))
+}
 func newArrayEncoder(e *encodeState, v reflect.Value) error {
+	if v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8 {
+		b := make([]byte, v.Len())
+		reflect.Copy(reflect.ValueOf(b), v)
+		return newSliceEncoder(e, reflect.ValueOf(b))
+	}
 	if _, err := e.WriteString("l"); err != nil {
 		return err
 	}
 	for i, j := 0, v.Len(); i < j; i++ {
 		if err := e.reflectValue(v.Index(i)); err != nil {
-			return err
+			return atElem(err, PathElem{Index: i, IsIndex: true})
 		}
 	}
 
@@ -310,25 +652,142 @@ func newArrayEncoder(e *encodeState, v reflect.Value) error {
 	return nil
 }
 func newPtrEncoder(e *encodeState, v reflect.Value) error {
+	// A nil pointer is encoded as the zero value it points to, which for a
+	// recursive type holds nil pointers of the same type: as they share the
+	// nil address, enterRef catches that too.
+	if err := e.enterRef(v); err != nil {
+		return err
+	}
+	defer e.leaveRef(v)
 	if v.IsNil() {
-		v = reflect.Zero(v.Type().Elem())
-	} else {
-		v = v.Elem()
+		return e.reflectValue(reflect.Zero(v.Type().Elem()))
 	}
-	return e.reflectValue(v)
+	return e.reflectValue(v.Elem())
+}
+
+// startDetectingCyclesAfter is the nesting of pointers, maps and slices from
+// which the encoder checks for cycles, which would otherwise recurse until the
+// stack overflows. Checking costs too much to be done for every value.
+const startDetectingCyclesAfter = 1000
+
+// enterRef accounts for the encoder following the pointer, map or slice v,
+// failing if it is already being encoded. leaveRef undoes it.
+func (e *encodeState) enterRef(v reflect.Value) error {
+	if e.ptrLevel++; e.ptrLevel > startDetectingCyclesAfter {
+		key := refKey(v)
+		if _, ok := e.ptrSeen[key]; ok {
+			e.ptrLevel--
+			return &UnsupportedValueError{Value: v, Str: fmt.Sprintf("encountered a cycle via %s", v.Type())}
+		}
+		e.ptrSeen[key] = struct{}{}
+	}
+	return nil
 }
-func unsupportedTypeEncoder(_ *encodeState, v reflect.Value) error {
-	return fmt.Errorf("unsupported type: %s", v.Type())
+
+func (e *encodeState) leaveRef(v reflect.Value) {
+	if e.ptrLevel > startDetectingCyclesAfter {
+		delete(e.ptrSeen, refKey(v))
+	}
+	e.ptrLevel--
 }
 
-// error aborts the encoding by panicking with err wrapped in jsonError.
+// refKey identifies what the pointer, map or slice v refers to. The type is
+// part of it, as a struct and its first field share their address, and so is
+// the length of a slice, as the sub-slices of an array do not refer to each
+// other.
+func refKey(v reflect.Value) interface{} {
+	type ref struct {
+		ptr unsafe.Pointer
+		t   reflect.Type
+		len int
+	}
+	if v.Kind() == reflect.Slice {
+		return ref{v.UnsafePointer(), v.Type(), v.Len()}
+	}
+	return ref{v.UnsafePointer(), v.Type(), 0}
+}
+func unsupportedTypeEncoder(e *encodeState, v reflect.Value) error {
+	if e.stringerFallback {
+		if v.Kind() != reflect.Ptr && v.CanAddr() {
+			if s, ok := v.Addr().Interface().(fmt.Stringer); ok {
+				return stringEncoder(e, reflect.ValueOf(s.String()))
+			}
+		}
+		if s, ok := v.Interface().(fmt.Stringer); ok {
+			return stringEncoder(e, reflect.ValueOf(s.String()))
+		}
+	}
+	return &UnsupportedTypeError{Type: v.Type()}
+}
+
+// error aborts the encoding by panicking with err wrapped in bencodeError.
 func (e *encodeState) error(err error) {
 	panic(bencodeError{err})
 }
 
-type stringValues []reflect.Value
+// recoverEncoding turns a panic raised while encoding into an error stored in
+// *err, so that the Marshal functions never panic, whatever the value: errors
+// raised by e.error are returned as they are, and other panics, such as those
+// of reflect on values it cannot handle, are wrapped.
+func recoverEncoding(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	switch x := r.(type) {
+	case bencodeError:
+		*err = x.error
+	case error:
+		*err = newError("panic while encoding: %w", x)
+	default:
+		*err = newError("panic while encoding: %v", x)
+	}
+}
+
+// mapKeyValue is an entry of a map being encoded, with its key extracted once.
+type mapKeyValue struct {
+	key   string
+	value reflect.Value
+}
+
+// mapKeys sorts map entries by key. It is used through a pointer, so that
+// neither sorting nor pooling it allocates.
+type mapKeys []mapKeyValue
+
+func (ks *mapKeys) Len() int           { return len(*ks) }
+func (ks *mapKeys) Swap(i, j int)      { (*ks)[i], (*ks)[j] = (*ks)[j], (*ks)[i] }
+func (ks *mapKeys) Less(i, j int) bool { return (*ks)[i].key < (*ks)[j].key }
 
-func (sv stringValues) Len() int           { return len(sv) }
-func (sv stringValues) Swap(i, j int)      { sv[i], sv[j] = sv[j], sv[i] }
-func (sv stringValues) Less(i, j int) bool { return sv.get(i) < sv.get(j) }
-func (sv stringValues) get(i int) string   { return sv[i].String() }
+// mapKeysPool holds the scratch slices of sortedMapKeys.
+var mapKeysPool = sync.Pool{New: func() interface{} { return new(mapKeys) }}
+
+// maxPooledMapKeys is the largest number of entries of a slice kept in
+// mapKeysPool, so that encoding one large map does not pin its size.
+const maxPooledMapKeys = 1 << 10
+
+// sortedMapKeys returns the entries of the string-keyed map v sorted by key,
+// in a slice taken from mapKeysPool that the caller returns with
+// releaseMapKeys once done with it.
+func sortedMapKeys(v reflect.Value) *mapKeys {
+	keys := mapKeysPool.Get().(*mapKeys)
+	*keys = (*keys)[:0]
+	for it := v.MapRange(); it.Next(); {
+		*keys = append(*keys, mapKeyValue{key: it.Key().String(), value: it.Value()})
+	}
+	sort.Sort(keys)
+	return keys
+}
+
+// releaseMapKeys returns keys to mapKeysPool, dropping the map entries it
+// refers to so that the pool does not keep them alive.
+func releaseMapKeys(keys *mapKeys) {
+	if cap(*keys) > maxPooledMapKeys {
+		return
+	}
+	all := (*keys)[:cap(*keys)]
+	for i := range all {
+		all[i] = mapKeyValue{}
+	}
+	*keys = all[:0]
+	mapKeysPool.Put(keys)
+}
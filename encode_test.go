@@ -0,0 +1,346 @@
+//go:build !bencode_lite
+
+package bencode
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRuneSliceRoundTrip(t *testing.T) {
+	type runes struct {
+		Ints  []int32 `bencode:"ints"`
+		Nil   []int32 `bencode:"nil"`
+		Text  []rune  `bencode:"text,utf8"`
+		Empty []rune  `bencode:"empty,utf8"`
+	}
+	tests := []struct {
+		name string
+		in   runes
+		want string
+	}{
+		{"lists of integers", runes{Ints: []int32{104, -1, 0x10ffff}}, "d5:empty0:4:intsli104ei-1ei1114111ee3:nille4:text0:e"},
+		{"utf8 tag", runes{Text: []rune("héllo, 世界")}, "d5:empty0:4:intsle3:nille4:text14:héllo, 世界e"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := Marshal(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Fatalf("Marshal = %q, want %q", b, tt.want)
+			}
+			var out runes
+			if err = Unmarshal(b, &out); err != nil {
+				t.Fatal(err)
+			}
+			if string(out.Text) != string(tt.in.Text) || !reflect.DeepEqual(out.Ints, tt.in.Ints) && len(tt.in.Ints) > 0 {
+				t.Fatalf("Unmarshal = %+v, want %+v", out, tt.in)
+			}
+		})
+	}
+
+	t.Run("invalid code points", func(t *testing.T) {
+		b, err := Marshal(runes{Text: []rune{'a', -1, 0xd800}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out runes
+		if err = Unmarshal(b, &out); err != nil {
+			t.Fatal(err)
+		}
+		if want := "a��"; string(out.Text) != want {
+			t.Fatalf("Text = %q, want %q", string(out.Text), want)
+		}
+	})
+}
+
+func TestEncodeJSONNumber(t *testing.T) {
+	tests := []struct {
+		in   json.Number
+		want string
+	}{
+		{"0", "i0e"},
+		{"-42", "i-42e"},
+		{"123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890", "i123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890e"},
+		{"1.5", "3:1.5"},
+	}
+	for _, tt := range tests {
+		b, err := Marshal(tt.in)
+		if err != nil {
+			t.Fatalf("Marshal(%q): %v", tt.in, err)
+		}
+		if string(b) != tt.want {
+			t.Errorf("Marshal(%q) = %q, want %q", tt.in, b, tt.want)
+		}
+	}
+}
+
+func TestByteArrayRoundTrip(t *testing.T) {
+	type node struct {
+		ID    [4]byte   `bencode:"id"`
+		Peers [][2]byte `bencode:"peers"`
+		Ints  [2]int    `bencode:"ints"`
+	}
+	in := node{ID: [4]byte{'a', 'b', 0, 0xff}, Peers: [][2]byte{{1, 2}, {3, 4}}, Ints: [2]int{5, 6}}
+	b, err := Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "d2:id4:ab\x00\xff4:intsli5ei6ee5:peersl2:\x01\x022:\x03\x04ee"; string(b) != want {
+		t.Fatalf("Marshal = %q, want %q", b, want)
+	}
+	var out node
+	if err = Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Fatalf("Unmarshal = %+v, want %+v", out, in)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	type inner struct {
+		B string `bencode:"b"`
+		A int    `bencode:"a"`
+	}
+	tests := []struct {
+		name string
+		in   interface{}
+		want string
+	}{
+		{"int", -7, "i-7e"},
+		{"uint", uint64(math.MaxUint64), "i18446744073709551615e"},
+		{"bool", true, "i1e"},
+		{"string", "spam", "4:spam"},
+		{"bytes", []byte{0, 'a'}, "2:\x00a"},
+		{"nil slice", []int(nil), "le"},
+		{"strings", []string{"a", "bc"}, "l1:a2:bce"},
+		{"int64s", []int64{1, -2}, "li1ei-2ee"},
+		{"blobs", [][]byte{{'x'}, nil}, "l1:x0:e"},
+		{"map keys sorted", map[string]int{"b": 2, "a": 1, "": 0, "aa": 3}, "d0:i0e1:ai1e2:aai3e1:bi2ee"},
+		{"struct fields sorted by key", inner{B: "x", A: 1}, "d1:ai1e1:b1:xe"},
+		{"omitempty", struct {
+			A int    `bencode:"a,omitempty"`
+			B string `bencode:"b,omitempty"`
+			C []int  `bencode:"c,omitempty"`
+		}{}, "de"},
+		{"pointer", &inner{}, "d1:ai0e1:b0:e"},
+		{"raw message", RawMessage("li1ee"), "li1ee"},
+		{"interface list", []interface{}{1, "a", map[string]interface{}{"k": []byte("v")}}, "li1e1:ad1:k1:vee"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := Marshal(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Fatalf("Marshal = %q, want %q", b, tt.want)
+			}
+			if b, err = MarshalAppend([]byte("prefix"), tt.in); err != nil || string(b) != "prefix"+tt.want {
+				t.Fatalf("MarshalAppend = %q, %v", b, err)
+			}
+			var w bytes.Buffer
+			if err = MarshalTo(&w, tt.in); err != nil || w.String() != tt.want {
+				t.Fatalf("MarshalTo = %q, %v", w.String(), err)
+			}
+			w.Reset()
+			if err = NewEncoder(&w).Encode(tt.in); err != nil || w.String() != tt.want {
+				t.Fatalf("Encode = %q, %v", w.String(), err)
+			}
+			buf, err := MarshalBuffer(tt.in)
+			if err != nil || string(buf.Bytes()) != tt.want {
+				t.Fatalf("MarshalBuffer = %q, %v", buf.Bytes(), err)
+			}
+			buf.Release()
+			buf.Release()
+		})
+	}
+}
+
+func TestMarshalLarge(t *testing.T) {
+	// Outputs past the size at which the buffer is handed over, and past the
+	// window MarshalTo holds, come out whole.
+	big := make([]string, 5000)
+	for i := range big {
+		big[i] = strings.Repeat("x", i%50)
+	}
+	b, err := Marshal(big)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) < detachSize {
+		t.Fatalf("output of %d bytes is too small for the test", len(b))
+	}
+	var back []string
+	if err = Unmarshal(b, &back); err != nil || !reflect.DeepEqual(back, big) {
+		t.Fatalf("round trip failed: %v", err)
+	}
+	var w bytes.Buffer
+	if err = MarshalTo(&w, big); err != nil || !bytes.Equal(w.Bytes(), b) {
+		t.Fatalf("MarshalTo differs from Marshal: %v", err)
+	}
+	again, err := Marshal(big)
+	if err != nil || !bytes.Equal(again, b) {
+		t.Fatal("the output of Marshal was reused")
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	type withChan struct {
+		C chan int `bencode:"c"`
+	}
+	type nested struct {
+		L []failingMarshaler `bencode:"l"`
+	}
+	tests := []struct {
+		name string
+		in   interface{}
+		want interface{}
+		path string
+	}{
+		{"float", 1.5, &UnsupportedTypeError{}, ""},
+		{"channel field", withChan{}, &UnsupportedTypeError{}, ""},
+		{"nil interface", []interface{}{nil}, &UnsupportedValueError{}, ""},
+		{"marshaler", nested{L: []failingMarshaler{{}}}, &MarshalerError{}, "l.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Marshal(tt.in)
+			if reflect.TypeOf(err) != reflect.TypeOf(tt.want) {
+				t.Fatalf("Marshal = %T %v, want a %T", err, err, tt.want)
+			}
+			if e, ok := err.(*MarshalerError); ok && e.Path.String() != tt.path {
+				t.Fatalf("Path = %q, want %q", e.Path, tt.path)
+			}
+		})
+	}
+}
+
+type failingMarshaler struct{}
+
+func (failingMarshaler) MarshalBencode() ([]byte, error) { return nil, errors.New("failed") }
+
+func TestMarshalSliceCycle(t *testing.T) {
+	s := make([]interface{}, 1)
+	s[0] = s
+	_, err := Marshal(s)
+	if _, ok := err.(*UnsupportedValueError); !ok {
+		t.Fatalf("Marshal = %T %v, want an *UnsupportedValueError", err, err)
+	}
+
+	// The same slice twice, not within itself, is no cycle.
+	shared := []int{1}
+	b, err := Marshal([][]int{shared, shared})
+	if err != nil || string(b) != "lli1eeli1eee" {
+		t.Fatalf("Marshal = %q, %v", b, err)
+	}
+}
+
+type panickingMarshaler struct{}
+
+func (panickingMarshaler) MarshalBencode() ([]byte, error) { panic("boom") }
+
+type cycleNode struct {
+	Next *cycleNode `bencode:"next"`
+}
+
+func TestMarshalRecoversPanics(t *testing.T) {
+	_, err := Marshal(map[string]interface{}{"m": panickingMarshaler{}})
+	var me *MarshalerError
+	if !errors.As(err, &me) {
+		t.Fatalf("Marshal = %T %v, want a *MarshalerError", err, err)
+	}
+	if me.Path.String() != "m" || me.Type != reflect.TypeOf(panickingMarshaler{}) || !strings.Contains(me.Err.Error(), "panic: boom") {
+		t.Fatalf("got %+v", me)
+	}
+
+	// A reflect panic, here raised by an encoder calling Int on a string,
+	// becomes an error as well.
+	type wrongKind string
+	RegisterTypeEncoder(reflect.TypeOf(wrongKind("")), func(v reflect.Value) ([]byte, error) {
+		return Marshal(v.Int())
+	})
+	defer func() {
+		typeEncoders.Delete(reflect.TypeOf(wrongKind("")))
+		ResetTypeCaches()
+	}()
+	_, err = Marshal([]wrongKind{"x"})
+	var ve *reflect.ValueError
+	if !errors.As(err, &ve) {
+		t.Fatalf("Marshal = %T %v, want a wrapped *reflect.ValueError", err, err)
+	}
+	var w bytes.Buffer
+	if err = NewEncoder(&w).Encode(wrongKind("x")); !errors.As(err, &ve) {
+		t.Fatalf("Encode = %T %v, want a wrapped *reflect.ValueError", err, err)
+	}
+}
+
+func TestMarshalCycles(t *testing.T) {
+	self := &cycleNode{}
+	self.Next = self
+	ring := &cycleNode{Next: &cycleNode{Next: &cycleNode{}}}
+	ring.Next.Next.Next = ring
+	m := map[string]interface{}{}
+	m["self"] = m
+	mp := map[string]*cycleNode{"a": self}
+	type recursive struct {
+		R *recursive `bencode:"r"`
+	}
+	tests := []struct {
+		name string
+		in   interface{}
+	}{
+		{"pointer", self},
+		{"ring of pointers", ring},
+		{"map", m},
+		{"map of pointers", mp},
+		{"recursive type", recursive{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Marshal(tt.in)
+			var ue *UnsupportedValueError
+			if !errors.As(err, &ue) {
+				t.Fatalf("Marshal = %T %v, want an *UnsupportedValueError", err, err)
+			}
+		})
+	}
+
+	// Deep nesting without a cycle is fine.
+	type list struct {
+		Next *list `bencode:"next,omitempty"`
+	}
+	var deep *list
+	for i := 0; i < 2*startDetectingCyclesAfter; i++ {
+		deep = &list{Next: deep}
+	}
+	b, err := Marshal(deep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back list
+	if err = Unmarshal(b, &back); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReleaseMapKeysDropsEntries(t *testing.T) {
+	keys := sortedMapKeys(reflect.ValueOf(map[string][]byte{"a": []byte("x"), "b": []byte("y")}))
+	if len(*keys) != 2 {
+		t.Fatalf("sortedMapKeys = %d entries, want 2", len(*keys))
+	}
+	releaseMapKeys(keys)
+	for i, kv := range (*keys)[:cap(*keys)] {
+		if kv.key != "" || kv.value.IsValid() {
+			t.Fatalf("entry %d still refers to %q after release", i, kv.key)
+		}
+	}
+}
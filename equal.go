@@ -0,0 +1,54 @@
+package bencode
+
+import "bytes"
+
+// Equal reports whether a and b encode the same document. Unlike a byte
+// comparison it ignores dict key order and non-canonical spellings such as
+// leading zeros in integers and string lengths. Repeated dict keys resolve to
+// their last occurrence.
+func Equal(a, b []byte) (bool, error) {
+	va, err := Parse(a)
+	if err != nil {
+		return false, err
+	}
+	vb, err := Parse(b)
+	if err != nil {
+		return false, err
+	}
+	return equalValues(va, vb), nil
+}
+
+func equalValues(a, b Value) bool {
+	if a.Kind() != b.Kind() {
+		return false
+	}
+	switch a.Kind() {
+	case IntegerKind:
+		return a.BigInt().Cmp(b.BigInt()) == 0
+	case StringKind:
+		return bytes.Equal(a.Bytes(), b.Bytes())
+	case ListKind:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i, e := range a.List() {
+			if !equalValues(e, b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case DictKind:
+		da, db := a.Dict(), b.Dict()
+		if len(da) != len(db) {
+			return false
+		}
+		for k, e := range da {
+			f, ok := db[k]
+			if !ok || !equalValues(e, f) {
+				return false
+			}
+		}
+		return true
+	}
+	return true
+}
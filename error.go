@@ -1,24 +1,333 @@
 package bencode
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"reflect"
+	"strings"
 )
 
+// Error is the type of the errors of the package that have no more specific type.
 type Error error
 
 func newError(format string, a ...interface{}) Error {
 	return Error(fmt.Errorf("bencode: "+format, a...))
 }
 
-func newParseError(key string, err error) Error {
-	return newError("parsing value for key %q: %s", key, err)
+// Errors wrapped by the errors of the package for specific failures, to be
+// matched with errors.Is.
+var (
+	// ErrUnexpectedEOF reports input ending in the middle of a value. It is
+	// io.ErrUnexpectedEOF, so that either can be matched.
+	ErrUnexpectedEOF = io.ErrUnexpectedEOF
+	// ErrDepthExceeded reports lists and dicts nested deeper than allowed.
+	ErrDepthExceeded = errors.New("exceeded max depth")
+	// ErrStringTooLong reports a byte string longer than Limits allow.
+	ErrStringTooLong = errors.New("byte string exceeds max length")
+	// ErrIntegerTooLong reports an integer with more digits than Limits
+	// allow.
+	ErrIntegerTooLong = errors.New("integer exceeds max digits")
+	// ErrDuplicateKey reports a key repeated within a dict. It is matched by
+	// every *DuplicateKeyError.
+	ErrDuplicateKey = errors.New("duplicate dict key")
+	// ErrTrailingData reports bytes after the top-level value where a single
+	// value is expected. It is wrapped by the *SyntaxError of Parse,
+	// ParseLazyDict, Walk, Lint, Limits.Check, DecodeFile and RawMessage, and
+	// of Marshal for a MarshalBencode result, and reported by Validate.
+	// Unmarshal and Decoder.Decode stop after the first value and leave the
+	// rest of the input alone.
+	ErrTrailingData = errors.New("trailing data after top-level value")
+)
+
+// A SyntaxError describes malformed bencode input.
+type SyntaxError struct {
+	Offset int64 // input offset at which the error was found
+	Path   Path  // path of the value being decoded, if known
+	Err    error // what is wrong, such as ErrUnexpectedEOF
+	// Context holds the input bytes around Offset, starting at offset
+	// ContextOffset. It is set when the whole input is at hand, as it is for
+	// Unmarshal and Parse, but not for a Decoder, which has let go of the
+	// bytes it read.
+	Context       []byte
+	ContextOffset int64
 }
-func newSyntaxError(offset int64, err error) Error {
-	return newError("syntax error (Offset: %d): %s", offset, err)
+
+func (e *SyntaxError) Error() string {
+	var s string
+	if len(e.Path) > 0 {
+		s = fmt.Sprintf("bencode: syntax error at %s (Offset: %d): %s", e.Path.short(), e.Offset, e.Err)
+	} else {
+		s = fmt.Sprintf("bencode: syntax error (Offset: %d): %s", e.Offset, e.Err)
+	}
+	if len(e.Context) > 0 {
+		s += " near " + e.excerpt()
+	}
+	return s
+}
+
+// excerpt renders Context in hex, with '>' before the byte at Offset, and
+// then in ASCII, such as `69 31 65 >78 31 |i1ex1|`.
+func (e *SyntaxError) excerpt() string {
+	var b strings.Builder
+	for i, c := range e.Context {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		if e.ContextOffset+int64(i) == e.Offset {
+			b.WriteByte('>')
+		}
+		fmt.Fprintf(&b, "%02x", c)
+	}
+	if e.ContextOffset+int64(len(e.Context)) == e.Offset {
+		b.WriteString(" >")
+	}
+	b.WriteString(" |")
+	for _, c := range e.Context {
+		if c < ' ' || c > '~' {
+			c = '.'
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte('|')
+	return b.String()
 }
-func newUnknownValueType(offset int64, b byte) Error {
-	return newError("unknown value type %+q", offset, b)
+
+// contextLen is the number of input bytes shown on each side of the offset
+// of a SyntaxError.
+const contextLen = 8
+
+// withContext attaches to a SyntaxError the bytes around its offset, data
+// being the whole input.
+func withContext(err error, data []byte) error {
+	e, ok := err.(*SyntaxError)
+	if !ok || e.Context != nil || e.Offset < 0 || e.Offset > int64(len(data)) {
+		return err
+	}
+	lo, hi := e.Offset-contextLen, e.Offset+contextLen
+	if lo < 0 {
+		lo = 0
+	}
+	if hi > int64(len(data)) {
+		hi = int64(len(data))
+	}
+	e.Context = append([]byte{}, data[lo:hi]...)
+	e.ContextOffset = lo
+	return err
+}
+
+// pathEnds is the number of elements shown at each end of a long path in
+// the message of an error.
+const pathEnds = 4
+
+// short returns p for the message of an error. The elements in the middle of
+// a long path, such as that of a list nested thousands of levels deep, are
+// left out and counted; the Path of the error keeps them all.
+func (p Path) short() string {
+	if len(p) <= 2*pathEnds+1 {
+		return p.String()
+	}
+	return fmt.Sprintf("%s.<%d more>.%s", p[:pathEnds], len(p)-2*pathEnds, p[len(p)-pathEnds:])
+}
+
+func (e *SyntaxError) Unwrap() error { return e.Err }
+
+// An UnmarshalTypeError describes a bencode value that cannot be stored in a
+// Go value of some type.
+type UnmarshalTypeError struct {
+	Value  string       // kind of the bencode value: "integer", "string", "list" or "dict"
+	Type   reflect.Type // type of the Go value it could not be stored in
+	Offset int64        // input offset at which the error was found, or -1 if unknown
+	Path   Path         // path of the value from the top-level value
+	Key    string       // dict key of the value, if it is the value of a dict entry
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	s := fmt.Sprintf("bencode: cannot unmarshal a bencode %s into a %s", e.Value, e.Type)
+	if len(e.Path) > 0 {
+		s += " at " + e.Path.short()
+	}
+	if e.Offset >= 0 {
+		s += fmt.Sprintf(" (Offset: %d)", e.Offset)
+	}
+	return s
+}
+
+// An UnknownKeyError reports a dict key that matches no exported field of
+// the struct it is decoded into, for a Decoder that disallows unknown keys.
+type UnknownKeyError struct {
+	Key    string
+	Type   reflect.Type // type of the struct
+	Path   Path         // path of the entry, ending with Key
+	Offset int64        // input offset of the key
 }
-func newUnknownType() Error {
-	return newError("unknown value type")
+
+func (e *UnknownKeyError) Error() string {
+	return fmt.Sprintf("bencode: %s has no exported field for the key %q at %s (Offset: %d)", e.Type, e.Key, e.Path.short(), e.Offset)
+}
+
+// An UnsupportedTypeError is returned when encoding a value of a type that
+// has no bencode representation, such as a channel or a float.
+type UnsupportedTypeError struct {
+	Type reflect.Type
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return "bencode: unsupported type: " + e.Type.String()
+}
+
+// An UnsupportedValueError is returned when encoding a value that cannot be
+// represented although its type can, such as a nil interface.
+type UnsupportedValueError struct {
+	Value reflect.Value
+	Str   string
+}
+
+func (e *UnsupportedValueError) Error() string {
+	return "bencode: unsupported value: " + e.Str
+}
+
+// A DuplicateKeyError reports a key repeated within a dict, with the offsets
+// of both occurrences so that the producer of the input can be told apart.
+type DuplicateKeyError struct {
+	Key         string
+	Path        Path  // path of the repeated entry, ending with Key
+	FirstOffset int64 // input offset of the first occurrence of the key
+	Offset      int64 // input offset of the repeated occurrence
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return fmt.Sprintf("bencode: duplicate dict key %q at %s (Offset: %d, first at %d)", e.Key, e.Path.short(), e.Offset, e.FirstOffset)
+}
+
+// Is makes errors.Is(err, ErrDuplicateKey) report whether err is a
+// *DuplicateKeyError.
+func (e *DuplicateKeyError) Is(target error) bool { return target == ErrDuplicateKey }
+
+// A MarshalerError wraps an error returned by the MarshalBencode or
+// UnmarshalBencode method of a type, or the reason the encoding returned by
+// MarshalBencode is not valid bencode.
+type MarshalerError struct {
+	Type reflect.Type
+	Path Path // path of the value from the top-level value
+	Err  error
+	// sourceFunc is the method that failed.
+	sourceFunc string
+}
+
+func (e *MarshalerError) Error() string {
+	if len(e.Path) > 0 {
+		return fmt.Sprintf("bencode: error calling %s for type %s at %s: %s", e.sourceFunc, e.Type, e.Path.short(), e.Err)
+	}
+	return fmt.Sprintf("bencode: error calling %s for type %s: %s", e.sourceFunc, e.Type, e.Err)
+}
+
+func (e *MarshalerError) Unwrap() error { return e.Err }
+
+// atElem prefixes the path of a MarshalerError, returned by the encoder of
+// an element of a list or dict, with the element.
+func atElem(err error, elem PathElem) error {
+	if e, ok := err.(*MarshalerError); ok {
+		e.Path = append(Path{elem}, e.Path...)
+	}
+	return err
+}
+
+// A DecodeError is an error other than a SyntaxError or an
+// UnmarshalTypeError met while decoding a value within a list or dict, such
+// as one returned by an Unmarshaler.
+type DecodeError struct {
+	Path   Path  // path of the value from the top-level value
+	Offset int64 // input offset at which the error was found
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("bencode: parsing value at %s (Offset: %d): %s", e.Path.short(), e.Offset, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+func (d *decodeState) pushKey(key string) {
+	d.path = append(d.path, PathElem{Key: key})
+}
+
+func (d *decodeState) pushIndex(i int) {
+	d.path = append(d.path, PathElem{Index: i, IsIndex: true})
+}
+
+func (d *decodeState) pop() {
+	d.path = d.path[:len(d.path)-1]
+}
+
+// failAt returns err after pushing the index i of the list element it is
+// about, for decoders that do not push elements as they go.
+func (d *decodeState) failAt(i int, err error) error {
+	d.pushIndex(i)
+	return err
+}
+
+// locate attaches to err the path left by a failed decode, and clears it.
+// Errors from nested decodes, such as within Unmarshalers, already carry
+// the path within the value they were given, which is prefixed with it.
+func (d *decodeState) locate(err error) error {
+	path := append(Path(nil), d.path...)
+	d.path = d.path[:0]
+	switch e := err.(type) {
+	case *SyntaxError:
+		e.Path = append(path, e.Path...)
+	case *UnmarshalTypeError:
+		e.Path = append(path, e.Path...)
+		if n := len(e.Path); n > 0 && !e.Path[n-1].IsIndex {
+			e.Key = e.Path[n-1].Key
+		}
+	case *UnknownKeyError:
+		e.Path = append(path, e.Path...)
+	case *DecodeError:
+		e.Path = append(path, e.Path...)
+	case *MarshalerError:
+		e.Path = append(path, e.Path...)
+	default:
+		if len(path) > 0 {
+			return &DecodeError{Path: path, Offset: d.Offset, Err: err}
+		}
+	}
+	return err
+}
+
+func newSyntaxError(offset int64, err error) error {
+	return &SyntaxError{Offset: offset, Err: err}
+}
+
+// syntaxError is newSyntaxError for malformed input met by the decoder, which
+// leaves the input at no known position.
+func (d *decodeState) syntaxError(offset int64, err error) error {
+	d.broken = true
+	return newSyntaxError(offset, err)
+}
+
+func newUnknownValueType(offset int64, b byte) error {
+	return newSyntaxError(offset, fmt.Errorf("unknown value type %q", b))
+}
+
+// unknownValueType reports the byte just read as starting no value.
+func (d *decodeState) unknownValueType(b byte) error {
+	d.broken = true
+	return newUnknownValueType(d.Offset-1, b)
+}
+
+// truncated turns the end of the input in the middle of a value into a
+// SyntaxError. Other read errors are returned as they are.
+func (d *decodeState) truncated(err error) error {
+	d.broken = true
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return newSyntaxError(d.Offset, ErrUnexpectedEOF)
+	}
+	return err
+}
+
+// typeError reports that a bencode value of the given kind, just read,
+// cannot be stored in a value of type t.
+func (d *decodeState) typeError(kind Kind, t reflect.Type) error {
+	return &UnmarshalTypeError{Value: kind.String(), Type: t, Offset: d.Offset}
 }
@@ -0,0 +1,89 @@
+package bencode
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// DecodeFile decodes the file with the given name, which must hold exactly
+// one bencode value, into v as Unmarshal does. Files larger than maxSize bytes
+// are rejected before being read whole, unless maxSize is zero or less.
+func DecodeFile(name string, v interface{}, maxSize int64) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if maxSize > 0 {
+		if fi, err := f.Stat(); err == nil && fi.Size() > maxSize {
+			return newError("%s: file of %d bytes exceeds the max size of %d", name, fi.Size(), maxSize)
+		}
+		// The file can grow after Stat.
+		r = io.LimitReader(f, maxSize+1)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if maxSize > 0 && int64(len(data)) > maxSize {
+		return newError("%s: file exceeds the max size of %d", name, maxSize)
+	}
+	if err = checkValid(data); err != nil {
+		return err
+	}
+	return Unmarshal(data, v)
+}
+
+// EncodeFile writes the encoding of v to the file with the given name, with
+// the permissions perm. The encoding goes to a temporary file in the same
+// directory first, which then replaces the file by a rename, so that readers
+// and crashes see either the old file or the whole new one, never a part of
+// it. Nothing is written if v cannot be encoded.
+func EncodeFile(name string, v interface{}, perm os.FileMode) error {
+	b, err := Marshal(v)
+	if err != nil {
+		return err
+	}
+	dir, base := filepath.Split(name)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := os.CreateTemp(dir, "."+base+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if err = writeSynced(f, b, perm); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err = os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	// Make the rename itself durable. Not all systems can sync directories,
+	// so this is done on a best-effort basis.
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+	return nil
+}
+
+// writeSynced writes b to f, sets its permissions, flushes it to storage and
+// closes it.
+func writeSynced(f *os.File, b []byte, perm os.FileMode) error {
+	_, err := f.Write(b)
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
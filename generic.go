@@ -0,0 +1,20 @@
+package bencode
+
+// Decode parses the bencode-encoded data and returns it as a value of type T.
+func Decode[T any](data []byte) (T, error) {
+	var v T
+	err := Unmarshal(data, &v)
+	return v, err
+}
+
+// Encode returns the bencode encoding of v.
+func Encode[T any](v T) ([]byte, error) {
+	return Marshal(&v)
+}
+
+// DecodeAs reads the next bencode value from dec and returns it as a value of type T.
+func DecodeAs[T any](dec *Decoder) (T, error) {
+	var v T
+	err := dec.Decode(&v)
+	return v, err
+}
@@ -1,3 +1,3 @@
 module go.x2ox.com/bencode
 
-go 1.16
+go 1.20
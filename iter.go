@@ -0,0 +1,93 @@
+package bencode
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// isSeqType reports whether t has the shape of iter.Seq[V]: func(yield func(V) bool).
+func isSeqType(t reflect.Type) bool {
+	if t.Kind() != reflect.Func || t.NumIn() != 1 || t.NumOut() != 0 {
+		return false
+	}
+	y := t.In(0)
+	return y.Kind() == reflect.Func && y.NumIn() == 1 &&
+		y.NumOut() == 1 && y.Out(0).Kind() == reflect.Bool
+}
+
+// isSeq2Type reports whether t has the shape of iter.Seq2[K, V] with a string key:
+// func(yield func(K, V) bool).
+func isSeq2Type(t reflect.Type) bool {
+	if t.Kind() != reflect.Func || t.NumIn() != 1 || t.NumOut() != 0 {
+		return false
+	}
+	y := t.In(0)
+	return y.Kind() == reflect.Func && y.NumIn() == 2 && y.In(0).Kind() == reflect.String &&
+		y.NumOut() == 1 && y.Out(0).Kind() == reflect.Bool
+}
+
+// seqEncoder streams the values yielded by an iter.Seq as a bencode list.
+func seqEncoder(e *encodeState, v reflect.Value) error {
+	if _, err := e.WriteString("l"); err != nil {
+		return err
+	}
+	if !v.IsNil() {
+		var (
+			err error
+			i   int
+		)
+		yield := reflect.MakeFunc(v.Type().In(0), func(args []reflect.Value) []reflect.Value {
+			if err = e.reflectValue(args[0]); err != nil {
+				err = atElem(err, PathElem{Index: i, IsIndex: true})
+			}
+			i++
+			return []reflect.Value{reflect.ValueOf(err == nil)}
+		})
+		v.Call([]reflect.Value{yield})
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := e.WriteString("e"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// seq2Encoder streams the pairs yielded by an iter.Seq2 as a bencode dictionary.
+// Keys must be yielded in strictly increasing order, as there is no way to sort them
+// without materializing the whole sequence.
+func seq2Encoder(e *encodeState, v reflect.Value) error {
+	if _, err := e.WriteString("d"); err != nil {
+		return err
+	}
+	if !v.IsNil() {
+		var (
+			err     error
+			prev    string
+			started bool
+		)
+		yield := reflect.MakeFunc(v.Type().In(0), func(args []reflect.Value) []reflect.Value {
+			key := args[0].String()
+			if started && key <= prev {
+				err = fmt.Errorf("sequence key %q is not greater than the previous key %q", key, prev)
+				return []reflect.Value{reflect.ValueOf(false)}
+			}
+			prev, started = key, true
+			if err = stringEncoder(e, args[0]); err == nil {
+				if err = e.reflectValue(args[1]); err != nil {
+					err = atElem(err, PathElem{Key: key})
+				}
+			}
+			return []reflect.Value{reflect.ValueOf(err == nil)}
+		})
+		v.Call([]reflect.Value{yield})
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := e.WriteString("e"); err != nil {
+		return err
+	}
+	return nil
+}
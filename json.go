@@ -0,0 +1,188 @@
+package bencode
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// binaryPrefix marks the JSON strings that hold byte strings in base64.
+const binaryPrefix = "base64:"
+
+// ToJSON converts the bencode value in data to JSON, for inspection and
+// processing with JSON tools:
+//
+//   - integers become numbers, of any size;
+//   - byte strings that are valid UTF-8 become strings;
+//   - other byte strings, such as hashes, become strings of their standard
+//     base64 encoding prefixed with "base64:", as do the byte strings that
+//     start with "base64:" themselves, so that the conversion can be undone;
+//   - lists become arrays, and dicts objects, with their keys in input order
+//     and converted like byte strings.
+//
+// FromJSON converts the result back.
+func ToJSON(data []byte) ([]byte, error) {
+	v, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return appendJSON(make([]byte, 0, len(data)), v), nil
+}
+
+func appendJSON(b []byte, v Value) []byte {
+	switch v.Kind() {
+	case IntegerKind:
+		return v.BigInt().Append(b, 10)
+	case StringKind:
+		return appendJSONString(b, v.Bytes())
+	case ListKind:
+		b = append(b, '[')
+		for i, e := range v.List() {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendJSON(b, e)
+		}
+		return append(b, ']')
+	default:
+		b = append(b, '{')
+		for i, k := range v.Keys() {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendJSONString(b, []byte(k))
+			b = append(b, ':')
+			b = appendJSON(b, v.list[i])
+		}
+		return append(b, '}')
+	}
+}
+
+// appendJSONString appends s as a JSON string, in base64 if it is binary.
+func appendJSONString(b, s []byte) []byte {
+	if !utf8.Valid(s) || bytes.HasPrefix(s, []byte(binaryPrefix)) {
+		b = append(b, '"')
+		b = append(b, binaryPrefix...)
+		n := len(b)
+		b = append(b, make([]byte, base64.StdEncoding.EncodedLen(len(s)))...)
+		base64.StdEncoding.Encode(b[n:], s)
+		return append(b, '"')
+	}
+	const hex = "0123456789abcdef"
+	b = append(b, '"')
+	for _, c := range s {
+		switch {
+		case c == '"' || c == '\\':
+			b = append(b, '\\', c)
+		case c == '\n':
+			b = append(b, '\\', 'n')
+		case c == '\r':
+			b = append(b, '\\', 'r')
+		case c == '\t':
+			b = append(b, '\\', 't')
+		case c < ' ' || c == 0x7f:
+			b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+		default:
+			b = append(b, c)
+		}
+	}
+	return append(b, '"')
+}
+
+// FromJSON converts JSON to bencode, following the conventions of ToJSON:
+// numbers must be integers, strings prefixed with "base64:" hold byte strings
+// in standard base64, and the keys of objects are sorted in the result. Null
+// and booleans have no bencode equivalent and are rejected, as are objects
+// whose keys are the same byte string once decoded.
+func FromJSON(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var x interface{}
+	if err := dec.Decode(&x); err != nil {
+		return nil, newError("invalid JSON: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, newError("invalid JSON: trailing data after top-level value")
+	}
+	return appendFromJSON(make([]byte, 0, len(data)), x, nil)
+}
+
+func appendFromJSON(b []byte, x interface{}, path Path) ([]byte, error) {
+	var err error
+	switch x := x.(type) {
+	case json.Number:
+		n, ok := new(big.Int).SetString(string(x), 10)
+		if !ok {
+			return nil, newError("JSON number %s%s is not an integer", x, jsonAt(path))
+		}
+		b = append(b, 'i')
+		b = n.Append(b, 10)
+		return append(b, 'e'), nil
+	case string:
+		s, err := fromJSONString(x, path)
+		if err != nil {
+			return nil, err
+		}
+		return appendString(b, s), nil
+	case []interface{}:
+		b = append(b, 'l')
+		for i, e := range x {
+			if b, err = appendFromJSON(b, e, append(path, PathElem{Index: i, IsIndex: true})); err != nil {
+				return nil, err
+			}
+		}
+		return append(b, 'e'), nil
+	case map[string]interface{}:
+		keys := make(map[string]string, len(x))
+		sorted := make([]string, 0, len(x))
+		for k := range x {
+			s, err := fromJSONString(k, path)
+			if err != nil {
+				return nil, err
+			}
+			if other, dup := keys[string(s)]; dup {
+				return nil, newError("JSON keys %q and %q%s are the same byte string", other, k, jsonAt(path))
+			}
+			keys[string(s)] = k
+			sorted = append(sorted, string(s))
+		}
+		sort.Strings(sorted)
+		b = append(b, 'd')
+		for _, k := range sorted {
+			b = appendString(b, []byte(k))
+			if b, err = appendFromJSON(b, x[keys[k]], append(path, PathElem{Key: k})); err != nil {
+				return nil, err
+			}
+		}
+		return append(b, 'e'), nil
+	case nil:
+		return nil, newError("JSON null%s has no bencode equivalent", jsonAt(path))
+	default:
+		return nil, newError("JSON %T%s has no bencode equivalent", x, jsonAt(path))
+	}
+}
+
+// fromJSONString returns the byte string a JSON string stands for.
+func fromJSONString(s string, path Path) ([]byte, error) {
+	if !strings.HasPrefix(s, binaryPrefix) {
+		return []byte(s), nil
+	}
+	b, err := base64.StdEncoding.DecodeString(s[len(binaryPrefix):])
+	if err != nil {
+		return nil, newError("JSON string%s: invalid base64: %w", jsonAt(path), err)
+	}
+	return b, nil
+}
+
+// jsonAt locates the errors of FromJSON within the document.
+func jsonAt(path Path) string {
+	if len(path) == 0 {
+		return ""
+	}
+	return " at " + path.String()
+}
@@ -0,0 +1,146 @@
+//go:build !bencode_lite
+
+// Package krpc provides the bencoded KRPC messages of the BitTorrent DHT (BEP 5),
+// with the IPv6 extensions of BEP 32 and the read-only flag of BEP 43.
+package krpc
+
+import (
+	"fmt"
+
+	"go.x2ox.com/bencode"
+)
+
+// Message kinds carried in the "y" key.
+const (
+	KindQuery    = "q"
+	KindResponse = "r"
+	KindError    = "e"
+)
+
+// Query method names carried in the "q" key.
+const (
+	MethodPing         = "ping"
+	MethodFindNode     = "find_node"
+	MethodGetPeers     = "get_peers"
+	MethodAnnouncePeer = "announce_peer"
+)
+
+// ID is a 160-bit node ID or infohash.
+type ID [20]byte
+
+// Msg is the envelope of every KRPC message. Exactly one of A, R and E is set,
+// according to Y; dispatchers switch on Y and, for queries, on Q.
+type Msg struct {
+	T  string   `bencode:"t"`           // transaction ID, opaque bytes chosen by the querying node
+	Y  string   `bencode:"y"`           // KindQuery, KindResponse or KindError
+	Q  string   `bencode:"q,omitempty"` // query method
+	A  *MsgArgs `bencode:"a,omitempty"` // query arguments
+	R  *Return  `bencode:"r,omitempty"` // response values
+	E  *Error   `bencode:"e,omitempty"` // error
+	V  string   `bencode:"v,omitempty"` // client version
+	IP string   `bencode:"ip,omitempty"`
+	RO bool     `bencode:"ro,omitempty"` // the sender is a read-only node
+}
+
+// MsgArgs holds the arguments of all query methods.
+type MsgArgs struct {
+	ID          ID       `bencode:"id"`
+	Target      *ID      `bencode:"target,omitempty"`    // find_node
+	InfoHash    *ID      `bencode:"info_hash,omitempty"` // get_peers, announce_peer
+	Port        int      `bencode:"port,omitempty"`      // announce_peer
+	ImpliedPort bool     `bencode:"implied_port,omitempty"`
+	Token       string   `bencode:"token,omitempty"` // announce_peer
+	Want        []string `bencode:"want,omitempty"`  // "n4" and/or "n6"
+}
+
+// Return holds the values of all responses.
+type Return struct {
+	ID     ID               `bencode:"id"`
+	Nodes  CompactIPv4Nodes `bencode:"nodes,omitempty"`
+	Nodes6 CompactIPv6Nodes `bencode:"nodes6,omitempty"`
+	Token  string           `bencode:"token,omitempty"`
+	Values PeerValues       `bencode:"values,omitempty"`
+}
+
+// Error codes defined by BEP 5.
+const (
+	ErrorGeneric       = 201
+	ErrorServer        = 202
+	ErrorProtocol      = 203
+	ErrorMethodUnknown = 204
+)
+
+// Error is the payload of an error message, encoded as a [code, message] list.
+type Error struct {
+	Code int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("krpc error %d: %s", e.Code, e.Msg)
+}
+
+// MarshalBencode encodes e as a two-element list.
+func (e Error) MarshalBencode() ([]byte, error) {
+	return bencode.Marshal([]interface{}{e.Code, e.Msg})
+}
+
+// UnmarshalBencode decodes a [code, message] list.
+func (e *Error) UnmarshalBencode(data []byte) error {
+	var l []interface{}
+	if err := bencode.Unmarshal(data, &l); err != nil {
+		return err
+	}
+	if len(l) != 2 {
+		return fmt.Errorf("krpc: error list has %d elements, want 2", len(l))
+	}
+	code, ok := l[0].(int64)
+	if !ok {
+		return fmt.Errorf("krpc: error code is a %T, want an integer", l[0])
+	}
+	msg, ok := l[1].(string)
+	if !ok {
+		return fmt.Errorf("krpc: error message is a %T, want a string", l[1])
+	}
+	e.Code, e.Msg = int(code), msg
+	return nil
+}
+
+// NewQuery returns a query message.
+func NewQuery(t, method string, args MsgArgs) Msg {
+	return Msg{T: t, Y: KindQuery, Q: method, A: &args}
+}
+
+// NewResponse returns a response message answering the query with transaction ID t.
+func NewResponse(t string, r Return) Msg {
+	return Msg{T: t, Y: KindResponse, R: &r}
+}
+
+// NewError returns an error message answering the query with transaction ID t.
+func NewError(t string, code int, msg string) Msg {
+	return Msg{T: t, Y: KindError, E: &Error{Code: code, Msg: msg}}
+}
+
+// Decode decodes and checks a KRPC message.
+func Decode(data []byte) (Msg, error) {
+	var m Msg
+	if err := bencode.Unmarshal(data, &m); err != nil {
+		return Msg{}, err
+	}
+	switch {
+	case m.Y == KindQuery && (m.Q == "" || m.A == nil):
+		return m, fmt.Errorf("krpc: query without method or arguments")
+	case m.Y == KindResponse && m.R == nil:
+		return m, fmt.Errorf("krpc: response without return values")
+	case m.Y == KindError && m.E == nil:
+		return m, fmt.Errorf("krpc: error message without error")
+	case m.Y != KindQuery && m.Y != KindResponse && m.Y != KindError:
+		return m, fmt.Errorf("krpc: unknown message kind %q", m.Y)
+	}
+	return m, nil
+}
+
+// Encode encodes m.
+func (m Msg) Encode() ([]byte, error) {
+	return bencode.Marshal(m)
+}
@@ -0,0 +1,94 @@
+//go:build !bencode_lite
+
+package krpc
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	id := ID{0: 'a', 19: 'z'}
+	target := ID{1: 1}
+	tests := []struct {
+		name string
+		msg  Msg
+		want string
+	}{
+		{
+			"ping query",
+			NewQuery("aa", MethodPing, MsgArgs{ID: id}),
+			"d1:ad2:id20:a\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00ze1:q4:ping1:t2:aa1:y1:qe",
+		},
+		{
+			"find_node query",
+			NewQuery("ab", MethodFindNode, MsgArgs{ID: id, Target: &target, Want: []string{"n4", "n6"}}),
+			"",
+		},
+		{
+			"error",
+			NewError("ac", ErrorProtocol, "bad token"),
+			"d1:eli203e9:bad tokene1:t2:ac1:y1:ee",
+		},
+		{
+			"response",
+			NewResponse("ad", Return{
+				ID:     id,
+				Nodes:  CompactIPv4Nodes{{ID: target, Addr: netip.MustParseAddrPort("10.0.0.1:6881")}},
+				Nodes6: CompactIPv6Nodes{{ID: id, Addr: netip.MustParseAddrPort("[2001:db8::1]:6881")}},
+				Token:  "tok",
+				Values: PeerValues{netip.MustParseAddrPort("10.0.0.2:1"), netip.MustParseAddrPort("[2001:db8::2]:2")},
+			}),
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := tt.msg.Encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != "" && string(b) != tt.want {
+				t.Fatalf("Encode = %q, want %q", b, tt.want)
+			}
+			got, err := Decode(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.msg) {
+				t.Fatalf("Decode = %+v, want %+v", got, tt.msg)
+			}
+		})
+	}
+}
+
+func TestDecodeRejectsIncompleteMessages(t *testing.T) {
+	for _, data := range []string{
+		"d1:t2:aa1:y1:qe",
+		"d1:q4:ping1:t2:aa1:y1:qe",
+		"d1:t2:aa1:y1:re",
+		"d1:t2:aa1:y1:ee",
+		"d1:t2:aa1:y1:xe",
+		"d1:eli201ee1:t2:aa1:y1:ee",
+	} {
+		if m, err := Decode([]byte(data)); err == nil {
+			t.Errorf("Decode(%q) = %+v, want an error", data, m)
+		}
+	}
+}
+
+func TestCompactNodesRejectBadLength(t *testing.T) {
+	var ns CompactIPv4Nodes
+	if err := ns.UnmarshalBencode([]byte("25:" + string(make([]byte, 25)))); err == nil {
+		t.Error("CompactIPv4Nodes accepted a 25-byte string")
+	}
+	var ns6 CompactIPv6Nodes
+	if err := ns6.UnmarshalBencode([]byte("26:" + string(make([]byte, 26)))); err == nil {
+		t.Error("CompactIPv6Nodes accepted a 26-byte string")
+	}
+	var pv PeerValues
+	if err := pv.UnmarshalBencode([]byte("l5:abcdee")); err == nil {
+		t.Error("PeerValues accepted a 5-byte peer")
+	}
+}
@@ -0,0 +1,132 @@
+//go:build !bencode_lite
+
+package krpc
+
+import (
+	"fmt"
+	"net/netip"
+
+	"go.x2ox.com/bencode"
+	"go.x2ox.com/bencode/compact"
+)
+
+// NodeInfo is a DHT node: its ID and its address.
+type NodeInfo struct {
+	ID   ID
+	Addr netip.AddrPort
+}
+
+// CompactIPv4Nodes is a list of IPv4 nodes encoded as a string of 26-byte
+// entries, each a node ID followed by a compact IPv4 peer.
+type CompactIPv4Nodes []NodeInfo
+
+// CompactIPv6Nodes is a list of IPv6 nodes encoded as a string of 38-byte
+// entries, each a node ID followed by a compact IPv6 peer.
+type CompactIPv6Nodes []NodeInfo
+
+// MarshalBencode encodes ns in compact node info format.
+func (ns CompactIPv4Nodes) MarshalBencode() ([]byte, error) {
+	return marshalNodes(ns, compact.AppendPeers)
+}
+
+// UnmarshalBencode decodes compact node info.
+func (ns *CompactIPv4Nodes) UnmarshalBencode(data []byte) error {
+	return unmarshalNodes((*[]NodeInfo)(ns), data, compact.PeerLen, compact.ParsePeers)
+}
+
+// MarshalBencode encodes ns in compact node info format.
+func (ns CompactIPv6Nodes) MarshalBencode() ([]byte, error) {
+	return marshalNodes(ns, compact.AppendPeers6)
+}
+
+// UnmarshalBencode decodes compact node info.
+func (ns *CompactIPv6Nodes) UnmarshalBencode(data []byte) error {
+	return unmarshalNodes((*[]NodeInfo)(ns), data, compact.Peer6Len, compact.ParsePeers6)
+}
+
+func marshalNodes(ns []NodeInfo, appendAddr func([]byte, []netip.AddrPort) ([]byte, error)) ([]byte, error) {
+	var (
+		b   []byte
+		err error
+	)
+	for _, n := range ns {
+		b = append(b, n.ID[:]...)
+		if b, err = appendAddr(b, []netip.AddrPort{n.Addr}); err != nil {
+			return nil, err
+		}
+	}
+	return bencode.Marshal(b)
+}
+
+func unmarshalNodes(ns *[]NodeInfo, data []byte, addrLen int,
+	parseAddrs func([]byte) ([]netip.AddrPort, error)) error {
+	var b []byte
+	if err := bencode.Unmarshal(data, &b); err != nil {
+		return err
+	}
+	size := len(ID{}) + addrLen
+	if len(b)%size != 0 {
+		return fmt.Errorf("krpc: compact nodes length %d is not a multiple of %d", len(b), size)
+	}
+	*ns = make([]NodeInfo, 0, len(b)/size)
+	for ; len(b) > 0; b = b[size:] {
+		addrs, err := parseAddrs(b[len(ID{}):size])
+		if err != nil {
+			return err
+		}
+		var n NodeInfo
+		copy(n.ID[:], b)
+		n.Addr = addrs[0]
+		*ns = append(*ns, n)
+	}
+	return nil
+}
+
+// PeerValues is the "values" list of a get_peers response: a list of byte
+// strings, each a compact IPv4 or IPv6 peer.
+type PeerValues []netip.AddrPort
+
+// MarshalBencode encodes each peer as its own compact string.
+func (ps PeerValues) MarshalBencode() ([]byte, error) {
+	l := make([][]byte, 0, len(ps))
+	for _, p := range ps {
+		var (
+			b   []byte
+			err error
+		)
+		if p.Addr().Unmap().Is4() {
+			b, err = compact.AppendPeers(nil, []netip.AddrPort{p})
+		} else {
+			b, err = compact.AppendPeers6(nil, []netip.AddrPort{p})
+		}
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, b)
+	}
+	return bencode.Marshal(l)
+}
+
+// UnmarshalBencode decodes a list of compact peers of either family.
+func (ps *PeerValues) UnmarshalBencode(data []byte) error {
+	var l [][]byte
+	if err := bencode.Unmarshal(data, &l); err != nil {
+		return err
+	}
+	*ps = make(PeerValues, 0, len(l))
+	for _, b := range l {
+		parse := compact.ParsePeers
+		if len(b) == compact.Peer6Len {
+			parse = compact.ParsePeers6
+		}
+		addrs, err := parse(b)
+		if err != nil {
+			return err
+		}
+		if len(addrs) != 1 {
+			return fmt.Errorf("krpc: peer value of %d bytes is not a single compact peer", len(b))
+		}
+		*ps = append(*ps, addrs[0])
+	}
+	return nil
+}
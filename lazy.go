@@ -0,0 +1,152 @@
+package bencode
+
+import "sort"
+
+// LazyDict is a read-only view of an encoded dict that decodes its values only
+// when they are asked for. It is made by scanning the dict once and recording
+// where each key and value lies, which costs far less than decoding documents
+// of which only a few keys are read. The zero LazyDict is an empty dict.
+type LazyDict struct {
+	data    []byte
+	entries []lazyEntry
+	// sorted is set if the keys are in strictly increasing order, as they
+	// are in valid bencode, so that lookups can use binary search.
+	sorted bool
+}
+
+// lazyEntry locates an entry in the data of a LazyDict: the key is
+// data[key:value] and the encoded value data[value:end].
+type lazyEntry struct {
+	key, value, end int
+}
+
+// ParseLazyDict indexes the encoded dict data, which must hold exactly one
+// well-formed dict. A key repeated in data takes its last value, as it does
+// for Unmarshal. The LazyDict aliases data, which must not be modified while
+// it is in use.
+func ParseLazyDict(data []byte) (*LazyDict, error) {
+	if err := checkValid(data); err != nil {
+		return nil, err
+	}
+	if data[0] != 'd' {
+		return nil, newError("cannot index a bencode %s as a dict", kindOf(data))
+	}
+	d := &LazyDict{data: data, sorted: true}
+	for i := 1; data[i] != 'e'; {
+		keyEnd, _ := scanString(data, i)
+		valueEnd, _ := scanValue(data, keyEnd)
+		e := lazyEntry{key: keyEnd - len(stringPayload(data[i:keyEnd])), value: keyEnd, end: valueEnd}
+		if n := len(d.entries); n > 0 && string(d.keyOf(d.entries[n-1])) >= string(d.keyOf(e)) {
+			d.sorted = false
+		}
+		d.entries = append(d.entries, e)
+		i = valueEnd
+	}
+	if !d.sorted {
+		d.dropRepeated()
+	}
+	return d, nil
+}
+
+// dropRepeated removes the entries whose key occurs again later.
+func (d *LazyDict) dropRepeated() {
+	last := make(map[string]int, len(d.entries))
+	for i, e := range d.entries {
+		last[string(d.keyOf(e))] = i
+	}
+	if len(last) == len(d.entries) {
+		return
+	}
+	kept := d.entries[:0]
+	for i, e := range d.entries {
+		if last[string(d.keyOf(e))] == i {
+			kept = append(kept, e)
+		}
+	}
+	d.entries = kept
+}
+
+func (d *LazyDict) keyOf(e lazyEntry) []byte { return d.data[e.key:e.value] }
+
+// find returns the entry of key.
+func (d *LazyDict) find(key string) (lazyEntry, bool) {
+	if d.sorted {
+		i := sort.Search(len(d.entries), func(i int) bool {
+			return string(d.keyOf(d.entries[i])) >= key
+		})
+		if i < len(d.entries) && string(d.keyOf(d.entries[i])) == key {
+			return d.entries[i], true
+		}
+		return lazyEntry{}, false
+	}
+	for _, e := range d.entries {
+		if string(d.keyOf(e)) == key {
+			return e, true
+		}
+	}
+	return lazyEntry{}, false
+}
+
+// Len returns the number of distinct keys.
+func (d *LazyDict) Len() int { return len(d.entries) }
+
+// Keys returns the keys in input order, a repeated key where it last occurs.
+func (d *LazyDict) Keys() []string {
+	keys := make([]string, len(d.entries))
+	for i, e := range d.entries {
+		keys[i] = string(d.keyOf(e))
+	}
+	return keys
+}
+
+// Has reports whether the dict has the given key.
+func (d *LazyDict) Has(key string) bool {
+	_, ok := d.find(key)
+	return ok
+}
+
+// Raw returns the encoded value of the given key, aliasing the dict's data.
+func (d *LazyDict) Raw(key string) (RawMessage, bool) {
+	e, ok := d.find(key)
+	if !ok {
+		return nil, false
+	}
+	return RawMessage(d.data[e.value:e.end:e.end]), true
+}
+
+// Get parses the value of the given key.
+func (d *LazyDict) Get(key string) (Value, bool) {
+	raw, ok := d.Raw(key)
+	if !ok {
+		return Value{}, false
+	}
+	v, err := Parse(raw)
+	return v, err == nil
+}
+
+// Decode decodes the value of the given key into v, as Unmarshal does.
+func (d *LazyDict) Decode(key string, v interface{}) error {
+	raw, ok := d.Raw(key)
+	if !ok {
+		return newError("dict has no key %q", key)
+	}
+	return Unmarshal(raw, v)
+}
+
+// MarshalBencode returns the encoded dict.
+func (d LazyDict) MarshalBencode() ([]byte, error) {
+	if d.data == nil {
+		return []byte("de"), nil
+	}
+	return d.data, nil
+}
+
+// UnmarshalBencode indexes a copy of data.
+func (d *LazyDict) UnmarshalBencode(data []byte) error {
+	nd, err := ParseLazyDict(append([]byte(nil), data...))
+	if err != nil {
+		return err
+	}
+	*d = *nd
+	return nil
+}
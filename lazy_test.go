@@ -0,0 +1,26 @@
+//go:build !bencode_lite
+
+package bencode
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLazyDictRepeatedKeys(t *testing.T) {
+	d, err := ParseLazyDict([]byte("d1:ai1e1:bi2e1:ai3ee"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d.Keys(); !reflect.DeepEqual(got, []string{"b", "a"}) || d.Len() != 2 {
+		t.Fatalf("Keys = %q, Len = %d; want [b a] and 2", got, d.Len())
+	}
+	var a int
+	if err = d.Decode("a", &a); err != nil || a != 3 {
+		t.Fatalf("Decode(a) = %d, %v; want the last value 3", a, err)
+	}
+	var m map[string]int
+	if err = Unmarshal([]byte("d1:ai1e1:bi2e1:ai3ee"), &m); err != nil || m["a"] != a {
+		t.Fatalf("Unmarshal = %v, %v; want a as LazyDict decodes it", m, err)
+	}
+}
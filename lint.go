@@ -0,0 +1,62 @@
+package bencode
+
+import "fmt"
+
+// LintRule identifies the kind of non-canonical construct reported by Lint.
+type LintRule uint8
+
+const (
+	LintUnsortedKey LintRule = iota + 1
+	LintDuplicateKey
+	LintLeadingZero
+	LintNegativeZero
+	LintStringLengthLeadingZero
+	LintInvalidUTF8Key
+)
+
+func (r LintRule) String() string {
+	switch r {
+	case LintUnsortedKey:
+		return "unsorted-key"
+	case LintDuplicateKey:
+		return "duplicate-key"
+	case LintLeadingZero:
+		return "leading-zero"
+	case LintNegativeZero:
+		return "negative-zero"
+	case LintStringLengthLeadingZero:
+		return "string-length-leading-zero"
+	case LintInvalidUTF8Key:
+		return "invalid-utf8-key"
+	}
+	return "unknown"
+}
+
+// LintIssue is a single non-canonical construct found by Lint.
+type LintIssue struct {
+	Rule    LintRule
+	Offset  int  // byte offset of the offending value or key
+	Path    Path // location of the offending value, or of the entry for key issues
+	Message string
+}
+
+func (i LintIssue) String() string {
+	return fmt.Sprintf("offset %d: %s: %s: %s", i.Offset, i.Path, i.Rule, i.Message)
+}
+
+// Lint reports every construct in data that is valid bencode but not in
+// canonical form, in input order. A document that Lint accepts without issues
+// is left unchanged by Canonicalize. Lint returns an error only if data is not
+// valid bencode.
+func Lint(data []byte) ([]LintIssue, error) {
+	if err := checkValid(data); err != nil {
+		return nil, err
+	}
+	var issues []LintIssue
+	for _, i := range Validate(data) {
+		if i.Rule != 0 {
+			issues = append(issues, LintIssue{Rule: i.Rule, Offset: i.Offset, Path: i.Path, Message: i.Message})
+		}
+	}
+	return issues, nil
+}
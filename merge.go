@@ -0,0 +1,74 @@
+package bencode
+
+// ListStrategy selects how Merge combines a list in the patch with a list in the destination.
+type ListStrategy uint8
+
+const (
+	// ListReplace replaces the destination list with the patch list.
+	ListReplace ListStrategy = iota
+	// ListAppend appends the patch elements to the destination list.
+	ListAppend
+	// ListUnion appends the patch elements that are not already present in the destination list.
+	ListUnion
+)
+
+// MergeOptions configures a deep dictionary merge.
+type MergeOptions struct {
+	Lists ListStrategy
+}
+
+// Merge deep-merges patch into dst using the default options: dicts are merged
+// key by key, and any other value in patch, lists included, replaces its
+// counterpart in dst.
+func Merge(dst, patch []byte) ([]byte, error) {
+	return MergeOptions{}.Merge(dst, patch)
+}
+
+// Merge deep-merges patch into dst and returns the resulting document. Keys
+// present only in dst are kept, keys present in patch override or extend dst,
+// nested dicts are merged recursively and lists are combined according to
+// o.Lists. Subtrees of dst that the patch does not touch are copied verbatim.
+func (o MergeOptions) Merge(dst, patch []byte) ([]byte, error) {
+	d, err := Parse(dst)
+	if err != nil {
+		return nil, err
+	}
+	p, err := Parse(patch)
+	if err != nil {
+		return nil, err
+	}
+	return o.merge(d, p).Raw(), nil
+}
+
+func (o MergeOptions) merge(dst, patch Value) Value {
+	switch {
+	case dst.Kind() == DictKind && patch.Kind() == DictKind:
+		for _, k := range patch.Keys() {
+			dst.Set(k, o.merge(dst.Get(k), patch.Get(k)))
+		}
+		return dst
+	case dst.Kind() == ListKind && patch.Kind() == ListKind:
+		switch o.Lists {
+		case ListAppend:
+			dst.Append(patch.List()...)
+			return dst
+		case ListUnion:
+			for _, e := range patch.List() {
+				if !listContains(dst, e) {
+					dst.Append(e)
+				}
+			}
+			return dst
+		}
+	}
+	return patch
+}
+
+func listContains(l, x Value) bool {
+	for _, e := range l.List() {
+		if equalValues(e, x) {
+			return true
+		}
+	}
+	return false
+}
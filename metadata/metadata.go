@@ -0,0 +1,176 @@
+//go:build !bencode_lite
+
+// Package metadata implements the ut_metadata extension (BEP 9), which lets
+// peers exchange the info dictionary of a torrent in 16 KiB pieces.
+package metadata
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"go.x2ox.com/bencode"
+	"go.x2ox.com/bencode/metainfo"
+)
+
+// PieceSize is the size of every metadata piece but the last.
+const PieceSize = 16 * 1024
+
+// MaxSize bounds the total_size accepted by NewAssembler, as a guard
+// against peers announcing absurd metadata sizes.
+const MaxSize = 64 << 20
+
+// Message types carried in msg_type.
+const (
+	MsgRequest = 0
+	MsgData    = 1
+	MsgReject  = 2
+)
+
+// Message is the bencoded header of a ut_metadata message. Data messages are
+// followed on the wire by the piece itself, outside the dictionary.
+type Message struct {
+	Type      int `bencode:"msg_type"`
+	Piece     int `bencode:"piece"`
+	TotalSize int `bencode:"total_size,omitempty"`
+}
+
+// Encode returns the wire form of m followed by payload, which is only
+// meaningful for data messages.
+func (m Message) Encode(payload []byte) ([]byte, error) {
+	b, err := bencode.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, payload...), nil
+}
+
+// DecodeMessage splits a ut_metadata message into its header and the payload that follows it.
+func DecodeMessage(b []byte) (Message, []byte, error) {
+	r := bytes.NewReader(b)
+	var m Message
+	if err := bencode.NewDecoder(r).Decode(&m); err != nil {
+		return Message{}, nil, err
+	}
+	payload := b[len(b)-r.Len():]
+	if m.Type != MsgData && len(payload) != 0 {
+		return Message{}, nil, fmt.Errorf("metadata: message type %d carries %d bytes of payload", m.Type, len(payload))
+	}
+	return m, payload, nil
+}
+
+// NumPieces returns the number of pieces metadata of the given size is split into.
+func NumPieces(totalSize int) int {
+	return (totalSize + PieceSize - 1) / PieceSize
+}
+
+// Split cuts the encoded info dictionary into pieces. The pieces alias info.
+func Split(info []byte) [][]byte {
+	pieces := make([][]byte, 0, NumPieces(len(info)))
+	for len(info) > PieceSize {
+		pieces = append(pieces, info[:PieceSize])
+		info = info[PieceSize:]
+	}
+	return append(pieces, info)
+}
+
+// Assembler collects metadata pieces received from peers.
+type Assembler struct {
+	totalSize int
+	pieces    [][]byte
+	have      int
+}
+
+// NewAssembler returns an Assembler for metadata of the given total_size.
+func NewAssembler(totalSize int) (*Assembler, error) {
+	if totalSize <= 0 || totalSize > MaxSize {
+		return nil, fmt.Errorf("metadata: invalid total size %d", totalSize)
+	}
+	return &Assembler{totalSize: totalSize, pieces: make([][]byte, NumPieces(totalSize))}, nil
+}
+
+// Add stores a received piece. Every piece but the last must be exactly
+// PieceSize bytes; the last one holds the remainder.
+func (a *Assembler) Add(piece int, data []byte) error {
+	if piece < 0 || piece >= len(a.pieces) {
+		return fmt.Errorf("metadata: piece %d out of range [0, %d)", piece, len(a.pieces))
+	}
+	want := PieceSize
+	if piece == len(a.pieces)-1 {
+		want = a.totalSize - piece*PieceSize
+	}
+	if len(data) != want {
+		return fmt.Errorf("metadata: piece %d has %d bytes, want %d", piece, len(data), want)
+	}
+	if a.pieces[piece] == nil {
+		a.have++
+	}
+	a.pieces[piece] = append([]byte(nil), data...)
+	return nil
+}
+
+// Missing returns the indices of the pieces not received yet.
+func (a *Assembler) Missing() []int {
+	var missing []int
+	for i, p := range a.pieces {
+		if p == nil {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+// Complete reports whether every piece has been received.
+func (a *Assembler) Complete() bool {
+	return a.have == len(a.pieces)
+}
+
+// Bytes returns the assembled metadata, or nil if it is not complete.
+func (a *Assembler) Bytes() []byte {
+	if !a.Complete() {
+		return nil
+	}
+	return bytes.Join(a.pieces, nil)
+}
+
+// ErrHashMismatch is returned when assembled metadata does not match the expected infohash.
+var ErrHashMismatch = errors.New("metadata: info dictionary does not match the infohash")
+
+// Verify returns the assembled info dictionary if it is complete, valid bencode
+// and hashes to the v1 infohash h. On a mismatch the caller should discard the
+// pieces and fetch them again, possibly from other peers.
+func (a *Assembler) Verify(h metainfo.Hash) ([]byte, error) {
+	b, err := a.checked()
+	if err != nil {
+		return nil, err
+	}
+	if sha1.Sum(b) != h {
+		return nil, ErrHashMismatch
+	}
+	return b, nil
+}
+
+// VerifyV2 is like Verify for a v2 infohash.
+func (a *Assembler) VerifyV2(h metainfo.HashV2) ([]byte, error) {
+	b, err := a.checked()
+	if err != nil {
+		return nil, err
+	}
+	if sha256.Sum256(b) != h {
+		return nil, ErrHashMismatch
+	}
+	return b, nil
+}
+
+func (a *Assembler) checked() ([]byte, error) {
+	b := a.Bytes()
+	if b == nil {
+		return nil, fmt.Errorf("metadata: %d of %d pieces missing", len(a.pieces)-a.have, len(a.pieces))
+	}
+	if !bencode.Valid(b) {
+		return nil, errors.New("metadata: assembled info dictionary is not valid bencode")
+	}
+	return b, nil
+}
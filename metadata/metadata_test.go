@@ -0,0 +1,104 @@
+//go:build !bencode_lite
+
+package metadata
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"go.x2ox.com/bencode/metainfo"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     Message
+		payload string
+		want    string
+	}{
+		{"request", Message{Type: MsgRequest, Piece: 1}, "", "d8:msg_typei0e5:piecei1ee"},
+		{"data", Message{Type: MsgData, Piece: 0, TotalSize: 5}, "hello", "d8:msg_typei1e5:piecei0e10:total_sizei5eehello"},
+		{"reject", Message{Type: MsgReject, Piece: 2}, "", "d8:msg_typei2e5:piecei2ee"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := tt.msg.Encode([]byte(tt.payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Fatalf("Encode = %q, want %q", b, tt.want)
+			}
+			m, payload, err := DecodeMessage(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m != tt.msg || string(payload) != tt.payload {
+				t.Fatalf("DecodeMessage = %+v, %q, want %+v, %q", m, payload, tt.msg, tt.payload)
+			}
+		})
+	}
+}
+
+func TestDecodeMessageRejectsPayloadOnRequest(t *testing.T) {
+	if _, _, err := DecodeMessage([]byte("d8:msg_typei0e5:piecei0eextra")); err == nil {
+		t.Fatal("DecodeMessage accepted a payload after a request")
+	}
+}
+
+func TestAssembler(t *testing.T) {
+	// An info dictionary spanning three pieces, the last one short.
+	pad := bytes.Repeat([]byte{'x'}, 2*PieceSize+100)
+	info := append([]byte("d3:pad"+strconv.Itoa(len(pad))+":"), pad...)
+	info = append(info, 'e')
+
+	a, err := NewAssembler(len(info))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pieces := Split(info)
+	if len(pieces) != 3 || len(pieces) != NumPieces(len(info)) {
+		t.Fatalf("Split made %d pieces, want 3", len(pieces))
+	}
+	if err = a.Add(2, pieces[0]); err == nil {
+		t.Fatal("Add accepted a full-size last piece")
+	}
+	if err = a.Add(3, pieces[2]); err == nil {
+		t.Fatal("Add accepted an out of range piece")
+	}
+	for _, i := range []int{2, 0} {
+		if err = a.Add(i, pieces[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a.Complete() || a.Bytes() != nil || !reflect.DeepEqual(a.Missing(), []int{1}) {
+		t.Fatalf("after two pieces: Complete %v, Missing %v", a.Complete(), a.Missing())
+	}
+	if _, err = a.Verify(sha1.Sum(info)); err == nil {
+		t.Fatal("Verify accepted incomplete metadata")
+	}
+	if err = a.Add(1, pieces[1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = a.Verify(metainfo.Hash{}); err != ErrHashMismatch {
+		t.Fatalf("Verify with the wrong hash: %v", err)
+	}
+	if b, err := a.Verify(sha1.Sum(info)); err != nil || !bytes.Equal(b, info) {
+		t.Fatalf("Verify: %v", err)
+	}
+	if b, err := a.VerifyV2(sha256.Sum256(info)); err != nil || !bytes.Equal(b, info) {
+		t.Fatalf("VerifyV2: %v", err)
+	}
+}
+
+func TestNewAssemblerRejectsSize(t *testing.T) {
+	for _, n := range []int{-1, 0, MaxSize + 1} {
+		if _, err := NewAssembler(n); err == nil {
+			t.Errorf("NewAssembler(%d) succeeded", n)
+		}
+	}
+}
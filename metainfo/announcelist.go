@@ -0,0 +1,135 @@
+//go:build !bencode_lite
+
+package metainfo
+
+import (
+	"math/rand"
+
+	"go.x2ox.com/bencode"
+)
+
+// AnnounceList is the list of tracker tiers of a torrent (BEP 12). Clients try
+// the tiers in order and the trackers of a tier in order, after shuffling
+// each tier once; a tracker that responds is moved to the front of its tier.
+type AnnounceList [][]string
+
+// MarshalBencode encodes al as a list of lists of strings, leaving out empty
+// URLs and empty tiers.
+func (al AnnounceList) MarshalBencode() ([]byte, error) {
+	tiers := make([][]string, 0, len(al))
+	for _, tier := range al {
+		var t []string
+		for _, u := range tier {
+			if u != "" {
+				t = append(t, u)
+			}
+		}
+		if len(t) > 0 {
+			tiers = append(tiers, t)
+		}
+	}
+	return bencode.Marshal(tiers)
+}
+
+// UnmarshalBencode decodes a list of lists of strings. A string found in place
+// of a tier, as written by some broken encoders, is taken as a tier of its own.
+func (al *AnnounceList) UnmarshalBencode(data []byte) error {
+	var l []bencode.RawMessage
+	if err := bencode.Unmarshal(data, &l); err != nil {
+		return err
+	}
+	tiers := make(AnnounceList, 0, len(l))
+	for _, raw := range l {
+		var tier []string
+		if len(raw) > 0 && raw[0] != 'l' {
+			var u string
+			if err := bencode.Unmarshal(raw, &u); err != nil {
+				return err
+			}
+			tier = []string{u}
+		} else if err := bencode.Unmarshal(raw, &tier); err != nil {
+			return err
+		}
+		tiers = append(tiers, tier)
+	}
+	*al = tiers
+	return nil
+}
+
+// Clone returns a deep copy of al, so that it can be shuffled and reordered
+// without touching the original.
+func (al AnnounceList) Clone() AnnounceList {
+	if al == nil {
+		return nil
+	}
+	c := make(AnnounceList, len(al))
+	for i, tier := range al {
+		c[i] = append([]string(nil), tier...)
+	}
+	return c
+}
+
+// Trackers returns the trackers of all tiers in order, without duplicates.
+func (al AnnounceList) Trackers() []string {
+	var l []string
+	seen := make(map[string]bool)
+	for _, tier := range al {
+		for _, u := range tier {
+			if u != "" && !seen[u] {
+				seen[u] = true
+				l = append(l, u)
+			}
+		}
+	}
+	return l
+}
+
+// Range calls f for every tracker in announce order until f returns false.
+func (al AnnounceList) Range(f func(tier int, url string) bool) {
+	for i, tier := range al {
+		for _, u := range tier {
+			if !f(i, u) {
+				return
+			}
+		}
+	}
+}
+
+// Shuffle randomly reorders the trackers within each tier in place, as BEP 12
+// asks clients to do once when loading a torrent. A nil r uses the default source.
+func (al AnnounceList) Shuffle(r *rand.Rand) {
+	shuffle := rand.Shuffle
+	if r != nil {
+		shuffle = r.Shuffle
+	}
+	for _, tier := range al {
+		shuffle(len(tier), func(i, j int) { tier[i], tier[j] = tier[j], tier[i] })
+	}
+}
+
+// Promote moves the tracker with the given URL to the front of its tier, as
+// BEP 12 asks after a successful announce. It reports whether url was found.
+func (al AnnounceList) Promote(url string) bool {
+	for _, tier := range al {
+		for i, u := range tier {
+			if u == url {
+				copy(tier[1:i+1], tier[:i])
+				tier[0] = url
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AnnounceTiers returns the tracker tiers of mi. Per BEP 12 the announce-list,
+// when present, takes precedence over announce, which otherwise forms the only tier.
+func (mi *MetaInfo) AnnounceTiers() AnnounceList {
+	if len(mi.AnnounceList.Trackers()) > 0 {
+		return mi.AnnounceList
+	}
+	if mi.Announce != "" {
+		return AnnounceList{{mi.Announce}}
+	}
+	return nil
+}
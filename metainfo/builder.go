@@ -0,0 +1,300 @@
+//go:build !bencode_lite
+
+package metainfo
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Builder creates a MetaInfo for a file or a directory tree, hashing its
+// contents into pieces.
+type Builder struct {
+	// AnnounceList holds the tracker tiers. The first tracker also becomes the announce URL.
+	AnnounceList [][]string
+	Comment      string
+	CreatedBy    string
+	// CreationDate is omitted from the torrent when zero.
+	CreationDate time.Time
+	Private      bool
+	Source       string
+	// PieceLength is the size of a piece in bytes, a power of two.
+	// When zero, a length giving around 1500 pieces is chosen.
+	PieceLength int64
+	// AlignFiles makes Build insert BEP 47 padding files so that every file
+	// of a directory starts on a piece boundary. BuildHybrid always does.
+	AlignFiles bool
+	// Workers is the number of goroutines hashing pieces, one per CPU when
+	// zero. Pieces are read ahead of them in order, and at most 2*Workers
+	// pieces are held in memory at a time.
+	Workers int
+}
+
+const (
+	minPieceLength = 16 << 10
+	maxPieceLength = 16 << 20
+)
+
+// DefaultPieceLength returns the power of two between 16 KiB and 16 MiB that
+// splits totalLength into about 1500 pieces.
+func DefaultPieceLength(totalLength int64) int64 {
+	n := int64(minPieceLength)
+	for n < maxPieceLength && totalLength/n > 1500 {
+		n <<= 1
+	}
+	return n
+}
+
+// Build creates the MetaInfo for root, a regular file or a directory. Files of
+// a directory are listed in lexical order of their paths; empty directories
+// are left out.
+func (b *Builder) Build(root string) (*MetaInfo, error) {
+	info, files, err := b.layout(root)
+	if err != nil {
+		return nil, err
+	}
+	if b.AlignFiles && info.IsDir() {
+		if info.Files, files, err = alignFiles(info.Files, files, info.PieceLength); err != nil {
+			return nil, err
+		}
+	}
+	if info.Pieces, err = hashPieces(files, info.PieceLength, b.Workers); err != nil {
+		return nil, err
+	}
+	return b.metaInfo(info)
+}
+
+// metaInfo wraps info into a MetaInfo carrying the builder's top-level fields.
+func (b *Builder) metaInfo(info Info) (*MetaInfo, error) {
+	mi := &MetaInfo{
+		Comment:   b.Comment,
+		CreatedBy: b.CreatedBy,
+	}
+	if len(b.AnnounceList) > 0 && len(b.AnnounceList[0]) > 0 {
+		mi.Announce = b.AnnounceList[0][0]
+	}
+	if len(flatten(b.AnnounceList)) > 1 {
+		mi.AnnounceList = b.AnnounceList
+	}
+	if !b.CreationDate.IsZero() {
+		mi.CreationDate = b.CreationDate.Unix()
+	}
+	if err := mi.SetInfo(info); err != nil {
+		return nil, err
+	}
+	return mi, nil
+}
+
+// source is a file of the torrent content on disk, or padding when path is empty.
+type source struct {
+	path   string
+	length int64
+}
+
+func (s source) open() (io.ReadCloser, error) {
+	if s.path == "" {
+		return io.NopCloser(io.LimitReader(zeroReader{}, s.length)), nil
+	}
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	return &sizedFile{File: f, path: s.path, length: s.length, left: s.length}, nil
+}
+
+// sizedFile reads a file of the content as long as it was when the torrent
+// was laid out, and fails if it has since grown or shrunk, as its hashes
+// would no longer match the length recorded for it.
+type sizedFile struct {
+	*os.File
+	path         string
+	length, left int64
+}
+
+func (f *sizedFile) Read(p []byte) (int, error) {
+	if f.left == 0 {
+		var b [1]byte
+		if n, _ := f.File.Read(b[:]); n > 0 {
+			return 0, fmt.Errorf("metainfo: %s grew past %d bytes while being read", f.path, f.length)
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > f.left {
+		p = p[:f.left]
+	}
+	n, err := f.File.Read(p)
+	f.left -= int64(n)
+	if err == io.EOF {
+		err = fmt.Errorf("metainfo: %s shrank to %d bytes from %d while being read", f.path, f.length-f.left, f.length)
+	}
+	return n, err
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// layout returns the info dictionary of root without piece hashes, and its
+// files in torrent order.
+func (b *Builder) layout(root string) (Info, []source, error) {
+	root = filepath.Clean(root)
+	st, err := os.Stat(root)
+	if err != nil {
+		return Info{}, nil, err
+	}
+	info := Info{Name: filepath.Base(root), Source: b.Source}
+	if !validPathElement(info.Name) {
+		return Info{}, nil, fmt.Errorf("metainfo: invalid name %q", info.Name)
+	}
+	if b.Private {
+		private := true
+		info.Private = &private
+	}
+
+	var (
+		files []source
+		total int64
+	)
+	if st.Mode().IsRegular() {
+		info.Length, total = st.Size(), st.Size()
+		files = []source{{root, st.Size()}}
+	} else {
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return err
+			}
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			info.Files = append(info.Files, FileInfo{Length: fi.Size(), Path: strings.Split(filepath.ToSlash(rel), "/")})
+			files = append(files, source{path, fi.Size()})
+			total += fi.Size()
+			return nil
+		})
+		if err != nil {
+			return Info{}, nil, err
+		}
+		if len(info.Files) == 0 {
+			return Info{}, nil, errors.New("metainfo: directory contains no files")
+		}
+	}
+
+	info.PieceLength = b.PieceLength
+	if info.PieceLength == 0 {
+		info.PieceLength = DefaultPieceLength(total)
+	}
+	if info.PieceLength < 0 {
+		return Info{}, nil, fmt.Errorf("metainfo: invalid piece length %d", info.PieceLength)
+	}
+	if err = info.ValidatePaths(); err != nil {
+		return Info{}, nil, err
+	}
+	return info, files, nil
+}
+
+// hashPieces hashes the concatenation of the files into SHA-1 pieces of the
+// given length. The pieces are read in order by one goroutine and hashed by
+// workers others; a read-ahead window of 2*workers buffers bounds the memory.
+func hashPieces(files []source, pieceLength int64, workers int) ([]byte, error) {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	type job struct {
+		buf []byte
+		sum *[sha1.Size]byte
+	}
+	var (
+		sums []*[sha1.Size]byte
+		jobs = make(chan job, workers)
+		free = make(chan []byte, 2*workers)
+		wg   sync.WaitGroup
+	)
+	// The window starts as empty tokens; buffers are allocated on first use.
+	for i := 0; i < cap(free); i++ {
+		free <- nil
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				*j.sum = sha1.Sum(j.buf)
+				free <- j.buf[:cap(j.buf)]
+			}
+		}()
+	}
+	err := readPieces(files, pieceLength, free, func(buf []byte) {
+		sum := new([sha1.Size]byte)
+		sums = append(sums, sum)
+		jobs <- job{buf, sum}
+	})
+	close(jobs)
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	pieces := make([]byte, 0, len(sums)*sha1.Size)
+	for _, sum := range sums {
+		pieces = append(pieces, sum[:]...)
+	}
+	return pieces, nil
+}
+
+// readPieces reads the concatenation of the files in pieces of the given
+// length and hands each to emit, in order, in a buffer taken from free.
+func readPieces(files []source, pieceLength int64, free chan []byte, emit func([]byte)) error {
+	take := func() []byte {
+		if buf := <-free; buf != nil {
+			return buf
+		}
+		return make([]byte, pieceLength)
+	}
+	buf, n := take(), 0
+	for _, file := range files {
+		f, err := file.open()
+		if err != nil {
+			return err
+		}
+		for {
+			m, err := io.ReadFull(f, buf[n:])
+			n += m
+			if n == len(buf) {
+				emit(buf)
+				buf, n = take(), 0
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			if err != nil {
+				_ = f.Close()
+				return err
+			}
+		}
+		if err = f.Close(); err != nil {
+			return err
+		}
+	}
+	if n > 0 {
+		emit(buf[:n])
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+//go:build !bencode_lite
+
+package metainfo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadPiecesLengthChanged(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "data")
+	if err := os.WriteFile(name, make([]byte, 100), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, length := range []int64{99, 101} {
+		free := make(chan []byte, 1)
+		free <- nil
+		err := readPieces([]source{{name, length}}, 64, free, func(buf []byte) { free <- nil })
+		if err == nil {
+			t.Errorf("readPieces of a 100-byte file listed with %d bytes succeeded", length)
+		}
+	}
+	free := make(chan []byte, 1)
+	free <- nil
+	var n int
+	err := readPieces([]source{{name, 100}}, 64, free, func(buf []byte) { n += len(buf); free <- nil })
+	if err != nil || n != 100 {
+		t.Fatalf("readPieces = %d bytes, %v; want 100", n, err)
+	}
+}
+
+func TestBuildPrivateIsCopied(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "data")
+	if err := os.WriteFile(name, []byte("content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	b := &Builder{Private: true}
+	info, _, err := b.layout(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Private = false
+	if info.Private == nil || !*info.Private {
+		t.Fatal("changing the Builder changed an Info it laid out")
+	}
+}
+
+func TestSourceOpenGrown(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "data")
+	if err := os.WriteFile(name, make([]byte, 100), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := source{name, 50}.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	buf := make([]byte, 200)
+	n, _ := r.Read(buf)
+	if _, err = r.Read(buf); n != 50 || err == nil || !strings.Contains(err.Error(), "grew") {
+		t.Fatalf("read %d bytes then %v, want 50 and an error", n, err)
+	}
+}
@@ -0,0 +1,144 @@
+//go:build !bencode_lite
+
+package metainfo
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"time"
+
+	"go.x2ox.com/bencode"
+)
+
+// Editor changes the fields of an encoded .torrent outside its info dictionary.
+//
+// Decoding into MetaInfo and encoding again drops keys MetaInfo does not know
+// and may normalize the info dictionary, which changes the infohash. Editor
+// works on the encoded document instead: the info dictionary and every key it
+// is not asked to change are copied byte for byte.
+type Editor struct {
+	doc  bencode.Value
+	info []byte
+}
+
+// NewEditor returns an editor for the encoded .torrent in data.
+func NewEditor(data []byte) (*Editor, error) {
+	doc, err := bencode.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Kind() != bencode.DictKind {
+		return nil, errors.New("metainfo: torrent is not a dict")
+	}
+	info := doc.Get("info")
+	if !info.Exists() {
+		return nil, errors.New("metainfo: torrent has no info dict")
+	}
+	return &Editor{doc: doc, info: info.Raw()}, nil
+}
+
+// Set stores the encoding of value under key, or removes key if value is nil.
+// The info dictionary cannot be changed.
+func (e *Editor) Set(key string, value interface{}) error {
+	if key == "info" {
+		return errors.New("metainfo: the info dict cannot be edited without changing the infohash")
+	}
+	if value == nil {
+		e.doc.Delete(key)
+		return nil
+	}
+	v, err := bencode.ValueOf(value)
+	if err != nil {
+		return err
+	}
+	e.doc.Set(key, v)
+	return nil
+}
+
+// setString stores s under key, or removes key if s is empty.
+func (e *Editor) setString(key, s string) {
+	if s == "" {
+		e.doc.Delete(key)
+		return
+	}
+	e.doc.Set(key, bencode.NewString(s))
+}
+
+// SetAnnounce sets the announce URL; an empty url removes it.
+func (e *Editor) SetAnnounce(url string) { e.setString("announce", url) }
+
+// SetComment sets the comment; an empty comment removes it.
+func (e *Editor) SetComment(comment string) { e.setString("comment", comment) }
+
+// SetCreatedBy sets the name of the creating program; an empty name removes it.
+func (e *Editor) SetCreatedBy(createdBy string) { e.setString("created by", createdBy) }
+
+// SetCreationDate sets the creation date; the zero time removes it.
+func (e *Editor) SetCreationDate(t time.Time) {
+	if t.IsZero() {
+		e.doc.Delete("creation date")
+		return
+	}
+	e.doc.Set("creation date", bencode.NewInt(t.Unix()))
+}
+
+// SetAnnounceList replaces the tracker tiers; an empty list removes them.
+func (e *Editor) SetAnnounceList(al AnnounceList) error {
+	if len(al.Trackers()) == 0 {
+		return e.Set("announce-list", nil)
+	}
+	return e.Set("announce-list", al)
+}
+
+// SetWebSeeds replaces the BEP 19 web seeds; an empty list removes them.
+func (e *Editor) SetWebSeeds(urls URLList) error {
+	if len(urls) == 0 {
+		return e.Set("url-list", nil)
+	}
+	return e.Set("url-list", urls)
+}
+
+// SetTrackers sets announce to the first tracker and, if there is more than
+// one tracker, announce-list to tiers, as Builder does.
+func (e *Editor) SetTrackers(tiers AnnounceList) error {
+	trackers := tiers.Trackers()
+	if len(trackers) == 0 {
+		e.SetAnnounce("")
+		return e.SetAnnounceList(nil)
+	}
+	e.SetAnnounce(trackers[0])
+	if len(trackers) == 1 {
+		return e.SetAnnounceList(nil)
+	}
+	return e.SetAnnounceList(tiers)
+}
+
+// InfoHash returns the v1 infohash, which no edit changes.
+func (e *Editor) InfoHash() Hash {
+	return sha1.Sum(e.info)
+}
+
+// Bytes returns the edited .torrent. It fails rather than return a document
+// whose info dictionary differs from the original one.
+func (e *Editor) Bytes() ([]byte, error) {
+	out := e.doc.Raw()
+	info, err := ExtractInfoBytes(out)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(info, e.info) {
+		return nil, errors.New("metainfo: edit changed the info dict")
+	}
+	return out, nil
+}
+
+// SaveFile writes the edited .torrent into the file with the given name,
+// replacing it atomically; see bencode.EncodeFile.
+func (e *Editor) SaveFile(name string) error {
+	out, err := e.Bytes()
+	if err != nil {
+		return err
+	}
+	return bencode.EncodeFile(name, bencode.RawMessage(out), 0o644)
+}
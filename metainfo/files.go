@@ -0,0 +1,174 @@
+//go:build !bencode_lite
+
+package metainfo
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// File is one file of a torrent in the unified view returned by Info.FileList.
+//
+// Path is relative to the torrent directory Name for multi-file torrents and
+// is just Name for single-file torrents, as in FilesV2. Offset is the position
+// of the file's first byte in the concatenated torrent content.
+type File struct {
+	Path    []string
+	Length  int64
+	Offset  int64
+	Padding bool
+}
+
+// FileList returns the files of the torrent whatever its layout: the single
+// file of a single-file torrent, the files list of a multi-file torrent
+// including its padding files, or the file tree of a v2-only torrent, whose
+// files all start on a piece boundary.
+func (info *Info) FileList() []File {
+	switch {
+	case info.IsDir():
+		files := make([]File, len(info.Files))
+		var off int64
+		for i, f := range info.Files {
+			files[i] = File{Path: f.Path, Length: f.Length, Offset: off, Padding: f.IsPadding()}
+			off += f.Length
+		}
+		return files
+	case len(info.Pieces) == 0 && info.IsV2():
+		var (
+			files []File
+			off   int64
+		)
+		for _, f := range info.FilesV2() {
+			files = append(files, File{Path: f.Path, Length: f.Length, Offset: off})
+			off += f.Length
+			if info.PieceLength > 0 {
+				off += padLength(f.Length, info.PieceLength)
+			}
+		}
+		return files
+	default:
+		return []File{{Path: []string{info.Name}, Length: info.Length}}
+	}
+}
+
+// ValidatePaths checks that Name and the path elements of every file can be
+// joined under a directory without leaving it: each must be non-empty, not
+// "." or "..", and free of path separators and volume names. Verify relies on
+// it, and Builder holds the torrents it creates to it.
+func (info *Info) ValidatePaths() error {
+	if !validPathElement(info.Name) {
+		return fmt.Errorf("metainfo: invalid name %q", info.Name)
+	}
+	for i, f := range info.FileList() {
+		if len(f.Path) == 0 {
+			return fmt.Errorf("metainfo: file %d has an empty path", i)
+		}
+		for _, e := range f.Path {
+			if !validPathElement(e) {
+				return fmt.Errorf("metainfo: file %d has an invalid path element %q", i, e)
+			}
+		}
+	}
+	return nil
+}
+
+// validPathElement reports whether s names a file or directory within its
+// parent directory on every platform.
+func validPathElement(s string) bool {
+	return s != "" && s != "." && s != ".." &&
+		!strings.ContainsAny(s, "/\\\x00") && filepath.VolumeName(s) == ""
+}
+
+// TotalLength returns the size of the torrent content, including padding.
+func (info *Info) TotalLength() int64 {
+	files := info.FileList()
+	if len(files) == 0 {
+		return 0
+	}
+	last := files[len(files)-1]
+	return last.Offset + last.Length
+}
+
+// NumPieces returns the number of pieces of the torrent content.
+func (info *Info) NumPieces() int {
+	if info.PieceLength <= 0 {
+		return 0
+	}
+	return int((info.TotalLength() + info.PieceLength - 1) / info.PieceLength)
+}
+
+// PieceSize returns the size of piece i, which is smaller than PieceLength for
+// the last piece, or 0 if i is out of range.
+func (info *Info) PieceSize(i int) int64 {
+	if i < 0 || i >= info.NumPieces() {
+		return 0
+	}
+	start := int64(i) * info.PieceLength
+	if end := info.TotalLength(); end-start < info.PieceLength {
+		return end - start
+	}
+	return info.PieceLength
+}
+
+// FileSpan is the part of a file that a piece covers.
+type FileSpan struct {
+	// File is the index of the file in FileList.
+	File int
+	// Offset is the position of the span within the file.
+	Offset int64
+	Length int64
+}
+
+// PieceFiles returns the parts of the files that piece i covers, in order.
+// Empty files are not listed. It returns nil if i is out of range.
+func (info *Info) PieceFiles(i int) []FileSpan {
+	size := info.PieceSize(i)
+	if size == 0 {
+		return nil
+	}
+	files := info.FileList()
+	start := int64(i) * info.PieceLength
+	end := start + size
+
+	j := sort.Search(len(files), func(j int) bool { return files[j].Offset+files[j].Length > start })
+	var spans []FileSpan
+	for ; j < len(files) && files[j].Offset < end; j++ {
+		f := files[j]
+		if f.Length == 0 {
+			continue
+		}
+		lo, hi := max64(start, f.Offset), min64(end, f.Offset+f.Length)
+		spans = append(spans, FileSpan{File: j, Offset: lo - f.Offset, Length: hi - lo})
+	}
+	return spans
+}
+
+// FilePieces returns the range [begin, end) of the pieces that hold file i of FileList.
+func (info *Info) FilePieces(i int) (begin, end int) {
+	files := info.FileList()
+	if i < 0 || i >= len(files) || info.PieceLength <= 0 {
+		return 0, 0
+	}
+	f := files[i]
+	begin = int(f.Offset / info.PieceLength)
+	if f.Length == 0 {
+		return begin, begin
+	}
+	return begin, int((f.Offset + f.Length + info.PieceLength - 1) / info.PieceLength)
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,53 @@
+//go:build !bencode_lite
+
+package metainfo
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"go.x2ox.com/bencode"
+)
+
+// Hash is a v1 infohash: the SHA-1 digest of the bencoded info dictionary.
+type Hash [20]byte
+
+// HexString returns h as 40 lowercase hex digits.
+func (h Hash) HexString() string { return hex.EncodeToString(h[:]) }
+
+func (h Hash) String() string { return h.HexString() }
+
+// HashV2 is a v2 infohash (BEP 52): the SHA-256 digest of the bencoded info dictionary.
+type HashV2 [32]byte
+
+// HexString returns h as 64 lowercase hex digits.
+func (h HashV2) HexString() string { return hex.EncodeToString(h[:]) }
+
+func (h HashV2) String() string { return h.HexString() }
+
+// Truncated returns the first 20 bytes of h, which stand in for the v2
+// infohash in places sized for v1 hashes, such as the tracker and peer protocols.
+func (h HashV2) Truncated() Hash {
+	var t Hash
+	copy(t[:], h[:])
+	return t
+}
+
+// HashInfoBytes returns the v1 infohash, computed over the info dictionary
+// exactly as it was decoded rather than over a re-encoding of it.
+func (mi *MetaInfo) HashInfoBytes() Hash {
+	return sha1.Sum(mi.InfoBytes)
+}
+
+// HashInfoBytesV2 returns the v2 infohash, computed over the info dictionary
+// exactly as it was decoded rather than over a re-encoding of it.
+func (mi *MetaInfo) HashInfoBytesV2() HashV2 {
+	return sha256.Sum256(mi.InfoBytes)
+}
+
+// ExtractInfoBytes returns the verbatim info dictionary of the encoded .torrent
+// in data without decoding the rest of it. The result aliases data.
+func ExtractInfoBytes(data []byte) ([]byte, error) {
+	return bencode.ExtractRawField(data, "info")
+}
@@ -0,0 +1,256 @@
+//go:build !bencode_lite
+
+package metainfo
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BlockSize is the size of the leaves of v2 merkle trees.
+const BlockSize = 16 << 10
+
+// InfoHashes returns both the v1 and the v2 infohash of a hybrid torrent.
+func (mi *MetaInfo) InfoHashes() (Hash, HashV2) {
+	return mi.HashInfoBytes(), mi.HashInfoBytesV2()
+}
+
+// BuildHybrid creates a hybrid torrent for root that carries both the v1
+// pieces and the v2 file tree and piece layers (BEP 52), so that v1-only and
+// v2-only clients can share the same swarm. In the v1 file list every file but
+// the last is followed by a padding file (BEP 47) that aligns the next file to
+// a piece boundary, as v2 requires.
+func (b *Builder) BuildHybrid(root string) (*MetaInfo, error) {
+	info, files, err := b.layout(root)
+	if err != nil {
+		return nil, err
+	}
+	if info.PieceLength < BlockSize || info.PieceLength&(info.PieceLength-1) != 0 {
+		return nil, fmt.Errorf("metainfo: piece length %d is not a power of two of at least %d", info.PieceLength, BlockSize)
+	}
+
+	info.MetaVersion = 2
+	layers := make(PieceLayers)
+	if info.IsDir() {
+		info.FileTree.Dir = make(map[string]*FileTree)
+	}
+	for i, src := range files {
+		root, layer, err := hashFileV2(src, info.PieceLength)
+		if err != nil {
+			return nil, err
+		}
+		ft := &FileTreeFile{Length: src.length}
+		if src.length > 0 {
+			ft.PiecesRoot = root[:]
+		}
+		if len(layer) > 0 {
+			layers[root] = layer
+		}
+
+		if !info.IsDir() {
+			info.FileTree.Dir = map[string]*FileTree{info.Name: {File: ft}}
+			break
+		}
+		info.FileTree.insert(info.Files[i].Path, ft)
+	}
+	if info.IsDir() {
+		if info.Files, files, err = alignFiles(info.Files, files, info.PieceLength); err != nil {
+			return nil, err
+		}
+	}
+	if info.Pieces, err = hashPieces(files, info.PieceLength, b.Workers); err != nil {
+		return nil, err
+	}
+
+	mi, err := b.metaInfo(info)
+	if err != nil {
+		return nil, err
+	}
+	if len(layers) > 0 {
+		mi.PieceLayers = layers
+	}
+	return mi, nil
+}
+
+func (ft *FileTree) insert(path []string, f *FileTreeFile) {
+	for _, name := range path {
+		child, ok := ft.Dir[name]
+		if !ok {
+			child = &FileTree{Dir: make(map[string]*FileTree)}
+			ft.Dir[name] = child
+		}
+		ft = child
+	}
+	ft.Dir, ft.File = nil, f
+}
+
+// hashFileV2 computes the merkle root of a file and, for files larger than a
+// piece, its piece layer. It fails if the file no longer has the length it was
+// listed with, which the file tree records.
+func hashFileV2(src source, pieceLength int64) (root [32]byte, layer []byte, err error) {
+	if src.length == 0 {
+		return root, nil, nil
+	}
+	r, err := src.open()
+	if err != nil {
+		return root, nil, err
+	}
+	defer r.Close()
+
+	var (
+		leaves [][32]byte
+		buf    = make([]byte, BlockSize)
+	)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			leaves = append(leaves, sha256.Sum256(buf[:n]))
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return root, nil, err
+		}
+	}
+
+	blocksPerPiece := int(pieceLength / BlockSize)
+	if src.length <= pieceLength {
+		return merkleRoot(leaves, nextPowerOfTwo(len(leaves)), [32]byte{}), nil, nil
+	}
+	var pieces [][32]byte
+	for i := 0; i < len(leaves); i += blocksPerPiece {
+		end := i + blocksPerPiece
+		if end > len(leaves) {
+			end = len(leaves)
+		}
+		h := merkleRoot(leaves[i:end], blocksPerPiece, [32]byte{})
+		pieces = append(pieces, h)
+		layer = append(layer, h[:]...)
+	}
+	padPiece := merkleRoot(nil, blocksPerPiece, [32]byte{})
+	return merkleRoot(pieces, nextPowerOfTwo(len(pieces)), padPiece), layer, nil
+}
+
+// merkleRoot returns the root of the binary SHA-256 tree over width leaves:
+// the given hashes followed by pad.
+func merkleRoot(hashes [][32]byte, width int, pad [32]byte) [32]byte {
+	layer := make([][32]byte, width)
+	copy(layer, hashes)
+	for i := len(hashes); i < width; i++ {
+		layer[i] = pad
+	}
+	var pair [64]byte
+	for len(layer) > 1 {
+		for i := 0; i < len(layer)/2; i++ {
+			copy(pair[:32], layer[2*i][:])
+			copy(pair[32:], layer[2*i+1][:])
+			layer[i] = sha256.Sum256(pair[:])
+		}
+		layer = layer[:len(layer)/2]
+	}
+	return layer[0]
+}
+
+func nextPowerOfTwo(n int) int {
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
+
+// ValidateHybrid checks that a hybrid torrent is consistent: its paths pass
+// ValidatePaths, both layouts are present, they list the same files in the same order, every file of the v1
+// list starts on a piece boundary with correctly sized padding files between
+// them, the v1 pieces cover the whole content, and every file larger than a
+// piece has a piece layer of the right size.
+func (mi *MetaInfo) ValidateHybrid() error {
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return err
+	}
+	if !info.IsV2() {
+		return errors.New("metainfo: meta version is not 2")
+	}
+	if info.PieceLength <= 0 {
+		return fmt.Errorf("metainfo: invalid piece length %d", info.PieceLength)
+	}
+	if len(info.Pieces) == 0 {
+		return errors.New("metainfo: hybrid torrent has no v1 pieces")
+	}
+	if err = info.ValidatePaths(); err != nil {
+		return err
+	}
+	v2 := info.FilesV2()
+	if len(v2) == 0 {
+		return errors.New("metainfo: hybrid torrent has no v2 file tree")
+	}
+
+	v1 := info.Files
+	if !info.IsDir() {
+		v1 = []FileInfo{{Length: info.Length, Path: []string{info.Name}}}
+	}
+	var (
+		offset int64
+		j      int
+	)
+	for i, f := range v1 {
+		if f.IsPadding() {
+			continue
+		}
+		if offset%info.PieceLength != 0 {
+			return fmt.Errorf("metainfo: v1 file %d starts at offset %d, not on a piece boundary", i, offset)
+		}
+		if j >= len(v2) {
+			return fmt.Errorf("metainfo: v1 file %d is missing from the v2 file tree", i)
+		}
+		want := v2[j]
+		if f.Length != want.Length || (info.IsDir() && !equalPaths(f.Path, want.Path)) {
+			return fmt.Errorf("metainfo: v1 file %d does not match v2 file %d", i, j)
+		}
+		offset += f.Length
+		if i+1 < len(v1) {
+			pad := padLength(f.Length, info.PieceLength)
+			if pad > 0 && (!v1[i+1].IsPadding() || v1[i+1].Length != pad) {
+				return fmt.Errorf("metainfo: v1 file %d is not followed by %d bytes of padding", i, pad)
+			}
+			offset += pad
+		}
+		j++
+	}
+	if j != len(v2) {
+		return fmt.Errorf("metainfo: v2 file tree has %d files, v1 list has %d", len(v2), j)
+	}
+	if pieces := (offset + info.PieceLength - 1) / info.PieceLength; int64(len(info.Pieces)) != pieces*20 {
+		return fmt.Errorf("metainfo: %d bytes of v1 pieces for %d pieces", len(info.Pieces), pieces)
+	}
+
+	for _, f := range v2 {
+		if f.Length <= info.PieceLength {
+			continue
+		}
+		layer, ok := mi.PieceLayers[f.PiecesRoot]
+		if !ok {
+			return fmt.Errorf("metainfo: no piece layer for %v", f.Path)
+		}
+		if pieces := (f.Length + info.PieceLength - 1) / info.PieceLength; int64(len(layer)) != pieces*32 {
+			return fmt.Errorf("metainfo: piece layer of %v has %d bytes, want %d", f.Path, len(layer), pieces*32)
+		}
+	}
+	return nil
+}
+
+func equalPaths(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,142 @@
+//go:build !bencode_lite
+
+package metainfo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.x2ox.com/bencode"
+)
+
+// pair hashes two nodes of a v2 merkle tree into their parent.
+func pair(a, b [32]byte) [32]byte {
+	return sha256.Sum256(append(a[:], b[:]...))
+}
+
+// content returns n bytes that differ from block to block.
+func content(n int, seed byte) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = seed + byte(i/BlockSize) + byte(i)
+	}
+	return b
+}
+
+func TestBuildHybridMerkleRoots(t *testing.T) {
+	const pieceLength = 2 * BlockSize
+	var (
+		big   = content(5*BlockSize+100, 1) // 6 blocks in 3 pieces
+		small = content(BlockSize+7, 2)     // 2 blocks in 1 piece
+		tiny  = content(1000, 3)            // 1 block
+	)
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{"big": big, "small": small, "tiny": tiny} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The trees are built by hand as BEP 52 lays them out: leaves are the
+	// hashes of the 16 KiB blocks, and the leaves past the end of a file are
+	// zero, so that a piece past its end hashes to the root of a zero tree.
+	leaves := func(b []byte) (l [][32]byte) {
+		for ; len(b) > BlockSize; b = b[BlockSize:] {
+			l = append(l, sha256.Sum256(b[:BlockSize]))
+		}
+		return append(l, sha256.Sum256(b))
+	}
+	var zero [32]byte
+	lb := leaves(big)
+	p0, p1, p2 := pair(lb[0], lb[1]), pair(lb[2], lb[3]), pair(lb[4], lb[5])
+	wantBigRoot := pair(pair(p0, p1), pair(p2, pair(zero, zero)))
+	wantBigLayer := bytes.Join([][]byte{p0[:], p1[:], p2[:]}, nil)
+	ls := leaves(small)
+	wantSmallRoot := pair(ls[0], ls[1])
+	wantTinyRoot := sha256.Sum256(tiny)
+
+	mi, err := (&Builder{PieceLength: pieceLength}).BuildHybrid(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = mi.ValidateHybrid(); err != nil {
+		t.Fatalf("ValidateHybrid: %v", err)
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][32]byte{"big": wantBigRoot, "small": wantSmallRoot, "tiny": wantTinyRoot}
+	for _, f := range info.FilesV2() {
+		if f.PiecesRoot != want[f.Path[0]] {
+			t.Errorf("pieces root of %s = %x, want %x", f.Path[0], f.PiecesRoot, want[f.Path[0]])
+		}
+	}
+	if len(mi.PieceLayers) != 1 {
+		t.Fatalf("%d piece layers, want 1", len(mi.PieceLayers))
+	}
+	if layer := mi.PieceLayers[wantBigRoot]; !bytes.Equal(layer, wantBigLayer) {
+		t.Errorf("piece layer of big = %x, want %x", layer, wantBigLayer)
+	}
+
+	// The torrent survives encoding, and its v1 side is padded as v2 needs.
+	b, err := bencode.Marshal(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded MetaInfo
+	if err = bencode.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if err = decoded.ValidateHybrid(); err != nil {
+		t.Fatalf("ValidateHybrid after a round trip: %v", err)
+	}
+}
+
+func TestZeroPieceLength(t *testing.T) {
+	files := []FileInfo{{Length: 10, Path: []string{"a"}}, {Length: 10, Path: []string{"b"}}}
+	if _, err := AlignFiles(files, 0); err == nil {
+		t.Error("AlignFiles accepted a zero piece length")
+	}
+	if aligned, err := AlignFiles(files, BlockSize); err != nil || len(aligned) != 3 {
+		t.Errorf("AlignFiles = %v, %v, want a padding file between the files", aligned, err)
+	}
+
+	info := Info{Name: "a", MetaVersion: 2, Pieces: make([]byte, 20), Length: 10}
+	info.FileTree.Dir = map[string]*FileTree{"a": {File: &FileTreeFile{Length: 10}}}
+	b, err := bencode.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = (&MetaInfo{InfoBytes: b}).ValidateHybrid(); err == nil {
+		t.Error("ValidateHybrid accepted a zero piece length")
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		if err = os.WriteFile(filepath.Join(dir, name), []byte("data"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = (&Builder{PieceLength: -BlockSize, AlignFiles: true}).Build(dir); err == nil {
+		t.Error("Build accepted a negative piece length")
+	}
+}
+
+func TestHashFileV2LengthChanged(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "data")
+	if err := os.WriteFile(name, content(3*BlockSize, 1), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, length := range []int64{3*BlockSize - 1, 3*BlockSize + 1, 2 * BlockSize} {
+		if _, _, err := hashFileV2(source{name, length}, 2*BlockSize); err == nil {
+			t.Errorf("hashFileV2 of a %d-byte file listed with %d bytes succeeded", 3*BlockSize, length)
+		}
+	}
+	if _, _, err := hashFileV2(source{name, 3 * BlockSize}, 2*BlockSize); err != nil {
+		t.Fatal(err)
+	}
+}
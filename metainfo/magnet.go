@@ -0,0 +1,245 @@
+//go:build !bencode_lite
+
+package metainfo
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"go.x2ox.com/bencode"
+)
+
+const (
+	xtBTIH = "urn:btih:"
+	xtBTMH = "urn:btmh:"
+
+	// multihashSHA256 is the multihash prefix of a 32-byte SHA-256 digest.
+	multihashSHA256 = "1220"
+)
+
+// Magnet is a parsed magnet link (BEP 9, with the v2 additions of BEP 52).
+type Magnet struct {
+	InfoHash    *Hash   // v1 infohash from xt=urn:btih:
+	InfoHashV2  *HashV2 // v2 infohash from xt=urn:btmh:
+	DisplayName string  // dn
+	Trackers    []string
+	WebSeeds    []string
+	// SelectOnly holds the indexes of the files to download (so, BEP 53).
+	// An empty set selects every file.
+	SelectOnly IndexSet
+	// Params holds every parameter not covered by the fields above,
+	// including exact topics other than BitTorrent infohashes.
+	Params url.Values
+}
+
+// ParseMagnet parses a magnet URI. Trackers and web seeds are kept in the
+// order of the link.
+func ParseMagnet(uri string) (Magnet, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return Magnet{}, err
+	}
+	if u.Scheme != "magnet" {
+		return Magnet{}, fmt.Errorf("metainfo: not a magnet link: scheme %q", u.Scheme)
+	}
+	// ParseQuery checks the query, which is then walked in order, as the
+	// values it returns are grouped by key.
+	if _, err = url.ParseQuery(u.RawQuery); err != nil {
+		return Magnet{}, err
+	}
+
+	m := Magnet{Params: make(url.Values)}
+	for _, kv := range strings.Split(u.RawQuery, "&") {
+		if kv == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(kv, "=")
+		// The query is valid, so unescaping cannot fail.
+		k, _ = url.QueryUnescape(k)
+		v, _ = url.QueryUnescape(v)
+		switch {
+		case k == "xt" || strings.HasPrefix(k, "xt."):
+			ok, err := m.parseExactTopic(v)
+			if err != nil {
+				return Magnet{}, err
+			}
+			if !ok {
+				m.Params.Add(k, v)
+			}
+		case k == "dn":
+			if m.DisplayName == "" {
+				m.DisplayName = v
+			}
+		case k == "tr" || strings.HasPrefix(k, "tr."):
+			m.Trackers = append(m.Trackers, v)
+		case k == "ws":
+			m.WebSeeds = append(m.WebSeeds, v)
+		case k == "so":
+			set, err := ParseIndexSet(v)
+			if err != nil {
+				return Magnet{}, err
+			}
+			m.SelectOnly = append(m.SelectOnly, set...)
+		default:
+			m.Params.Add(k, v)
+		}
+	}
+	m.SelectOnly = m.SelectOnly.normalize()
+	if m.InfoHash == nil && m.InfoHashV2 == nil {
+		return Magnet{}, errors.New("metainfo: magnet link has no BitTorrent infohash")
+	}
+	return m, nil
+}
+
+// parseExactTopic sets the infohash of an xt parameter, or reports false if
+// it is not a BitTorrent one.
+func (m *Magnet) parseExactTopic(xt string) (bool, error) {
+	switch {
+	case strings.HasPrefix(xt, xtBTIH):
+		s := xt[len(xtBTIH):]
+		var (
+			b   []byte
+			err error
+		)
+		switch len(s) {
+		case 40:
+			b, err = hex.DecodeString(s)
+		case 32:
+			b, err = base32.StdEncoding.DecodeString(strings.ToUpper(s))
+		default:
+			err = fmt.Errorf("infohash %q has invalid length %d", s, len(s))
+		}
+		if err != nil {
+			return false, fmt.Errorf("metainfo: invalid btih: %w", err)
+		}
+		var h Hash
+		copy(h[:], b)
+		m.InfoHash = &h
+	case strings.HasPrefix(xt, xtBTMH):
+		s := xt[len(xtBTMH):]
+		if !strings.HasPrefix(s, multihashSHA256) || len(s) != len(multihashSHA256)+64 {
+			return false, fmt.Errorf("metainfo: unsupported btmh multihash %q", s)
+		}
+		b, err := hex.DecodeString(s[len(multihashSHA256):])
+		if err != nil {
+			return false, fmt.Errorf("metainfo: invalid btmh: %w", err)
+		}
+		var h HashV2
+		copy(h[:], b)
+		m.InfoHashV2 = &h
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// String returns m as a magnet URI.
+func (m Magnet) String() string {
+	var params []string
+	if m.InfoHash != nil {
+		params = append(params, "xt="+xtBTIH+m.InfoHash.HexString())
+	}
+	if m.InfoHashV2 != nil {
+		params = append(params, "xt="+xtBTMH+multihashSHA256+m.InfoHashV2.HexString())
+	}
+	if m.DisplayName != "" {
+		params = append(params, "dn="+url.QueryEscape(m.DisplayName))
+	}
+	for _, tr := range m.Trackers {
+		params = append(params, "tr="+url.QueryEscape(tr))
+	}
+	for _, ws := range m.WebSeeds {
+		params = append(params, "ws="+url.QueryEscape(ws))
+	}
+	if len(m.SelectOnly) > 0 {
+		params = append(params, "so="+m.SelectOnly.String())
+	}
+	if len(m.Params) > 0 {
+		params = append(params, m.Params.Encode())
+	}
+	return "magnet:?" + strings.Join(params, "&")
+}
+
+// Magnet returns a magnet link for the torrent with the given decoded info
+// dictionary, carrying its infohashes, name, trackers and web seeds: the v1
+// infohash unless the torrent is v2 only, and the v2 one if it has v2
+// metadata, so that hybrid torrents get both.
+func (mi *MetaInfo) Magnet(info *Info) Magnet {
+	m := Magnet{DisplayName: info.Name}
+	if !info.IsV2() || len(info.Pieces) > 0 {
+		h := mi.HashInfoBytes()
+		m.InfoHash = &h
+	}
+	if info.IsV2() {
+		h := mi.HashInfoBytesV2()
+		m.InfoHashV2 = &h
+	}
+	seen := make(map[string]bool)
+	for _, tr := range append([]string{mi.Announce}, flatten(mi.AnnounceList)...) {
+		if tr != "" && !seen[tr] {
+			seen[tr] = true
+			m.Trackers = append(m.Trackers, tr)
+		}
+	}
+	m.WebSeeds = append(m.WebSeeds, mi.URLList...)
+	return m
+}
+
+func flatten(tiers [][]string) []string {
+	var l []string
+	for _, tier := range tiers {
+		l = append(l, tier...)
+	}
+	return l
+}
+
+// MetaInfo returns a skeleton MetaInfo for m: its trackers and web seeds, and
+// its infohashes as PendingInfoHash and PendingInfoHashV2 in place of the
+// info dictionary, which is to be fetched from peers (BEP 9) and filled in
+// with CompleteInfo. Every tracker of m forms a tier of its own. A skeleton
+// cannot be encoded before its info dictionary is complete.
+func (m Magnet) MetaInfo() *MetaInfo {
+	mi := &MetaInfo{
+		PendingInfoHash:   m.InfoHash,
+		PendingInfoHashV2: m.InfoHashV2,
+		URLList:           append(URLList(nil), m.WebSeeds...),
+	}
+	if len(m.Trackers) > 0 {
+		mi.Announce = m.Trackers[0]
+	}
+	if len(m.Trackers) > 1 {
+		for _, tr := range m.Trackers {
+			mi.AnnounceList = append(mi.AnnounceList, []string{tr})
+		}
+	}
+	return mi
+}
+
+// HasInfo reports whether the info dictionary of mi is known.
+func (mi *MetaInfo) HasInfo() bool {
+	return len(mi.InfoBytes) > 0
+}
+
+// CompleteInfo sets the info dictionary of a skeleton to a copy of infoBytes,
+// the metadata fetched from peers, after checking it against the pending
+// infohashes. The pending infohashes are cleared on success.
+func (mi *MetaInfo) CompleteInfo(infoBytes []byte) error {
+	if mi.PendingInfoHash == nil && mi.PendingInfoHashV2 == nil {
+		return errors.New("metainfo: no pending infohash to check the info dict against")
+	}
+	if h := mi.PendingInfoHash; h != nil && sha1.Sum(infoBytes) != *h {
+		return fmt.Errorf("metainfo: info dict does not match infohash %s", h)
+	}
+	if h := mi.PendingInfoHashV2; h != nil && sha256.Sum256(infoBytes) != *h {
+		return fmt.Errorf("metainfo: info dict does not match v2 infohash %s", h)
+	}
+	mi.InfoBytes = append(bencode.RawMessage(nil), infoBytes...)
+	mi.PendingInfoHash, mi.PendingInfoHashV2 = nil, nil
+	return nil
+}
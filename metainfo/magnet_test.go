@@ -0,0 +1,78 @@
+//go:build !bencode_lite
+
+package metainfo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.x2ox.com/bencode"
+)
+
+const testBTIH = "xt=urn:btih:c12fe1c06bba254a9dc9f519b335aa7c1367a88a"
+
+func TestParseMagnetTrackerOrder(t *testing.T) {
+	want := []string{"udp://c", "udp://a", "udp://d", "udp://b"}
+	for i := 0; i < 20; i++ {
+		m, err := ParseMagnet("magnet:?" + testBTIH + "&tr.1=udp%3A%2F%2Fc&tr=udp%3A%2F%2Fa&tr.2=udp%3A%2F%2Fd&tr=udp%3A%2F%2Fb")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(m.Trackers, want) {
+			t.Fatalf("Trackers = %v, want %v", m.Trackers, want)
+		}
+	}
+}
+
+func TestParseMagnetUnknownTopic(t *testing.T) {
+	m, err := ParseMagnet("magnet:?" + testBTIH + "&xt=urn:ed2k:354b15e68fb8f36d7cd88ff94116cdc1&xt.2=urn:sha1:ABC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Params["xt"]; !reflect.DeepEqual(got, []string{"urn:ed2k:354b15e68fb8f36d7cd88ff94116cdc1"}) {
+		t.Errorf(`Params["xt"] = %v`, got)
+	}
+	if got := m.Params["xt.2"]; !reflect.DeepEqual(got, []string{"urn:sha1:ABC"}) {
+		t.Errorf(`Params["xt.2"] = %v`, got)
+	}
+	if s := m.String(); !strings.Contains(s, "urn%3Aed2k%3A") {
+		t.Errorf("String() = %q drops the unknown exact topic", s)
+	}
+	if _, err = ParseMagnet("magnet:?xt=urn:ed2k:354b15e68fb8f36d7cd88ff94116cdc1"); err == nil {
+		t.Error("magnet link without a BitTorrent infohash parsed")
+	}
+}
+
+func TestMetaInfoMagnetVersions(t *testing.T) {
+	tests := []struct {
+		name           string
+		info           Info
+		wantV1, wantV2 bool
+	}{
+		{"v1", Info{Name: "a", PieceLength: 16384, Pieces: make([]byte, 20), Length: 1}, true, false},
+		{"v2", Info{Name: "a", PieceLength: 16384, MetaVersion: 2}, false, true},
+		{"hybrid", Info{Name: "a", PieceLength: 16384, Pieces: make([]byte, 20), Length: 1, MetaVersion: 2}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := bencode.Marshal(tt.info)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mi := &MetaInfo{InfoBytes: b}
+			m := mi.Magnet(&tt.info)
+			if (m.InfoHash != nil) != tt.wantV1 || (m.InfoHashV2 != nil) != tt.wantV2 {
+				t.Fatalf("InfoHash set %v, InfoHashV2 set %v", m.InfoHash != nil, m.InfoHashV2 != nil)
+			}
+			if tt.wantV2 {
+				if *m.InfoHashV2 != mi.HashInfoBytesV2() {
+					t.Error("InfoHashV2 is not the v2 infohash")
+				}
+				if !strings.Contains(m.String(), "xt=urn:btmh:1220") {
+					t.Errorf("String() = %q lacks urn:btmh", m.String())
+				}
+			}
+		})
+	}
+}
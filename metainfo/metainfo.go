@@ -0,0 +1,116 @@
+//go:build !bencode_lite
+
+// Package metainfo provides the structures of BitTorrent metainfo (.torrent)
+// files as described by BEP 3, encoded and decoded with go.x2ox.com/bencode.
+package metainfo
+
+import (
+	"io"
+	"os"
+
+	"go.x2ox.com/bencode"
+)
+
+// MetaInfo is the top-level dictionary of a .torrent file.
+//
+// The info dictionary is kept as the exact bytes found in the input, since
+// those bytes identify the torrent; use UnmarshalInfo to decode it.
+type MetaInfo struct {
+	Announce     string             `bencode:"announce,omitempty"`
+	AnnounceList AnnounceList       `bencode:"announce-list,omitempty"`
+	Comment      string             `bencode:"comment,omitempty,utf8"`
+	CreatedBy    string             `bencode:"created by,omitempty,utf8"`
+	CreationDate int64              `bencode:"creation date,omitempty"`
+	Encoding     string             `bencode:"encoding,omitempty"`
+	InfoBytes    bencode.RawMessage `bencode:"info"`
+	PieceLayers  PieceLayers        `bencode:"piece layers,omitempty"`
+	URLList      URLList            `bencode:"url-list,omitempty"`
+	HTTPSeeds    URLList            `bencode:"httpseeds,omitempty"`
+	Nodes        Nodes              `bencode:"nodes,omitempty"`
+	Signatures   Signatures         `bencode:"signatures,omitempty"`
+
+	// PendingInfoHash and PendingInfoHashV2 identify the torrent of a
+	// skeleton created from a magnet link until its info dictionary is
+	// known; see Magnet.MetaInfo. They are not encoded.
+	PendingInfoHash   *Hash   `bencode:"-"`
+	PendingInfoHashV2 *HashV2 `bencode:"-"`
+}
+
+// Info is the info dictionary of a .torrent file. Single-file torrents set
+// Length, multi-file torrents set Files and use Name as the directory name.
+// v2 torrents (BEP 52) set MetaVersion to 2 and describe their files in FileTree;
+// hybrid torrents carry both layouts.
+type Info struct {
+	Name        string     `bencode:"name"`
+	NameUTF8    string     `bencode:"name.utf-8,omitempty,utf8"`
+	PieceLength int64      `bencode:"piece length"`
+	Pieces      []byte     `bencode:"pieces,omitempty"`
+	Private     *bool      `bencode:"private,omitempty"`
+	Source      string     `bencode:"source,omitempty"`
+	Length      int64      `bencode:"length,omitempty"`
+	MD5Sum      string     `bencode:"md5sum,omitempty"`
+	Files       []FileInfo `bencode:"files,omitempty"`
+	MetaVersion int64      `bencode:"meta version,omitempty"`
+	FileTree    FileTree   `bencode:"file tree,omitempty"`
+}
+
+// FileInfo describes one file of a multi-file torrent.
+type FileInfo struct {
+	Length   int64    `bencode:"length"`
+	Path     []string `bencode:"path"`
+	PathUTF8 []string `bencode:"path.utf-8,omitempty,utf8"`
+	MD5Sum   string   `bencode:"md5sum,omitempty"`
+	Attr     string   `bencode:"attr,omitempty"`
+}
+
+// Load decodes a MetaInfo from r.
+func Load(r io.Reader) (*MetaInfo, error) {
+	var mi MetaInfo
+	if err := bencode.NewDecoder(r).Decode(&mi); err != nil {
+		return nil, err
+	}
+	return &mi, nil
+}
+
+// LoadFile decodes the .torrent file with the given name.
+func LoadFile(name string) (*MetaInfo, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// Write encodes mi to w.
+func (mi *MetaInfo) Write(w io.Writer) error {
+	return bencode.NewEncoder(w).Encode(mi)
+}
+
+// SaveFile encodes mi into the file with the given name, replacing it
+// atomically; see bencode.EncodeFile.
+func (mi *MetaInfo) SaveFile(name string) error {
+	return bencode.EncodeFile(name, mi, 0o644)
+}
+
+// UnmarshalInfo decodes the info dictionary.
+func (mi *MetaInfo) UnmarshalInfo() (Info, error) {
+	var info Info
+	err := bencode.Unmarshal(mi.InfoBytes, &info)
+	return info, err
+}
+
+// SetInfo encodes info and stores it as the info dictionary.
+func (mi *MetaInfo) SetInfo(info Info) error {
+	b, err := bencode.Marshal(info)
+	if err != nil {
+		return err
+	}
+	mi.InfoBytes = b
+	return nil
+}
+
+// IsDir reports whether the torrent describes a directory of files rather than a single file.
+func (info *Info) IsDir() bool {
+	return len(info.Files) != 0
+}
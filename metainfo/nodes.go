@@ -0,0 +1,89 @@
+//go:build !bencode_lite
+
+package metainfo
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"go.x2ox.com/bencode"
+)
+
+// Node is a DHT node that a trackerless torrent suggests for bootstrapping (BEP 5).
+type Node struct {
+	Host string
+	Port uint16
+}
+
+// String returns the node as host:port.
+func (n Node) String() string {
+	return net.JoinHostPort(n.Host, strconv.Itoa(int(n.Port)))
+}
+
+// Validate checks that n has a host and a non-zero port.
+func (n Node) Validate() error {
+	if n.Host == "" {
+		return fmt.Errorf("metainfo: node %s has no host", n)
+	}
+	if n.Port == 0 {
+		return fmt.Errorf("metainfo: node %s has no port", n)
+	}
+	return nil
+}
+
+// MarshalBencode encodes n as a [host, port] list.
+func (n Node) MarshalBencode() ([]byte, error) {
+	return bencode.Marshal([]interface{}{n.Host, int64(n.Port)})
+}
+
+// UnmarshalBencode decodes a [host, port] list. The port may be an integer or,
+// as written by some tools, a decimal string.
+func (n *Node) UnmarshalBencode(data []byte) error {
+	var l []bencode.RawMessage
+	if err := bencode.Unmarshal(data, &l); err != nil {
+		return err
+	}
+	if len(l) != 2 {
+		return fmt.Errorf("metainfo: node has %d elements, want [host, port]", len(l))
+	}
+	var host string
+	if err := bencode.Unmarshal(l[0], &host); err != nil {
+		return err
+	}
+
+	var port int64
+	if len(l[1]) > 0 && l[1][0] == 'i' {
+		if err := bencode.Unmarshal(l[1], &port); err != nil {
+			return err
+		}
+	} else {
+		var s string
+		if err := bencode.Unmarshal(l[1], &s); err != nil {
+			return err
+		}
+		p, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("metainfo: node port %q is not a number", s)
+		}
+		port = p
+	}
+	if port < 0 || port > 65535 {
+		return fmt.Errorf("metainfo: node port %d out of range", port)
+	}
+	*n = Node{Host: host, Port: uint16(port)}
+	return nil
+}
+
+// Nodes is the "nodes" list of a trackerless torrent.
+type Nodes []Node
+
+// Validate checks every node of ns.
+func (ns Nodes) Validate() error {
+	for _, n := range ns {
+		if err := n.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+//go:build !bencode_lite
+
+package metainfo
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// padLength returns the padding needed after a file of the given length to reach a piece boundary.
+// pieceLength must be positive.
+func padLength(length, pieceLength int64) int64 {
+	return (pieceLength - length%pieceLength) % pieceLength
+}
+
+// PaddingFile returns the BEP 47 padding file entry of the given length.
+func PaddingFile(length int64) FileInfo {
+	return FileInfo{Length: length, Path: []string{".pad", strconv.FormatInt(length, 10)}, Attr: "p"}
+}
+
+// IsPadding reports whether f is a BEP 47 padding file.
+func (f FileInfo) IsPadding() bool {
+	for _, c := range f.Attr {
+		if c == 'p' {
+			return true
+		}
+	}
+	return false
+}
+
+// AlignFiles returns files with a padding file inserted after every file
+// but the last that does not end on a piece boundary, so that each file
+// starts on a piece of its own. Padding files already in files are dropped
+// first, which makes AlignFiles safe to apply again after a change of piece length.
+// The piece length must be positive.
+func AlignFiles(files []FileInfo, pieceLength int64) ([]FileInfo, error) {
+	srcs := make([]source, 0, len(files))
+	var unpadded []FileInfo
+	for _, f := range files {
+		if !f.IsPadding() {
+			unpadded = append(unpadded, f)
+			srcs = append(srcs, source{length: f.Length})
+		}
+	}
+	aligned, _, err := alignFiles(unpadded, srcs, pieceLength)
+	return aligned, err
+}
+
+// alignFiles inserts padding files into files and their sources on disk.
+func alignFiles(files []FileInfo, srcs []source, pieceLength int64) ([]FileInfo, []source, error) {
+	if pieceLength <= 0 {
+		return nil, nil, fmt.Errorf("metainfo: invalid piece length %d", pieceLength)
+	}
+	var (
+		padded     = make([]FileInfo, 0, 2*len(files))
+		paddedSrcs = make([]source, 0, 2*len(srcs))
+	)
+	for i, f := range files {
+		padded = append(padded, f)
+		paddedSrcs = append(paddedSrcs, srcs[i])
+		if pad := padLength(f.Length, pieceLength); pad > 0 && i < len(files)-1 {
+			padded = append(padded, PaddingFile(pad))
+			paddedSrcs = append(paddedSrcs, source{length: pad})
+		}
+	}
+	return padded, paddedSrcs, nil
+}
+
+// ContentFiles returns FileList without its padding files. The offsets still
+// account for the padding, but the indexes no longer match those of FileList
+// and PieceFiles.
+func (info *Info) ContentFiles() []File {
+	var files []File
+	for _, f := range info.FileList() {
+		if !f.Padding {
+			files = append(files, f)
+		}
+	}
+	return files
+}
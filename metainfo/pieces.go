@@ -0,0 +1,72 @@
+//go:build !bencode_lite
+
+package metainfo
+
+import "fmt"
+
+// PieceHashLen is the size of a v1 piece hash.
+const PieceHashLen = 20
+
+// ValidatePieces checks that the pieces string holds one hash per piece of the content.
+func (info *Info) ValidatePieces() error {
+	if len(info.Pieces)%PieceHashLen != 0 {
+		return fmt.Errorf("metainfo: pieces length %d is not a multiple of %d", len(info.Pieces), PieceHashLen)
+	}
+	if n, want := len(info.Pieces)/PieceHashLen, info.NumPieces(); n != want {
+		return fmt.Errorf("metainfo: %d piece hashes for %d pieces", n, want)
+	}
+	return nil
+}
+
+// PieceHashes splits the pieces string into the v1 piece hashes.
+func (info *Info) PieceHashes() ([][PieceHashLen]byte, error) {
+	if len(info.Pieces)%PieceHashLen != 0 {
+		return nil, fmt.Errorf("metainfo: pieces length %d is not a multiple of %d", len(info.Pieces), PieceHashLen)
+	}
+	hashes := make([][PieceHashLen]byte, len(info.Pieces)/PieceHashLen)
+	for i := range hashes {
+		copy(hashes[i][:], info.Pieces[i*PieceHashLen:])
+	}
+	return hashes, nil
+}
+
+// PieceHash returns the v1 hash of piece i.
+func (info *Info) PieceHash(i int) (h [PieceHashLen]byte, err error) {
+	if i < 0 || (i+1)*PieceHashLen > len(info.Pieces) {
+		return h, fmt.Errorf("metainfo: piece %d out of range [0, %d)", i, len(info.Pieces)/PieceHashLen)
+	}
+	copy(h[:], info.Pieces[i*PieceHashLen:])
+	return h, nil
+}
+
+// PieceHashesV2 returns the v2 piece hashes of file f of a torrent with the
+// given piece length. A file of at most one piece has no piece layer; its only
+// piece hash is its pieces root. Empty files have no pieces.
+func (mi *MetaInfo) PieceHashesV2(f FileV2, pieceLength int64) ([][32]byte, error) {
+	if f.Length == 0 {
+		return nil, nil
+	}
+	if f.Length <= pieceLength {
+		return [][32]byte{f.PiecesRoot}, nil
+	}
+	hashes, ok := mi.PieceLayers.Hashes(f.PiecesRoot)
+	if !ok {
+		return nil, fmt.Errorf("metainfo: no piece layer for %v", f.Path)
+	}
+	if want := (f.Length + pieceLength - 1) / pieceLength; int64(len(hashes)) != want {
+		return nil, fmt.Errorf("metainfo: piece layer of %v has %d hashes, want %d", f.Path, len(hashes), want)
+	}
+	return hashes, nil
+}
+
+// PieceHashV2 returns the v2 hash of piece i of file f; see PieceHashesV2.
+func (mi *MetaInfo) PieceHashV2(f FileV2, pieceLength int64, i int) (h [32]byte, err error) {
+	hashes, err := mi.PieceHashesV2(f, pieceLength)
+	if err != nil {
+		return h, err
+	}
+	if i < 0 || i >= len(hashes) {
+		return h, fmt.Errorf("metainfo: piece %d of %v out of range [0, %d)", i, f.Path, len(hashes))
+	}
+	return hashes[i], nil
+}
@@ -0,0 +1,99 @@
+//go:build !bencode_lite
+
+package metainfo
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// IndexRange is the range [First, Last] of file indexes.
+type IndexRange struct {
+	First, Last int
+}
+
+// IndexSet is a set of file indexes, as carried by the select-only parameter
+// of magnet links (BEP 53). It is kept as sorted, disjoint and non-adjacent
+// ranges, so that a range covering many files costs no more than one file.
+type IndexSet []IndexRange
+
+// ParseIndexSet parses a comma-separated list of indexes and ranges such as "0,2,4-7".
+func ParseIndexSet(s string) (IndexSet, error) {
+	var set IndexSet
+	for _, part := range strings.Split(s, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		a, err := strconv.Atoi(first)
+		if err != nil || a < 0 {
+			return nil, fmt.Errorf("metainfo: invalid file index %q", part)
+		}
+		b := a
+		if isRange {
+			if b, err = strconv.Atoi(last); err != nil || b < a {
+				return nil, fmt.Errorf("metainfo: invalid file index range %q", part)
+			}
+		}
+		set = append(set, IndexRange{a, b})
+	}
+	return set.normalize(), nil
+}
+
+// NewIndexSet returns the set of the given indexes.
+func NewIndexSet(indexes ...int) IndexSet {
+	set := make(IndexSet, len(indexes))
+	for i, n := range indexes {
+		set[i] = IndexRange{n, n}
+	}
+	return set.normalize()
+}
+
+// normalize sorts the ranges and merges those that overlap or touch.
+func (s IndexSet) normalize() IndexSet {
+	sort.Slice(s, func(i, j int) bool { return s[i].First < s[j].First })
+	var out IndexSet
+	for _, r := range s {
+		if n := len(out); n > 0 && r.First <= out[n-1].Last+1 {
+			if r.Last > out[n-1].Last {
+				out[n-1].Last = r.Last
+			}
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// Contains reports whether i is in s.
+func (s IndexSet) Contains(i int) bool {
+	j := sort.Search(len(s), func(j int) bool { return s[j].Last >= i })
+	return j < len(s) && s[j].First <= i
+}
+
+// String returns s in the syntax accepted by ParseIndexSet.
+func (s IndexSet) String() string {
+	parts := make([]string, len(s))
+	for i, r := range s {
+		parts[i] = strconv.Itoa(r.First)
+		if r.Last != r.First {
+			parts[i] += "-" + strconv.Itoa(r.Last)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// SelectedFiles returns the files of FileList whose indexes are in s. An
+// empty set selects every file.
+func (info *Info) SelectedFiles(s IndexSet) []File {
+	files := info.FileList()
+	if len(s) == 0 {
+		return files
+	}
+	var selected []File
+	for i, f := range files {
+		if s.Contains(i) {
+			selected = append(selected, f)
+		}
+	}
+	return selected
+}
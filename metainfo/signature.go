@@ -0,0 +1,61 @@
+//go:build !bencode_lite
+
+package metainfo
+
+import (
+	"errors"
+
+	"go.x2ox.com/bencode"
+)
+
+// Signature is an entry of the signatures dictionary of a torrent (BEP 35).
+// Certificate, when present, is the DER-encoded X.509 certificate of the
+// signer. Info holds optional extra data, signed along with the info dictionary.
+type Signature struct {
+	Certificate []byte             `bencode:"certificate,omitempty"`
+	Info        bencode.RawMessage `bencode:"info,omitempty"`
+	Signature   []byte             `bencode:"signature"`
+}
+
+// Signatures maps the identifiers of signing entities to their signatures.
+type Signatures map[string]Signature
+
+// SigningInput returns the bytes that a signature with the given extra info
+// covers: the info dictionary exactly as encoded, followed by the encoded
+// extra info if there is any.
+func (mi *MetaInfo) SigningInput(info bencode.RawMessage) []byte {
+	b := make([]byte, 0, len(mi.InfoBytes)+len(info))
+	b = append(b, mi.InfoBytes...)
+	return append(b, info...)
+}
+
+// Sign signs the torrent with sign, which the caller provides for the
+// algorithm of its choice, and stores the signature under name. cert and info
+// may be nil.
+func (mi *MetaInfo) Sign(name string, cert []byte, info bencode.RawMessage, sign func(msg []byte) ([]byte, error)) error {
+	if len(mi.InfoBytes) == 0 {
+		return errors.New("metainfo: cannot sign a torrent without info dict")
+	}
+	if info != nil && !bencode.Valid(info) {
+		return errors.New("metainfo: signature info is not valid bencode")
+	}
+	sig, err := sign(mi.SigningInput(info))
+	if err != nil {
+		return err
+	}
+	if mi.Signatures == nil {
+		mi.Signatures = make(Signatures)
+	}
+	mi.Signatures[name] = Signature{Certificate: cert, Info: info, Signature: sig}
+	return nil
+}
+
+// VerifySignature checks the signature stored under name with verify, which
+// is given the signature entry and the bytes it covers.
+func (mi *MetaInfo) VerifySignature(name string, verify func(sig Signature, msg []byte) error) error {
+	sig, ok := mi.Signatures[name]
+	if !ok {
+		return errors.New("metainfo: no signature for " + name)
+	}
+	return verify(sig, mi.SigningInput(sig.Info))
+}
@@ -0,0 +1,151 @@
+//go:build !bencode_lite
+
+package metainfo
+
+import (
+	"fmt"
+	"sort"
+
+	"go.x2ox.com/bencode"
+)
+
+// FileTree is a node of the v2 file tree (BEP 52): either a file, or a
+// directory mapping names to child nodes. On the wire a file is a dict with the
+// single key "" holding its FileTreeFile.
+type FileTree struct {
+	File *FileTreeFile
+	Dir  map[string]*FileTree
+}
+
+// FileTreeFile describes a file of a v2 torrent. PiecesRoot is the merkle root
+// of the file's 16 KiB blocks; it is absent for empty files.
+type FileTreeFile struct {
+	Length     int64  `bencode:"length"`
+	PiecesRoot []byte `bencode:"pieces root,omitempty"`
+}
+
+// MarshalBencode encodes ft as nested dicts.
+func (ft FileTree) MarshalBencode() ([]byte, error) {
+	if ft.File != nil {
+		return bencode.Marshal(map[string]*FileTreeFile{"": ft.File})
+	}
+	if ft.Dir == nil {
+		return bencode.Marshal(map[string]*FileTree{})
+	}
+	return bencode.Marshal(ft.Dir)
+}
+
+// UnmarshalBencode decodes a file tree node.
+func (ft *FileTree) UnmarshalBencode(data []byte) error {
+	var m map[string]bencode.RawMessage
+	if err := bencode.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*ft = FileTree{}
+	if raw, ok := m[""]; ok {
+		if len(m) != 1 {
+			return fmt.Errorf("metainfo: file tree node is both a file and a directory")
+		}
+		ft.File = new(FileTreeFile)
+		return bencode.Unmarshal(raw, ft.File)
+	}
+	ft.Dir = make(map[string]*FileTree, len(m))
+	for name, raw := range m {
+		child := new(FileTree)
+		if err := child.UnmarshalBencode(raw); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		ft.Dir[name] = child
+	}
+	return nil
+}
+
+// FileV2 is a file of a v2 torrent with its full path.
+type FileV2 struct {
+	Path       []string
+	Length     int64
+	PiecesRoot [32]byte
+}
+
+// Walk calls fn for every file of the tree in the order BEP 52 lays them out:
+// depth first, with names sorted by their raw bytes.
+func (ft *FileTree) Walk(fn func(f FileV2)) {
+	ft.walk(nil, fn)
+}
+
+func (ft *FileTree) walk(path []string, fn func(f FileV2)) {
+	if ft.File != nil {
+		f := FileV2{Path: append([]string(nil), path...), Length: ft.File.Length}
+		copy(f.PiecesRoot[:], ft.File.PiecesRoot)
+		fn(f)
+		return
+	}
+	names := make([]string, 0, len(ft.Dir))
+	for name := range ft.Dir {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ft.Dir[name].walk(append(path, name), fn)
+	}
+}
+
+// IsV2 reports whether the info dictionary carries v2 metadata.
+func (info *Info) IsV2() bool {
+	return info.MetaVersion == 2
+}
+
+// FilesV2 returns the files of the v2 file tree in layout order.
+func (info *Info) FilesV2() []FileV2 {
+	var files []FileV2
+	info.FileTree.Walk(func(f FileV2) { files = append(files, f) })
+	return files
+}
+
+// PieceLayers maps the pieces root of every file larger than one piece to the
+// concatenated SHA-256 hashes of its piece layer. On the wire it is a dict keyed
+// by the raw 32-byte roots.
+type PieceLayers map[[32]byte][]byte
+
+// MarshalBencode encodes pl as a dict keyed by the raw root bytes.
+func (pl PieceLayers) MarshalBencode() ([]byte, error) {
+	m := make(map[string][]byte, len(pl))
+	for root, layer := range pl {
+		m[string(root[:])] = layer
+	}
+	return bencode.Marshal(m)
+}
+
+// UnmarshalBencode decodes a dict keyed by raw root bytes.
+func (pl *PieceLayers) UnmarshalBencode(data []byte) error {
+	var m map[string][]byte
+	if err := bencode.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*pl = make(PieceLayers, len(m))
+	for k, layer := range m {
+		var root [32]byte
+		if len(k) != len(root) {
+			return fmt.Errorf("metainfo: piece layers key of %d bytes is not a merkle root", len(k))
+		}
+		if len(layer)%len(root) != 0 {
+			return fmt.Errorf("metainfo: piece layer length %d is not a multiple of %d", len(layer), len(root))
+		}
+		copy(root[:], k)
+		(*pl)[root] = layer
+	}
+	return nil
+}
+
+// Hashes returns the piece hashes of the layer with the given root.
+func (pl PieceLayers) Hashes(root [32]byte) ([][32]byte, bool) {
+	layer, ok := pl[root]
+	if !ok {
+		return nil, false
+	}
+	hashes := make([][32]byte, len(layer)/32)
+	for i := range hashes {
+		copy(hashes[i][:], layer[i*32:])
+	}
+	return hashes, true
+}
@@ -0,0 +1,239 @@
+//go:build !bencode_lite
+
+package metainfo
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// VerifyResult reports the parts of the torrent content that do not match
+// the piece hashes.
+type VerifyResult struct {
+	// Pieces is the number of pieces checked.
+	Pieces int
+	// BadPieces lists the pieces whose data is missing or does not match
+	// their hash, in ascending order.
+	BadPieces []int
+	// BadFiles lists the indexes in FileList of the files that are missing,
+	// have the wrong size, or overlap a bad piece, in ascending order.
+	BadFiles []int
+}
+
+// OK reports whether the whole content matches.
+func (r *VerifyResult) OK() bool {
+	return len(r.BadPieces) == 0 && len(r.BadFiles) == 0
+}
+
+// Verify hashes the content of the torrent found in dir, the directory that
+// holds the single file or the directory Name, and compares it with the piece
+// hashes. Torrents with v1 pieces, hybrid ones included, are checked against
+// them; v2-only torrents are checked against their piece layers.
+//
+// Pieces are hashed by up to workers goroutines, or by one per CPU when
+// workers is not positive. Missing or short files count as mismatches rather
+// than errors; an error is returned only if the torrent itself is malformed,
+// such as if its file paths would lead out of dir.
+func (mi *MetaInfo) Verify(dir string, workers int) (*VerifyResult, error) {
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return nil, err
+	}
+	if err = info.ValidatePaths(); err != nil {
+		return nil, err
+	}
+	files := info.FileList()
+	paths := make([]string, len(files))
+	for i, f := range files {
+		if f.Padding {
+			continue
+		}
+		if info.singleFile() {
+			paths[i] = filepath.Join(dir, info.Name)
+		} else {
+			paths[i] = filepath.Join(append([]string{dir, info.Name}, f.Path...)...)
+		}
+	}
+
+	var checks []pieceCheck
+	if len(info.Pieces) > 0 {
+		if err = info.ValidatePieces(); err != nil {
+			return nil, err
+		}
+		for i := 0; i < info.NumPieces(); i++ {
+			checks = append(checks, pieceCheck{piece: i, spans: info.PieceFiles(i), want: info.Pieces[i*PieceHashLen : (i+1)*PieceHashLen]})
+		}
+	} else {
+		if checks, err = mi.checksV2(&info, files); err != nil {
+			return nil, err
+		}
+	}
+
+	res := &VerifyResult{Pieces: len(checks)}
+	badFile := make([]bool, len(files))
+	for i, f := range files {
+		if f.Padding {
+			continue
+		}
+		if st, err := os.Stat(paths[i]); err != nil || !st.Mode().IsRegular() || st.Size() != f.Length {
+			badFile[i] = true
+		}
+	}
+
+	bad := verifyPieces(checks, paths, workers)
+	for i, c := range checks {
+		if !bad[i] {
+			continue
+		}
+		res.BadPieces = append(res.BadPieces, c.piece)
+		for _, s := range c.spans {
+			if !files[s.File].Padding {
+				badFile[s.File] = true
+			}
+		}
+	}
+	for i, b := range badFile {
+		if b {
+			res.BadFiles = append(res.BadFiles, i)
+		}
+	}
+	return res, nil
+}
+
+// singleFile reports whether the torrent content is a single file rather than
+// a directory, in the layout FileList uses.
+func (info *Info) singleFile() bool {
+	if info.IsDir() {
+		return false
+	}
+	if len(info.Pieces) > 0 || !info.IsV2() {
+		return true
+	}
+	node, ok := info.FileTree.Dir[info.Name]
+	return ok && node.File != nil && len(info.FileTree.Dir) == 1
+}
+
+// pieceCheck is the data of one piece and its expected hash.
+type pieceCheck struct {
+	piece int
+	spans []FileSpan
+	want  []byte
+	// width is the number of leaves of the v2 merkle tree of the piece, or
+	// 0 for a v1 SHA-1 piece.
+	width int
+}
+
+// checksV2 lists the pieces of a v2-only torrent file by file, since v2
+// pieces never span files.
+func (mi *MetaInfo) checksV2(info *Info, files []File) ([]pieceCheck, error) {
+	var checks []pieceCheck
+	blocksPerPiece := int(info.PieceLength / BlockSize)
+	for i, f := range info.FilesV2() {
+		hashes, err := mi.PieceHashesV2(f, info.PieceLength)
+		if err != nil {
+			return nil, err
+		}
+		first := int(files[i].Offset / info.PieceLength)
+		for j := range hashes {
+			off := int64(j) * info.PieceLength
+			c := pieceCheck{
+				piece: first + j,
+				spans: []FileSpan{{File: i, Offset: off, Length: min64(info.PieceLength, f.Length-off)}},
+				want:  hashes[j][:],
+				width: blocksPerPiece,
+			}
+			if f.Length <= info.PieceLength {
+				c.width = nextPowerOfTwo(int((f.Length + BlockSize - 1) / BlockSize))
+			}
+			checks = append(checks, c)
+		}
+	}
+	return checks, nil
+}
+
+// verifyPieces hashes the pieces concurrently and reports which do not match.
+func verifyPieces(checks []pieceCheck, paths []string, workers int) []bool {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	var (
+		bad  = make([]bool, len(checks))
+		next = make(chan int)
+		wg   sync.WaitGroup
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var buf []byte
+			for i := range next {
+				var ok bool
+				buf, ok = checks[i].verify(paths, buf)
+				bad[i] = !ok
+			}
+		}()
+	}
+	for i := range checks {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return bad
+}
+
+// verify reads the piece into buf, growing it as needed, and compares its hash.
+func (c *pieceCheck) verify(paths []string, buf []byte) ([]byte, bool) {
+	var size int64
+	for _, s := range c.spans {
+		size += s.Length
+	}
+	if int64(cap(buf)) < size {
+		buf = make([]byte, size)
+	}
+	buf = buf[:size]
+	var off int64
+	for _, s := range c.spans {
+		if !readSpan(paths[s.File], s.Offset, buf[off:off+s.Length]) {
+			return buf, false
+		}
+		off += s.Length
+	}
+
+	if c.width == 0 {
+		h := sha1.Sum(buf)
+		return buf, bytes.Equal(h[:], c.want)
+	}
+	var leaves [][32]byte
+	for off := 0; off < len(buf); off += BlockSize {
+		end := off + BlockSize
+		if end > len(buf) {
+			end = len(buf)
+		}
+		leaves = append(leaves, sha256.Sum256(buf[off:end]))
+	}
+	h := merkleRoot(leaves, c.width, [32]byte{})
+	return buf, bytes.Equal(h[:], c.want)
+}
+
+// readSpan fills p from the file at path starting at off. Padding files,
+// which have no path, read as zeros.
+func readSpan(path string, off int64, p []byte) bool {
+	if path == "" {
+		for i := range p {
+			p[i] = 0
+		}
+		return true
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	_, err = f.ReadAt(p, off)
+	return err == nil
+}
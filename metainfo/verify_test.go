@@ -0,0 +1,50 @@
+//go:build !bencode_lite
+
+package metainfo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyRejectsEscapingPaths(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "secret"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		files []FileInfo
+	}{
+		{"..", nil},
+		{"/etc", nil},
+		{"a/b", nil},
+		{".", nil},
+		{"", nil},
+		{"t", []FileInfo{{Length: 1, Path: []string{"..", "secret"}}}},
+		{"t", []FileInfo{{Length: 1, Path: []string{"/secret"}}}},
+		{"t", []FileInfo{{Length: 1, Path: []string{`..\secret`}}}},
+		{"t", []FileInfo{{Length: 1, Path: []string{"a", ""}}}},
+		{"t", []FileInfo{{Length: 1, Path: nil}}},
+	}
+	for _, tt := range tests {
+		info := Info{Name: tt.name, PieceLength: BlockSize, Pieces: make([]byte, PieceHashLen), Files: tt.files}
+		if tt.files == nil {
+			info.Length = 1
+		}
+		var mi MetaInfo
+		if err := mi.SetInfo(info); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := mi.Verify(dir, 1); err == nil {
+			t.Errorf("Verify accepted name %q and files %v", tt.name, tt.files)
+		}
+	}
+}
+
+func TestBuildRejectsInvalidName(t *testing.T) {
+	if _, err := new(Builder).Build(string(filepath.Separator)); err == nil {
+		t.Fatal("Build accepted the root directory, which has no name")
+	}
+}
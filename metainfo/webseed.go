@@ -0,0 +1,73 @@
+//go:build !bencode_lite
+
+package metainfo
+
+import (
+	"fmt"
+	"net/url"
+
+	"go.x2ox.com/bencode"
+)
+
+// URLList is the list of web seeds of a torrent, as found under "url-list"
+// (BEP 19, GetRight style) and "httpseeds" (BEP 17, Hoffman style). Both keys
+// are found in the wild holding either a single string or a list of strings;
+// URLList accepts either and always encodes a list.
+type URLList []string
+
+// MarshalBencode encodes us as a list of strings.
+func (us URLList) MarshalBencode() ([]byte, error) {
+	return bencode.Marshal([]string(us))
+}
+
+// UnmarshalBencode decodes a string or a list of strings. An empty string
+// decodes to an empty list.
+func (us *URLList) UnmarshalBencode(data []byte) error {
+	if len(data) > 0 && data[0] == 'l' {
+		var l []string
+		if err := bencode.Unmarshal(data, &l); err != nil {
+			return err
+		}
+		*us = l
+		return nil
+	}
+	var s string
+	if err := bencode.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*us = nil
+	if s != "" {
+		*us = URLList{s}
+	}
+	return nil
+}
+
+// URLs parses the entries of us, skipping empty ones. Only absolute http and
+// https URLs are accepted.
+func (us URLList) URLs() ([]*url.URL, error) {
+	var l []*url.URL
+	for _, s := range us {
+		if s == "" {
+			continue
+		}
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+			return nil, fmt.Errorf("metainfo: web seed %q is not an http(s) URL", s)
+		}
+		l = append(l, u)
+	}
+	return l, nil
+}
+
+// WebSeeds returns the parsed BEP 19 web seeds of mi ("url-list").
+func (mi *MetaInfo) WebSeeds() ([]*url.URL, error) {
+	return mi.URLList.URLs()
+}
+
+// HTTPSeedURLs returns the parsed BEP 17 HTTP seeds of mi ("httpseeds").
+func (mi *MetaInfo) HTTPSeedURLs() ([]*url.URL, error) {
+	return mi.HTTPSeeds.URLs()
+}
@@ -0,0 +1,120 @@
+package bencode
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// OrderedDict is a dictionary that keeps its entries in the order they were
+// decoded or added, so that non-canonical dictionaries round-trip byte for byte.
+// The zero OrderedDict is an empty dictionary ready to use.
+type OrderedDict struct {
+	entries []DictEntry
+	index   map[string]int // key to the position of its last occurrence in entries
+}
+
+// DictEntry is a single key/value pair of an OrderedDict.
+type DictEntry struct {
+	Key   string
+	Value Value
+}
+
+// Len returns the number of entries, counting repeated keys separately.
+func (d *OrderedDict) Len() int { return len(d.entries) }
+
+// Entries returns the entries in order. The slice must not be modified.
+func (d *OrderedDict) Entries() []DictEntry { return d.entries }
+
+// Keys returns the keys in order.
+func (d *OrderedDict) Keys() []string {
+	keys := make([]string, len(d.entries))
+	for i, e := range d.entries {
+		keys[i] = e.Key
+	}
+	return keys
+}
+
+// Get returns the value of the last entry with the given key.
+func (d *OrderedDict) Get(key string) (Value, bool) {
+	i, ok := d.index[key]
+	if !ok {
+		return Value{}, false
+	}
+	return d.entries[i].Value, true
+}
+
+// Set replaces the value of the last entry with the given key,
+// or appends a new entry if there is none.
+func (d *OrderedDict) Set(key string, v Value) {
+	if i, ok := d.index[key]; ok {
+		d.entries[i].Value = v
+		return
+	}
+	if d.index == nil {
+		d.index = make(map[string]int)
+	}
+	d.index[key] = len(d.entries)
+	d.entries = append(d.entries, DictEntry{Key: key, Value: v})
+}
+
+// Delete removes every entry with the given key.
+func (d *OrderedDict) Delete(key string) {
+	if _, ok := d.index[key]; !ok {
+		return
+	}
+	entries := d.entries[:0]
+	for _, e := range d.entries {
+		if e.Key != key {
+			entries = append(entries, e)
+		}
+	}
+	d.entries = entries
+	d.reindex()
+}
+
+func (d *OrderedDict) reindex() {
+	d.index = make(map[string]int, len(d.entries))
+	for i, e := range d.entries {
+		d.index[e.Key] = i
+	}
+}
+
+// MarshalBencode encodes the entries in their stored order.
+func (d OrderedDict) MarshalBencode() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('d')
+	for _, e := range d.entries {
+		raw, err := e.Value.MarshalBencode()
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(strconv.Itoa(len(e.Key)))
+		buf.WriteByte(':')
+		buf.WriteString(e.Key)
+		buf.Write(raw)
+	}
+	buf.WriteByte('e')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBencode decodes a dictionary, keeping its entries in input order.
+func (d *OrderedDict) UnmarshalBencode(data []byte) error {
+	v, err := Parse(data)
+	if err != nil {
+		return err
+	}
+	if v.Kind() != DictKind {
+		return newError("cannot unmarshal a bencode %s into an OrderedDict", v.Kind())
+	}
+	d.entries = make([]DictEntry, len(v.keys))
+	for i, k := range v.keys {
+		d.entries[i] = DictEntry{Key: k, Value: v.list[i]}
+	}
+	d.reindex()
+	return nil
+}
+
+var (
+	_ Marshaler   = OrderedDict{}
+	_ Unmarshaler = (*OrderedDict)(nil)
+)
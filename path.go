@@ -0,0 +1,261 @@
+package bencode
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// splitPath splits a dotted path such as "info.files.3.length" into its segments.
+// A backslash escapes the next character, so "name\.utf-8" names the key "name.utf-8".
+// The empty path addresses the whole document.
+func splitPath(path string) []string {
+	if path == "" {
+		return nil
+	}
+	var (
+		segs []string
+		b    strings.Builder
+	)
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; {
+		case c == '\\' && i+1 < len(path):
+			i++
+			b.WriteByte(path[i])
+		case c == '.':
+			segs = append(segs, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return append(segs, b.String())
+}
+
+// lookup locates the value addressed by segs in data without decoding anything
+// along the way. Each segment is a dict key, or a decimal index when the
+// enclosing value is a list. It returns the [start, end) offsets of the value,
+// and found is false if some segment does not exist.
+func lookup(data []byte, segs []string) (start, end int, found bool, err error) {
+	if end, err = scanValue(data, 0); err != nil {
+		return 0, 0, false, err
+	}
+	for _, seg := range segs {
+		if _, start, end, found, err = lookupChild(data, start, seg); err != nil || !found {
+			return 0, 0, false, err
+		}
+	}
+	return start, end, true, nil
+}
+
+// lookupChild locates the element named seg of the list or dict starting at data[i].
+// It returns the offset of the whole entry, which for a dict includes the key,
+// and the [start, end) offsets of the value. In a dict with repeated keys the
+// last occurrence wins.
+func lookupChild(data []byte, i int, seg string) (entry, start, end int, found bool, err error) {
+	switch data[i] {
+	case 'l':
+		n, err := strconv.Atoi(seg)
+		if err != nil || n < 0 {
+			return 0, 0, 0, false, nil
+		}
+		for i++; data[i] != 'e'; n-- {
+			if end, err = scanValue(data, i); err != nil {
+				return 0, 0, 0, false, err
+			}
+			if n == 0 {
+				return i, i, end, true, nil
+			}
+			i = end
+		}
+	case 'd':
+		for i++; data[i] != 'e'; {
+			keyEnd, err := scanString(data, i)
+			if err != nil {
+				return 0, 0, 0, false, err
+			}
+			match := string(stringPayload(data[i:keyEnd])) == seg
+			keyStart := i
+			if i, err = scanValue(data, keyEnd); err != nil {
+				return 0, 0, 0, false, err
+			}
+			if match {
+				entry, start, end, found = keyStart, keyEnd, i, true
+			}
+		}
+	}
+	return entry, start, end, found, nil
+}
+
+// stringPayload returns the contents of the encoded byte string b.
+func stringPayload(b []byte) []byte {
+	return b[bytes.IndexByte(b, ':')+1:]
+}
+
+// Get returns the value addressed by path in the encoded document data,
+// decoding only that value. Path segments are separated by dots and name dict
+// keys or list indices, as in "info.files.3.length". If the path does not exist
+// the returned Value is invalid and the error is nil.
+func Get(data []byte, path string) (Value, error) {
+	start, end, found, err := lookup(data, splitPath(path))
+	if err != nil || !found {
+		return Value{}, err
+	}
+	v, _ := parseNode(append([]byte(nil), data[start:end]...), 0)
+	v.rebase(start)
+	return v, nil
+}
+
+// rebase shifts the recorded offsets of v and its children by base.
+func (v *Value) rebase(base int) {
+	v.offset += base
+	for i := range v.keySpan {
+		v.keySpan[i][0] += base
+		v.keySpan[i][1] += base
+	}
+	for i := range v.list {
+		v.list[i].rebase(base)
+	}
+}
+
+// Set returns a copy of data with the value addressed by path replaced by the
+// encoding of value. A missing final dict key is inserted before the first
+// greater key, keeping canonical documents canonical, and a final list index
+// equal to the list's length appends to it. All other bytes are copied verbatim.
+func Set(data []byte, path string, value interface{}) ([]byte, error) {
+	enc, err := Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	segs := splitPath(path)
+	if len(segs) == 0 {
+		if _, err = scanValue(data, 0); err != nil {
+			return nil, err
+		}
+		return enc, nil
+	}
+
+	pStart, _, found, err := lookup(data, segs[:len(segs)-1])
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, newError("path %q: parent does not exist", path)
+	}
+	seg := segs[len(segs)-1]
+	_, start, end, found, err := lookupChild(data, pStart, seg)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		return splice(data, start, end, enc), nil
+	}
+
+	switch data[pStart] {
+	case 'd':
+		at, err := dictInsertPos(data, pStart, seg)
+		if err != nil {
+			return nil, err
+		}
+		entry := strconv.AppendInt(nil, int64(len(seg)), 10)
+		entry = append(entry, ':')
+		entry = append(entry, seg...)
+		return splice(data, at, at, append(entry, enc...)), nil
+	case 'l':
+		length, end, err := listLen(data, pStart)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := strconv.Atoi(seg); err == nil && n == length {
+			return splice(data, end-1, end-1, enc), nil
+		}
+	}
+	return nil, newError("path %q does not exist", path)
+}
+
+// Delete returns a copy of data with the dict entry or list element addressed
+// by path removed. Every entry of a repeated dict key is removed. If the path
+// does not exist the copy is identical to data.
+func Delete(data []byte, path string) ([]byte, error) {
+	segs := splitPath(path)
+	if len(segs) == 0 {
+		return nil, newError("cannot delete the top-level value")
+	}
+	pStart, _, found, err := lookup(data, segs[:len(segs)-1])
+	if err != nil {
+		return nil, err
+	}
+	out := append([]byte(nil), data...)
+	if !found {
+		return out, nil
+	}
+	for {
+		entry, _, end, found, err := lookupChild(out, pStart, segs[len(segs)-1])
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return out, nil
+		}
+		out = append(out[:entry], out[end:]...)
+		if out[pStart] == 'l' {
+			return out, nil
+		}
+	}
+}
+
+// dictInsertPos returns the offset at which an entry for key belongs in the
+// dict starting at data[i]: before the first greater key, or before the final 'e'.
+func dictInsertPos(data []byte, i int, key string) (int, error) {
+	for i++; data[i] != 'e'; {
+		keyEnd, err := scanString(data, i)
+		if err != nil {
+			return 0, err
+		}
+		if string(stringPayload(data[i:keyEnd])) > key {
+			return i, nil
+		}
+		if i, err = scanValue(data, keyEnd); err != nil {
+			return 0, err
+		}
+	}
+	return i, nil
+}
+
+// listLen returns the number of elements of the list starting at data[i] and the offset just past it.
+func listLen(data []byte, i int) (n, end int, err error) {
+	for i++; data[i] != 'e'; n++ {
+		if i, err = scanValue(data, i); err != nil {
+			return 0, 0, err
+		}
+	}
+	return n, i + 1, nil
+}
+
+// splice returns a new slice holding data with data[start:end] replaced by b.
+func splice(data []byte, start, end int, b []byte) []byte {
+	out := make([]byte, 0, len(data)-(end-start)+len(b))
+	out = append(out, data[:start]...)
+	out = append(out, b...)
+	return append(out, data[end:]...)
+}
+
+// ExtractRawField returns the verbatim encoding of the value stored under key
+// in the top-level dict of data, found by scanning rather than decoding, so it
+// can be hashed or signed as is. The result aliases data.
+func ExtractRawField(data []byte, key string) ([]byte, error) {
+	if _, err := scanValue(data, 0); err != nil {
+		return nil, err
+	}
+	if data[0] != 'd' {
+		return nil, newError("top-level value is not a dict")
+	}
+	_, start, end, found, err := lookupChild(data, 0, key)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, newError("key %q not found", key)
+	}
+	return data[start:end], nil
+}
@@ -0,0 +1,106 @@
+//go:build !bencode_lite
+
+// Package pex implements the ut_pex peer exchange message (BEP 11), built on
+// the compact peer formats of package compact.
+package pex
+
+import (
+	"fmt"
+	"net/netip"
+
+	"go.x2ox.com/bencode"
+	"go.x2ox.com/bencode/compact"
+)
+
+// Flags describe an added peer, one byte per peer in added.f and added6.f.
+type Flags byte
+
+const (
+	PrefersEncryption Flags = 1 << iota
+	Seed
+	SupportsUTP
+	SupportsHolepunch
+	Reachable
+)
+
+// Peer is an added peer with its flags.
+type Peer struct {
+	Addr  netip.AddrPort
+	Flags Flags
+}
+
+// Message is a ut_pex message.
+type Message struct {
+	Added       compact.Peers  `bencode:"added,omitempty"`
+	AddedFlags  []byte         `bencode:"added.f,omitempty"`
+	Added6      compact.Peers6 `bencode:"added6,omitempty"`
+	Added6Flags []byte         `bencode:"added6.f,omitempty"`
+	Dropped     compact.Peers  `bencode:"dropped,omitempty"`
+	Dropped6    compact.Peers6 `bencode:"dropped6,omitempty"`
+}
+
+// Add records an added peer in the IPv4 or IPv6 lists according to its address.
+func (m *Message) Add(p Peer) {
+	if p.Addr.Addr().Unmap().Is4() {
+		m.Added = append(m.Added, netip.AddrPortFrom(p.Addr.Addr().Unmap(), p.Addr.Port()))
+		m.AddedFlags = append(m.AddedFlags, byte(p.Flags))
+	} else {
+		m.Added6 = append(m.Added6, p.Addr)
+		m.Added6Flags = append(m.Added6Flags, byte(p.Flags))
+	}
+}
+
+// Drop records a dropped peer in the IPv4 or IPv6 list according to its address.
+func (m *Message) Drop(addr netip.AddrPort) {
+	if addr.Addr().Unmap().Is4() {
+		m.Dropped = append(m.Dropped, netip.AddrPortFrom(addr.Addr().Unmap(), addr.Port()))
+	} else {
+		m.Dropped6 = append(m.Dropped6, addr)
+	}
+}
+
+// AddedPeers returns the added peers of both families with their flags.
+// Peers whose flags are missing get zero flags.
+func (m *Message) AddedPeers() []Peer {
+	peers := make([]Peer, 0, len(m.Added)+len(m.Added6))
+	for i, a := range m.Added {
+		peers = append(peers, Peer{Addr: a, Flags: flagAt(m.AddedFlags, i)})
+	}
+	for i, a := range m.Added6 {
+		peers = append(peers, Peer{Addr: a, Flags: flagAt(m.Added6Flags, i)})
+	}
+	return peers
+}
+
+// DroppedPeers returns the dropped peers of both families.
+func (m *Message) DroppedPeers() []netip.AddrPort {
+	return append(append([]netip.AddrPort(nil), m.Dropped...), m.Dropped6...)
+}
+
+func flagAt(flags []byte, i int) Flags {
+	if i < len(flags) {
+		return Flags(flags[i])
+	}
+	return 0
+}
+
+// Encode returns the bencoded form of m.
+func (m *Message) Encode() ([]byte, error) {
+	return bencode.Marshal(m)
+}
+
+// Decode decodes a ut_pex message and checks that flag lists, when present,
+// have one entry per added peer.
+func Decode(data []byte) (Message, error) {
+	var m Message
+	if err := bencode.Unmarshal(data, &m); err != nil {
+		return Message{}, err
+	}
+	if len(m.AddedFlags) != 0 && len(m.AddedFlags) != len(m.Added) {
+		return Message{}, fmt.Errorf("pex: %d flags for %d added peers", len(m.AddedFlags), len(m.Added))
+	}
+	if len(m.Added6Flags) != 0 && len(m.Added6Flags) != len(m.Added6) {
+		return Message{}, fmt.Errorf("pex: %d flags for %d added6 peers", len(m.Added6Flags), len(m.Added6))
+	}
+	return m, nil
+}
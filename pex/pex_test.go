@@ -0,0 +1,74 @@
+//go:build !bencode_lite
+
+package pex
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	var m Message
+	m.Add(Peer{Addr: netip.MustParseAddrPort("10.0.0.1:6881"), Flags: Seed | SupportsUTP})
+	m.Add(Peer{Addr: netip.MustParseAddrPort("[::ffff:10.0.0.2]:80"), Flags: PrefersEncryption})
+	m.Add(Peer{Addr: netip.MustParseAddrPort("[2001:db8::1]:1"), Flags: Reachable})
+	m.Drop(netip.MustParseAddrPort("10.0.0.3:3"))
+	m.Drop(netip.MustParseAddrPort("[2001:db8::2]:2"))
+
+	b, err := m.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "d5:added12:\x0a\x00\x00\x01\x1a\xe1\x0a\x00\x00\x02\x00\x50" +
+		"7:added.f2:\x06\x01" +
+		"6:added618:\x20\x01\x0d\xb8\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01\x00\x01" +
+		"8:added6.f1:\x10" +
+		"7:dropped6:\x0a\x00\x00\x03\x00\x03" +
+		"8:dropped618:\x20\x01\x0d\xb8\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x02e"
+	if string(b) != want {
+		t.Fatalf("Encode = %q, want %q", b, want)
+	}
+
+	got, err := Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Fatalf("Decode = %+v, want %+v", got, m)
+	}
+	wantPeers := []Peer{
+		{netip.MustParseAddrPort("10.0.0.1:6881"), Seed | SupportsUTP},
+		{netip.MustParseAddrPort("10.0.0.2:80"), PrefersEncryption},
+		{netip.MustParseAddrPort("[2001:db8::1]:1"), Reachable},
+	}
+	if peers := got.AddedPeers(); !reflect.DeepEqual(peers, wantPeers) {
+		t.Fatalf("AddedPeers = %v, want %v", peers, wantPeers)
+	}
+	if dropped := got.DroppedPeers(); len(dropped) != 2 {
+		t.Fatalf("DroppedPeers = %v, want 2 peers", dropped)
+	}
+}
+
+func TestDecodeMissingFlags(t *testing.T) {
+	m, err := Decode([]byte("d5:added6:\x0a\x00\x00\x01\x1a\xe1e"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peers := m.AddedPeers(); len(peers) != 1 || peers[0].Flags != 0 {
+		t.Fatalf("AddedPeers = %v, want one peer with zero flags", peers)
+	}
+}
+
+func TestDecodeRejectsMalformed(t *testing.T) {
+	for _, data := range []string{
+		"d5:added6:\x0a\x00\x00\x01\x1a\xe17:added.f2:\x00\x00e",
+		"d6:added618:\x20\x01\x0d\xb8\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01\x00\x018:added6.f2:\x00\x00e",
+		"d5:added5:\x0a\x00\x00\x01\x1ae",
+		"d8:dropped617:\x20\x01\x0d\xb8\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01\x00e",
+	} {
+		if m, err := Decode([]byte(data)); err == nil {
+			t.Errorf("Decode(%q) = %+v, want an error", data, m)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package bencode
+
+import "reflect"
+
+// Precompile builds and caches the encoders and struct field tables of the
+// types of the given values, and of every type reachable from them through
+// fields, elements and pointers, so that the first Marshal or Unmarshal of
+// such values in a server does not pay for it. A reflect.Type argument stands
+// for that type rather than for its own.
+func Precompile(types ...interface{}) {
+	seen := make(map[reflect.Type]bool)
+	for _, x := range types {
+		t, ok := x.(reflect.Type)
+		if !ok {
+			t = reflect.TypeOf(x)
+		}
+		if t != nil {
+			precompile(t, seen)
+		}
+	}
+}
+
+func precompile(t reflect.Type, seen map[reflect.Type]bool) {
+	if seen[t] {
+		return
+	}
+	seen[t] = true
+	typeEncoder(t)
+
+	switch t.Kind() {
+	case reflect.Struct:
+		cachedTypeFields(t)
+		cachedFieldDecoders(t)
+		for i := 0; i < t.NumField(); i++ {
+			precompile(t.Field(i).Type, seen)
+		}
+	case reflect.Map:
+		precompile(t.Key(), seen)
+		precompile(t.Elem(), seen)
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		precompile(t.Elem(), seen)
+	}
+}
@@ -0,0 +1,90 @@
+package bencode
+
+import (
+	"bytes"
+	"io"
+)
+
+// RawMessage is a raw encoded bencode value.
+// It implements Marshaler and Unmarshaler and can be used to delay decoding
+// of a sub-document or to splice a pre-encoded value into a larger message.
+type RawMessage []byte
+
+// MarshalBencode returns m as the bencode encoding of m, after checking that it is valid.
+func (m RawMessage) MarshalBencode() ([]byte, error) {
+	if err := checkValid(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// UnmarshalBencode sets *m to a copy of data.
+func (m *RawMessage) UnmarshalBencode(data []byte) error {
+	if m == nil {
+		return newError("RawMessage: UnmarshalBencode on nil pointer")
+	}
+	*m = append((*m)[0:0], data...)
+	return nil
+}
+
+// WriteTo writes m to w, after checking that it is valid, so that raw values
+// can be piped into connections and hashers without an intermediate copy.
+func (m RawMessage) WriteTo(w io.Writer) (int64, error) {
+	if err := checkValid(m); err != nil {
+		return 0, err
+	}
+	n, err := w.Write(m)
+	return int64(n), err
+}
+
+// ReadFrom sets *m to the data read from r until EOF, reusing its capacity,
+// and checks that it holds exactly one bencode value. To read one value off a
+// stream that carries several, use a Decoder instead.
+func (m *RawMessage) ReadFrom(r io.Reader) (int64, error) {
+	if m == nil {
+		return 0, newError("RawMessage: ReadFrom on nil pointer")
+	}
+	b := bytes.NewBuffer((*m)[:0])
+	n, err := b.ReadFrom(r)
+	if err != nil {
+		return n, err
+	}
+	if err = checkValid(b.Bytes()); err != nil {
+		return n, err
+	}
+	*m = b.Bytes()
+	return n, nil
+}
+
+var (
+	_ Marshaler     = RawMessage(nil)
+	_ Unmarshaler   = (*RawMessage)(nil)
+	_ io.WriterTo   = RawMessage(nil)
+	_ io.ReaderFrom = (*RawMessage)(nil)
+)
+
+// unmarshalRawDict is the fast path of Unmarshal into a map[string]RawMessage,
+// as used by routers that dispatch on one key and decode the rest lazily. It
+// splits the dict at data[0] into its raw values with the scanner, without
+// reflection or nested decoding. The values share a single copy of the dict,
+// or alias data itself if alias is set; each is capped at its own end.
+func unmarshalRawDict(data []byte, m *map[string]RawMessage, alias bool) error {
+	end, err := scanValue(data, 0)
+	if err != nil {
+		return err
+	}
+	data = data[:end]
+	if !alias {
+		data = append([]byte(nil), data...)
+	}
+	if *m == nil {
+		*m = make(map[string]RawMessage)
+	}
+	for i := 1; data[i] != 'e'; {
+		keyEnd, _ := scanString(data, i)
+		valueEnd, _ := scanValue(data, keyEnd)
+		(*m)[string(stringPayload(data[i:keyEnd]))] = RawMessage(data[keyEnd:valueEnd:valueEnd])
+		i = valueEnd
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package bencode
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	typeEncoders sync.Map // map[reflect.Type]func(reflect.Value) ([]byte, error)
+	typeDecoders sync.Map // map[reflect.Type]func([]byte, reflect.Value) error or *union
+
+	// haveTypeDecoders is set once a decoder is registered, sparing the
+	// lookup for every decoded value until then.
+	haveTypeDecoders int32
+)
+
+// RegisterTypeEncoder makes values of type t encode as the bytes returned by
+// enc, which must be a single bencode value. It is meant for types that cannot
+// be given a MarshalBencode method, such as those of other packages, and is
+// consulted before Marshaler and the built-in encoders. Registrations should
+// happen before values of t are first encoded, typically from an init function:
+// as the encoders of the types holding t, such as structs with fields of type
+// t, are built with the encoder of t, every cached encoder is dropped and
+// rebuilt on its next use.
+func RegisterTypeEncoder(t reflect.Type, enc func(v reflect.Value) ([]byte, error)) {
+	typeEncoders.Store(t, enc)
+	encoderCache.clear()
+}
+
+// RegisterTypeDecoder makes values of type t decode with dec, which is given
+// a copy of the raw encoding of the value, which it may retain, and a settable
+// reflect.Value of type t. It is consulted before Unmarshaler and the built-in
+// decoders.
+func RegisterTypeDecoder(t reflect.Type, dec func(data []byte, v reflect.Value) error) {
+	typeDecoders.Store(t, dec)
+	atomic.StoreInt32(&haveTypeDecoders, 1)
+}
+
+// registeredEncoder returns the encoderFunc for a type registered with RegisterTypeEncoder.
+func registeredEncoder(t reflect.Type) (encoderFunc, bool) {
+	f, ok := typeEncoders.Load(t)
+	if !ok {
+		return nil, false
+	}
+	enc := f.(func(reflect.Value) ([]byte, error))
+	return func(e *encodeState, v reflect.Value) error {
+		b, err := enc(v)
+		if err != nil {
+			return err
+		}
+		_, err = e.Write(b)
+		return err
+	}, true
+}
+
+// registeredDecoder hands the raw encoding of the next value to the decoder
+// registered for the type of v. Like parseValue, it reports false if it finds
+// the end of the enclosing list or dict instead.
+func registeredDecoder(d *decodeState, v reflect.Value) (bool, bool, error) {
+	if atomic.LoadInt32(&haveTypeDecoders) == 0 {
+		return false, false, nil
+	}
+	f, ok := typeDecoders.Load(v.Type())
+	if !ok {
+		return false, false, nil
+	}
+	start := d.Offset
+	d.Reset()
+	if ok, err := d.readValue(); err != nil || !ok {
+		return true, false, d.skipEnd(err)
+	}
+	data := append([]byte(nil), d.Bytes()...)
+	if u, ok := f.(*union); ok {
+		return true, true, u.decode(d, data, start, v)
+	}
+	return true, true, f.(func([]byte, reflect.Value) error)(data, v)
+}
+
+// union is the decoder registered by RegisterUnion.
+type union struct {
+	iface reflect.Type
+	key   string
+	types map[string]reflect.Type
+}
+
+// RegisterUnion makes values of the interface type iface decode from a dict
+// into one of several concrete types, chosen by the byte string the dict holds
+// at key, as messages are by their kind:
+//
+//	bencode.RegisterUnion(reflect.TypeOf((*Message)(nil)).Elem(), "y", map[string]reflect.Type{
+//		"q": reflect.TypeOf(&Query{}),
+//		"r": reflect.TypeOf(&Response{}),
+//		"e": reflect.TypeOf(&Error{}),
+//	})
+//
+// The types of variants, keyed by the values of key, must implement iface.
+// Decoding fails on a dict without key or with a value of it not in variants.
+// The variant is decoded with the settings of the Decoder or Unmarshal
+// function in use, and its errors are located in the whole input. Encoding
+// needs no registration, and the variants are expected to write key
+// themselves, such as from a field. Like gob.Register, RegisterUnion panics
+// if it is misused, and is meant to be called from an init function.
+func RegisterUnion(iface reflect.Type, key string, variants map[string]reflect.Type) {
+	if iface.Kind() != reflect.Interface {
+		panic("bencode: RegisterUnion of non-interface type " + iface.String())
+	}
+	types := make(map[string]reflect.Type, len(variants))
+	for value, t := range variants {
+		if !t.Implements(iface) {
+			panic("bencode: RegisterUnion: " + t.String() + " does not implement " + iface.String())
+		}
+		types[value] = t
+	}
+	typeDecoders.Store(iface, &union{iface: iface, key: key, types: types})
+	atomic.StoreInt32(&haveTypeDecoders, 1)
+}
+
+// decode sets v to the variant encoded by data, which d read from start on.
+// The variant is decoded by a decodeState of its own over data, taking the
+// options and depth of d and counting offsets from start, so that limits and
+// errors are as if d had decoded it in place.
+func (u *union) decode(d *decodeState, data []byte, start int64, v reflect.Value) error {
+	if kindOf(data) != DictKind {
+		return &UnmarshalTypeError{Value: kindOf(data).String(), Type: u.iface, Offset: start}
+	}
+	dict, err := ParseLazyDict(data)
+	if err != nil {
+		return err
+	}
+	var value string
+	if !dict.Has(u.key) || dict.Decode(u.key, &value) != nil {
+		return newError("%s dict has no byte string %q to select its type", u.iface, u.key)
+	}
+	t, ok := u.types[value]
+	if !ok {
+		return newError("no variant of %s for %q %q", u.iface, u.key, value)
+	}
+	nv := reflect.New(t).Elem()
+	sub := newDecodeState(data)
+	sub.decOpts = d.decOpts
+	// d already traced the tokens of data, and errors are located by d.
+	sub.path, sub.trace = nil, nil
+	sub.Offset = start
+	err = sub.unmarshalValue(nv)
+	sub.release()
+	if err != nil {
+		return err
+	}
+	v.Set(nv)
+	return nil
+}
@@ -0,0 +1,121 @@
+//go:build !bencode_lite
+
+package bencode
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type registeredCelsius float64
+
+func TestRegisterTypeEncoderAfterUse(t *testing.T) {
+	type reading struct {
+		Temp  registeredCelsius   `bencode:"temp"`
+		Temps []registeredCelsius `bencode:"temps"`
+	}
+	v := reading{Temp: 21.5, Temps: []registeredCelsius{1}}
+	v2 := map[string]*reading{"a": &v}
+	// Build the encoders of the struct, the map and the pointer first,
+	// without an encoder for the float field.
+	if _, err := Marshal(v2); err == nil {
+		t.Fatal("float field encoded without a registered encoder")
+	}
+
+	RegisterTypeEncoder(reflect.TypeOf(registeredCelsius(0)), func(v reflect.Value) ([]byte, error) {
+		return Marshal(int64(v.Float() * 10))
+	})
+	defer func() {
+		typeEncoders.Delete(reflect.TypeOf(registeredCelsius(0)))
+		ResetTypeCaches()
+	}()
+
+	b, err := Marshal(v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "d1:ad4:tempi215e5:tempsli10eeee"; string(b) != want {
+		t.Fatalf("Marshal = %q, want %q", b, want)
+	}
+}
+
+type unionMessage interface{ unionKind() string }
+
+type unionQuery struct {
+	Y string            `bencode:"y"`
+	Q string            `bencode:"q"`
+	A map[string]string `bencode:"a"`
+}
+
+type unionResponse struct {
+	Y string `bencode:"y"`
+	R struct {
+		N int `bencode:"n"`
+	} `bencode:"r"`
+}
+
+func (*unionQuery) unionKind() string    { return "q" }
+func (*unionResponse) unionKind() string { return "r" }
+
+func TestRegisterUnionDecoderState(t *testing.T) {
+	RegisterUnion(reflect.TypeOf((*unionMessage)(nil)).Elem(), "y", map[string]reflect.Type{
+		"q": reflect.TypeOf(&unionQuery{}),
+		"r": reflect.TypeOf(&unionResponse{}),
+	})
+	defer typeDecoders.Delete(reflect.TypeOf((*unionMessage)(nil)).Elem())
+	type envelope struct {
+		Msgs []unionMessage `bencode:"msgs"`
+	}
+
+	var v envelope
+	if err := Unmarshal([]byte("d4:msgsld1:q4:ping1:y1:qed1:rd1:ni7ee1:y1:reee"), &v); err != nil {
+		t.Fatal(err)
+	}
+	if q, ok := v.Msgs[0].(*unionQuery); !ok || q.Q != "ping" {
+		t.Fatalf("Msgs[0] = %#v, want a ping query", v.Msgs[0])
+	}
+	if r, ok := v.Msgs[1].(*unionResponse); !ok || r.R.N != 7 {
+		t.Fatalf("Msgs[1] = %#v, want a response of 7", v.Msgs[1])
+	}
+
+	// Errors inside a variant are located in the whole input.
+	err := Unmarshal([]byte("d4:msgsld1:q4:ping1:y1:qed1:rd1:n1:xe1:y1:reee"), &v)
+	var te *UnmarshalTypeError
+	if !errors.As(err, &te) || te.Offset != 36 || te.Path.String() != "msgs.1.r.n" {
+		t.Fatalf("Unmarshal = %v, want a type error at 36 in msgs.1.r.n", err)
+	}
+
+	// The settings of the Decoder apply to the variant.
+	dec := NewDecoder(strings.NewReader("d4:msgsld1:q4:ping1:y1:q1:zi1eeee"))
+	dec.SetDisallowUnknownKeys(true)
+	var uk *UnknownKeyError
+	if err = dec.Decode(&v); !errors.As(err, &uk) || uk.Key != "z" || uk.Offset != 24 || uk.Path.String() != "msgs.0.z" {
+		t.Fatalf("Decode = %v, want unknown key z at 24 in msgs.0.z", err)
+	}
+	dec = NewDecoder(strings.NewReader("d4:msgsld1:ad1:k5:valuee1:q4:ping1:y1:qeee"))
+	dec.SetLimits(Limits{MaxDepth: 3})
+	if err = dec.Decode(&v); err == nil {
+		t.Fatal("Decode ignored the depth limit inside a variant")
+	}
+}
+
+func TestRegisterTypeDecoderRetainsData(t *testing.T) {
+	type blob struct{ data []byte }
+	var kept [][]byte
+	RegisterTypeDecoder(reflect.TypeOf(blob{}), func(data []byte, v reflect.Value) error {
+		kept = append(kept, data)
+		return nil
+	})
+	defer typeDecoders.Delete(reflect.TypeOf(blob{}))
+
+	var v []blob
+	dec := NewDecoder(strings.NewReader("l3:one3:twoe"))
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 2 || string(kept[0]) != "3:one" || string(kept[1]) != "3:two" {
+		t.Fatalf("decoder kept %q, want [3:one 3:two]", kept)
+	}
+}
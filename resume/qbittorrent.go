@@ -0,0 +1,118 @@
+//go:build !bencode_lite
+
+package resume
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"go.x2ox.com/bencode"
+	"go.x2ox.com/bencode/metainfo"
+)
+
+// QBittorrent holds the qBittorrent specific keys ("qBt-*") of a .fastresume file.
+// RatioLimit is the ratio multiplied by 1000; negative limits mean "use the
+// global setting" (-2) or "no limit" (-1), as in qBittorrent itself.
+type QBittorrent struct {
+	Name                     string   `bencode:"qBt-name"`
+	Category                 string   `bencode:"qBt-category"`
+	Tags                     []string `bencode:"qBt-tags"`
+	SavePath                 string   `bencode:"qBt-savePath"`
+	DownloadPath             string   `bencode:"qBt-downloadPath"`
+	ContentLayout            string   `bencode:"qBt-contentLayout"`
+	StopCondition            string   `bencode:"qBt-stopCondition"`
+	QueuePosition            int64    `bencode:"qBt-queuePosition"`
+	RatioLimit               int64    `bencode:"qBt-ratioLimit"`
+	SeedingTimeLimit         int64    `bencode:"qBt-seedingTimeLimit"`
+	InactiveSeedingTimeLimit int64    `bencode:"qBt-inactiveSeedingTimeLimit"`
+	FirstLastPiecePriority   bool     `bencode:"qBt-firstLastPiecePriority"`
+	SeedStatus               bool     `bencode:"qBt-seedStatus"`
+}
+
+var qbtFields = fieldIndex(reflect.TypeOf(QBittorrent{}))
+
+// QBittorrent extracts the qBittorrent specific keys from the Extra keys of d.
+// Values of an unexpected type are left at their zero value.
+func (d *Data) QBittorrent() QBittorrent {
+	var q QBittorrent
+	v := reflect.ValueOf(&q).Elem()
+	for k, raw := range d.Extra {
+		_, _, _ = setField(v, qbtFields, k, raw, true)
+	}
+	return q
+}
+
+// Torrent is one torrent of a qBittorrent BT_backup directory: the
+// <infohash>.torrent file paired with its <infohash>.fastresume file.
+type Torrent struct {
+	// ID is the common base name of both files, the hex infohash of the torrent.
+	ID string
+
+	// MetaInfo is nil when neither the .torrent file nor the resume data
+	// carry the info dictionary, as for magnet links without metadata.
+	MetaInfo *metainfo.MetaInfo
+	Resume   *Data
+	QBt      QBittorrent
+
+	// Err records why the torrent could not be loaded completely; the other
+	// fields hold whatever could be decoded.
+	Err error
+}
+
+// LoadBTBackup loads every torrent of a qBittorrent BT_backup directory (found
+// in its data directory, e.g. ~/.local/share/qBittorrent/BT_backup). Problems
+// with single torrents are recorded in their Err field, so that one corrupt
+// file does not hide the others; only failing to read dir is an error.
+// The torrents are sorted by ID.
+func LoadBTBackup(dir string) ([]Torrent, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var ts []Torrent
+	for _, e := range entries {
+		name := e.Name()
+		ext := filepath.Ext(name)
+		if e.IsDir() || (ext != ".torrent" && ext != ".fastresume") {
+			continue
+		}
+		id := strings.TrimSuffix(name, ext)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		ts = append(ts, loadTorrent(dir, id))
+	}
+	sort.Slice(ts, func(i, j int) bool { return ts[i].ID < ts[j].ID })
+	return ts, nil
+}
+
+func loadTorrent(dir, id string) Torrent {
+	t := Torrent{ID: id}
+	base := filepath.Join(dir, id)
+
+	if d, err := LoadFile(base + ".fastresume"); err != nil {
+		t.Err = err
+	} else {
+		t.Resume = d
+		t.QBt = d.QBittorrent()
+	}
+
+	mi, err := metainfo.LoadFile(base + ".torrent")
+	switch {
+	case err == nil:
+		t.MetaInfo = mi
+	case os.IsNotExist(err) && t.Resume != nil && len(t.Resume.Info) > 0:
+		t.MetaInfo = &metainfo.MetaInfo{InfoBytes: append(bencode.RawMessage(nil), t.Resume.Info...)}
+	case os.IsNotExist(err) && t.Resume != nil:
+	default:
+		if t.Err == nil {
+			t.Err = err
+		}
+	}
+	return t
+}
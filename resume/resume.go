@@ -0,0 +1,249 @@
+//go:build !bencode_lite
+
+// Package resume provides the structures of libtorrent fast-resume files, the
+// bencoded per-torrent state that libtorrent based clients keep next to their
+// .torrent files, encoded and decoded with go.x2ox.com/bencode.
+package resume
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"go.x2ox.com/bencode"
+	"go.x2ox.com/bencode/compact"
+)
+
+// FileFormat is the value of the "file-format" key of libtorrent resume files.
+const FileFormat = "libtorrent resume file"
+
+// Data is the top-level dictionary of a libtorrent resume file.
+//
+// Pieces holds one byte per piece, whose lowest bit is set when the piece has
+// been downloaded and verified. Keys that Data does not know are kept in Extra
+// so that a decoded file can be written back without losing information.
+type Data struct {
+	FileFormat  string `bencode:"file-format"`
+	FileVersion int64  `bencode:"file-version"`
+	LibVersion  string `bencode:"libtorrent-version,omitempty"`
+
+	InfoHash  []byte             `bencode:"info-hash,omitempty"`
+	InfoHash2 []byte             `bencode:"info-hash2,omitempty"`
+	Name      string             `bencode:"name,omitempty"`
+	SavePath  string             `bencode:"save_path,omitempty"`
+	Info      bencode.RawMessage `bencode:"info,omitempty"`
+
+	Pieces        []byte   `bencode:"pieces,omitempty"`
+	PiecePriority []byte   `bencode:"piece_priority,omitempty"`
+	FilePriority  []int64  `bencode:"file_priority,omitempty"`
+	MappedFiles   []string `bencode:"mapped_files,omitempty"`
+
+	Peers        compact.Peers  `bencode:"peers,omitempty"`
+	Peers6       compact.Peers6 `bencode:"peers6,omitempty"`
+	BannedPeers  compact.Peers  `bencode:"banned_peers,omitempty"`
+	BannedPeers6 compact.Peers6 `bencode:"banned_peers6,omitempty"`
+
+	Trackers  [][]string `bencode:"trackers,omitempty"`
+	URLSeeds  []string   `bencode:"url-list,omitempty"`
+	HTTPSeeds []string   `bencode:"httpseeds,omitempty"`
+
+	TotalUploaded    int64 `bencode:"total_uploaded,omitempty"`
+	TotalDownloaded  int64 `bencode:"total_downloaded,omitempty"`
+	ActiveTime       int64 `bencode:"active_time,omitempty"`
+	FinishedTime     int64 `bencode:"finished_time,omitempty"`
+	SeedingTime      int64 `bencode:"seeding_time,omitempty"`
+	AddedTime        int64 `bencode:"added_time,omitempty"`
+	CompletedTime    int64 `bencode:"completed_time,omitempty"`
+	LastSeenComplete int64 `bencode:"last_seen_complete,omitempty"`
+	NumComplete      int64 `bencode:"num_complete,omitempty"`
+	NumIncomplete    int64 `bencode:"num_incomplete,omitempty"`
+	NumDownloaded    int64 `bencode:"num_downloaded,omitempty"`
+
+	UploadRateLimit   int64 `bencode:"upload_rate_limit,omitempty"`
+	DownloadRateLimit int64 `bencode:"download_rate_limit,omitempty"`
+	MaxConnections    int64 `bencode:"max_connections,omitempty"`
+	MaxUploads        int64 `bencode:"max_uploads,omitempty"`
+
+	Paused             bool `bencode:"paused,omitempty"`
+	AutoManaged        bool `bencode:"auto_managed,omitempty"`
+	SeedMode           bool `bencode:"seed_mode,omitempty"`
+	SuperSeeding       bool `bencode:"super_seeding,omitempty"`
+	SequentialDownload bool `bencode:"sequential_download,omitempty"`
+	ShareMode          bool `bencode:"share_mode,omitempty"`
+	UploadMode         bool `bencode:"upload_mode,omitempty"`
+	DisableDHT         bool `bencode:"disable_dht,omitempty"`
+	DisableLSD         bool `bencode:"disable_lsd,omitempty"`
+	DisablePEX         bool `bencode:"disable_pex,omitempty"`
+
+	Extra map[string]bencode.RawMessage `bencode:"-"`
+}
+
+// Have reports whether piece i is marked as downloaded.
+func (d *Data) Have(i int) bool {
+	return i >= 0 && i < len(d.Pieces) && d.Pieces[i]&1 != 0
+}
+
+// Bitfield returns the downloaded pieces as a BitTorrent bitfield, most
+// significant bit first.
+func (d *Data) Bitfield() []byte {
+	b := make([]byte, (len(d.Pieces)+7)/8)
+	for i := range d.Pieces {
+		if d.Have(i) {
+			b[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return b
+}
+
+// Decode decodes resume data strictly: a value of an unexpected type is an error.
+func Decode(data []byte) (*Data, error) {
+	return decode(data, false)
+}
+
+// DecodeTolerant decodes resume data written by any client version. Values
+// of an unexpected type are left at their zero value and kept in Extra
+// instead of failing the whole file; only input that is not a dict is an error.
+func DecodeTolerant(data []byte) (*Data, error) {
+	return decode(data, true)
+}
+
+// fieldIndex maps the bencode keys of a struct type to its field indices.
+// Fields without a key in their tag are known by their name.
+func fieldIndex(t reflect.Type) map[string]int {
+	m := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("bencode"), ",")
+		if name == "-" || f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		m[name] = i
+	}
+	return m
+}
+
+// setField decodes raw into the field of v known as key. It reports false if
+// there is no such field or, in tolerant mode, if raw does not fit the field,
+// in which case the mismatch is returned as a warning.
+func setField(v reflect.Value, fields map[string]int, key string, raw []byte, tolerant bool) (bool, *Warning, error) {
+	i, ok := fields[key]
+	if !ok {
+		return false, nil, nil
+	}
+	f := v.Field(i)
+	err := bencode.Unmarshal(raw, f.Addr().Interface())
+	if err == nil {
+		return true, nil, nil
+	}
+	if !tolerant {
+		return false, nil, fmt.Errorf("resume: %s: %w", key, err)
+	}
+	f.Set(reflect.Zero(f.Type()))
+	return false, &Warning{Key: key, Err: err}, nil
+}
+
+// decodeStruct decodes the dict root into the struct v field by field. Keys
+// without a field, and in tolerant mode values that do not fit their field,
+// are returned as extra keys.
+func decodeStruct(v reflect.Value, root bencode.Value, tolerant bool) (map[string]bencode.RawMessage, []Warning, error) {
+	var (
+		fields   = fieldIndex(v.Type())
+		extra    map[string]bencode.RawMessage
+		warnings []Warning
+	)
+	for _, key := range root.Keys() {
+		raw := root.Get(key)
+		ok, w, err := setBinaryField(v, fields, key, raw)
+		if !ok && w == nil {
+			ok, w, err = setField(v, fields, key, raw.Raw(), tolerant)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if w != nil {
+			warnings = append(warnings, *w)
+		}
+		if ok {
+			continue
+		}
+		if extra == nil {
+			extra = make(map[string]bencode.RawMessage)
+		}
+		extra[key] = append(bencode.RawMessage(nil), raw.Raw()...)
+	}
+	return extra, warnings, nil
+}
+
+func decode(data []byte, tolerant bool) (*Data, error) {
+	root, err := bencode.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if root.Kind() != bencode.DictKind {
+		return nil, errors.New("resume: resume data is not a dict")
+	}
+
+	var d Data
+	if d.Extra, _, err = decodeStruct(reflect.ValueOf(&d).Elem(), root, tolerant); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Encode encodes d, including its Extra keys. Known fields take precedence
+// over Extra keys of the same name.
+func (d *Data) Encode() ([]byte, error) {
+	b, err := bencode.Marshal(d)
+	if err != nil || len(d.Extra) == 0 {
+		return b, err
+	}
+	out, err := bencode.Parse(b)
+	if err != nil {
+		return nil, err
+	}
+	for k, raw := range d.Extra {
+		if out.Get(k).Exists() {
+			continue
+		}
+		x, err := bencode.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		out.Set(k, x)
+	}
+	return out.Raw(), nil
+}
+
+// Load decodes resume data from r; see DecodeTolerant.
+func Load(r io.Reader) (*Data, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeTolerant(data)
+}
+
+// LoadFile decodes the resume file with the given name; see DecodeTolerant.
+func LoadFile(name string) (*Data, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeTolerant(data)
+}
+
+// SaveFile encodes d into the file with the given name, replacing it
+// atomically; see bencode.EncodeFile.
+func (d *Data) SaveFile(name string) error {
+	b, err := d.Encode()
+	if err != nil {
+		return err
+	}
+	return bencode.EncodeFile(name, bencode.RawMessage(b), 0o644)
+}
@@ -0,0 +1,55 @@
+//go:build !bencode_lite
+
+package resume
+
+import (
+	"bytes"
+	"testing"
+)
+
+// wrongType has a string where file-version wants an integer, next to a key
+// that Data does not know.
+const wrongType = "d11:file-format22:libtorrent resume file12:file-version3:one6:pieces3:\x01\x00\x015:x-kiti7ee"
+
+func TestDecodeStrictRejectsWrongType(t *testing.T) {
+	if d, err := Decode([]byte(wrongType)); err == nil {
+		t.Fatalf("Decode = %+v, want an error", d)
+	}
+}
+
+func TestDecodeTolerantKeepsWrongType(t *testing.T) {
+	d, err := DecodeTolerant([]byte(wrongType))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.FileFormat != FileFormat || d.FileVersion != 0 {
+		t.Fatalf("FileFormat %q, FileVersion %d", d.FileFormat, d.FileVersion)
+	}
+	if string(d.Extra["file-version"]) != "3:one" || string(d.Extra["x-kit"]) != "i7e" {
+		t.Fatalf("Extra = %q", d.Extra)
+	}
+	if !d.Have(0) || d.Have(1) || !d.Have(2) || d.Have(3) {
+		t.Fatalf("Have does not match pieces %q", d.Pieces)
+	}
+	if bf := d.Bitfield(); !bytes.Equal(bf, []byte{0xa0}) {
+		t.Fatalf("Bitfield = %08b, want 10100000", bf)
+	}
+
+	// The unknown keys are written back, but a known field wins over Extra.
+	b, err := d.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "d11:file-format22:libtorrent resume file12:file-versioni0e6:pieces3:\x01\x00\x015:x-kiti7ee"
+	if string(b) != want {
+		t.Fatalf("Encode = %q, want %q", b, want)
+	}
+}
+
+func TestDecodeRejectsNonDict(t *testing.T) {
+	for _, data := range []string{"li1ee", "i1e", "d"} {
+		if _, err := DecodeTolerant([]byte(data)); err == nil {
+			t.Errorf("DecodeTolerant(%q) succeeded", data)
+		}
+	}
+}
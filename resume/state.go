@@ -0,0 +1,109 @@
+//go:build !bencode_lite
+
+package resume
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"go.x2ox.com/bencode"
+)
+
+// Warning is a value of a state file that did not fit the field it was
+// decoded into. The field is left at its zero value and the raw value is
+// kept with the extra keys.
+type Warning struct {
+	Key string
+	Err error
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("resume: %s: %s", w.Key, w.Err)
+}
+
+// DecodeState decodes a client state file, such as dht.dat, a settings file
+// or resume data, into v permissively, for tools that migrate state between
+// many client versions. v must point to a struct, a map or an interface{}.
+//
+// For a struct, keys without a field are returned as extra keys rather than
+// being dropped, and values of an unexpected type are downgraded to warnings
+// and returned with the extra keys as well; only input that is not a dict is
+// an error. Byte strings decoded into interface{} values, at any depth, are
+// kept as []byte since state files mix text with binary node IDs, addresses
+// and hashes that are not valid UTF-8.
+func DecodeState(data []byte, v interface{}) (map[string]bencode.RawMessage, []Warning, error) {
+	root, err := bencode.Parse(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return nil, nil, errors.New("resume: DecodeState needs a non-nil pointer")
+	}
+	rv = rv.Elem()
+	if rv.Kind() != reflect.Struct {
+		x := binaryInterface(root)
+		if reflect.TypeOf(x).AssignableTo(rv.Type()) {
+			rv.Set(reflect.ValueOf(x))
+			return nil, nil, nil
+		}
+		return nil, nil, bencode.Unmarshal(data, v)
+	}
+	if root.Kind() != bencode.DictKind {
+		return nil, nil, errors.New("resume: state file is not a dict")
+	}
+	return decodeStruct(rv, root, true)
+}
+
+// setBinaryField stores raw into the field of v known as key if the field is
+// an interface{} or a generic map or list, keeping byte strings as []byte.
+// It reports false if the field is of any other type.
+func setBinaryField(v reflect.Value, fields map[string]int, key string, raw bencode.Value) (bool, *Warning, error) {
+	i, ok := fields[key]
+	if !ok {
+		return false, nil, nil
+	}
+	f := v.Field(i)
+	switch f.Type() {
+	case interfaceType, listType, dictType:
+	default:
+		return false, nil, nil
+	}
+	x := reflect.ValueOf(binaryInterface(raw))
+	if !x.Type().AssignableTo(f.Type()) {
+		f.Set(reflect.Zero(f.Type()))
+		return false, &Warning{Key: key, Err: fmt.Errorf("cannot store a bencode %s in a %s", raw.Kind(), f.Type())}, nil
+	}
+	f.Set(x)
+	return true, nil, nil
+}
+
+var (
+	interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+	listType      = reflect.TypeOf([]interface{}(nil))
+	dictType      = reflect.TypeOf(map[string]interface{}(nil))
+)
+
+// binaryInterface converts v like Value.Interface, but with byte strings as []byte.
+func binaryInterface(v bencode.Value) interface{} {
+	switch v.Kind() {
+	case bencode.IntegerKind:
+		return v.Int()
+	case bencode.StringKind:
+		return append([]byte(nil), v.Bytes()...)
+	case bencode.ListKind:
+		l := make([]interface{}, v.Len())
+		for i, e := range v.List() {
+			l[i] = binaryInterface(e)
+		}
+		return l
+	case bencode.DictKind:
+		m := make(map[string]interface{}, v.Len())
+		for _, k := range v.Keys() {
+			m[k] = binaryInterface(v.Get(k))
+		}
+		return m
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package bencode
+
+import (
+	"errors"
+	"fmt"
+)
+
+// maxNestingDepth bounds list and dict nesting when no tighter limit is set,
+// so that hostile input cannot exhaust the stack.
+const maxNestingDepth = 10000
+
+// maxIntegerDigits bounds the digits of an integer when no tighter limit is
+// set, so that hostile input cannot make the decoder buffer them without end,
+// or a big.Int grow huge.
+const maxIntegerDigits = 4096
+
+// Limits bounds what a document may contain. A zero field means the default:
+// nesting is capped at 10000 levels, integers at 4096 digits, and byte
+// strings are unlimited.
+type Limits struct {
+	MaxDepth     int // maximum nesting of lists and dicts
+	MaxStringLen int // maximum length of a single byte string
+	MaxIntDigits int // maximum number of digits of an integer, not counting its sign
+}
+
+// intDigits returns the maximum number of digits of an integer.
+func (l Limits) intDigits() int {
+	if l.MaxIntDigits > 0 && l.MaxIntDigits < maxIntegerDigits {
+		return l.MaxIntDigits
+	}
+	return maxIntegerDigits
+}
+
+// Valid reports whether data holds exactly one well-formed bencode value,
+// nested at most 10000 levels deep. Integers must be written as BEP 3
+// requires, without a leading zero or a negative zero, which Decode
+// tolerates. It does not allocate.
+func Valid(data []byte) bool {
+	end, ok := validValue(data, 0, 0)
+	return ok && end == len(data)
+}
+
+// validValue is scan for Valid: it reports whether a value starts at data[i]
+// and returns the offset just past it, without building an error.
+func validValue(data []byte, i int, depth int) (int, bool) {
+	if i >= len(data) {
+		return i, false
+	}
+	switch b := data[i]; {
+	case b == 'i':
+		return validInteger(data, i)
+	case b == 'l' || b == 'd':
+		if depth >= maxNestingDepth {
+			return i, false
+		}
+		for i++; i < len(data) && data[i] != 'e'; {
+			var ok bool
+			if b == 'd' {
+				if data[i] < '0' || data[i] > '9' {
+					return i, false
+				}
+				if i, ok = validValue(data, i, depth+1); !ok {
+					return i, false
+				}
+			}
+			if i, ok = validValue(data, i, depth+1); !ok {
+				return i, false
+			}
+		}
+		return i + 1, i < len(data)
+	case b >= '0' && b <= '9':
+		return validString(data, i)
+	}
+	return i, false
+}
+
+// validInteger reports whether a BEP 3 integer of at most 4096 digits starts
+// at data[i] and returns the offset just past it.
+func validInteger(data []byte, i int) (int, bool) {
+	start := i + 1
+	i = start
+	if i < len(data) && data[i] == '-' {
+		i++
+	}
+	digits := i
+	for i < len(data) && data[i] >= '0' && data[i] <= '9' {
+		i++
+	}
+	if i >= len(data) || data[i] != 'e' || i == digits || i-digits > maxIntegerDigits {
+		return i, false
+	}
+	return i + 1, canonicalInteger(data[start:i])
+}
+
+// validString reports whether a byte string starts at data[i] and returns
+// the offset just past it.
+func validString(data []byte, i int) (int, bool) {
+	n := 0
+	for ; i < len(data) && data[i] >= '0' && data[i] <= '9'; i++ {
+		if n > len(data) {
+			return i, false
+		}
+		n = n*10 + int(data[i]-'0')
+	}
+	if i >= len(data) || data[i] != ':' || n > len(data)-i-1 {
+		return i, false
+	}
+	return i + 1 + n, true
+}
+
+// validIntegerDigits reports whether digits, an integer without its 'i' and
+// 'e', is an optional minus sign and decimal digits, written as BEP 3
+// requires.
+func validIntegerDigits(digits []byte) bool {
+	i := 0
+	if len(digits) > 0 && digits[0] == '-' {
+		i++
+	}
+	if i == len(digits) {
+		return false
+	}
+	for _, c := range digits[i:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return canonicalInteger(digits)
+}
+
+// canonicalInteger reports whether digits, an integer without its 'i' and
+// 'e', has neither a leading zero nor a negative zero, as BEP 3 requires.
+// The digits must have been checked to be a sign and decimal digits.
+func canonicalInteger(digits []byte) bool {
+	if digits[0] == '-' {
+		return digits[1] != '0'
+	}
+	return digits[0] != '0' || len(digits) == 1
+}
+
+// Check verifies that data holds exactly one well-formed bencode value within the limits.
+func (l Limits) Check(data []byte) error {
+	return l.checkValid(data)
+}
+
+// checkValid verifies that data holds exactly one well-formed bencode value.
+func checkValid(data []byte) error {
+	return Limits{}.checkValid(data)
+}
+
+func (l Limits) checkValid(data []byte) error {
+	end, err := l.scan(data, 0, 0)
+	if err == nil && end != len(data) {
+		err = newSyntaxError(int64(end), ErrTrailingData)
+	}
+	return withContext(err, data)
+}
+
+// scanValue returns the offset just past the bencode value starting at data[i].
+func scanValue(data []byte, i int) (int, error) {
+	return Limits{}.scan(data, i, 0)
+}
+
+// scan returns the offset just past the bencode value starting at data[i],
+// which is nested depth levels deep.
+func (l Limits) scan(data []byte, i int, depth int) (int, error) {
+	if i >= len(data) {
+		return i, newSyntaxError(int64(i), ErrUnexpectedEOF)
+	}
+	if b := data[i]; b == 'l' || b == 'd' {
+		if depth >= maxNestingDepth || l.MaxDepth > 0 && depth >= l.MaxDepth {
+			return i, newSyntaxError(int64(i), ErrDepthExceeded)
+		}
+	}
+	switch b := data[i]; {
+	case b == 'i':
+		return l.scanInteger(data, i)
+	case b == 'l':
+		i++
+		for {
+			if i >= len(data) {
+				return i, newSyntaxError(int64(i), ErrUnexpectedEOF)
+			}
+			if data[i] == 'e' {
+				return i + 1, nil
+			}
+			var err error
+			if i, err = l.scan(data, i, depth+1); err != nil {
+				return i, err
+			}
+		}
+	case b == 'd':
+		i++
+		for {
+			if i >= len(data) {
+				return i, newSyntaxError(int64(i), ErrUnexpectedEOF)
+			}
+			if data[i] == 'e' {
+				return i + 1, nil
+			}
+			if data[i] < '0' || data[i] > '9' {
+				return i, newSyntaxError(int64(i), errors.New("dictionary key is not a byte string"))
+			}
+			var err error
+			if i, err = l.scanString(data, i); err != nil {
+				return i, err
+			}
+			if i, err = l.scan(data, i, depth+1); err != nil {
+				return i, err
+			}
+		}
+	case b >= '0' && b <= '9':
+		return l.scanString(data, i)
+	default:
+		return i, newUnknownValueType(int64(i), b)
+	}
+}
+
+// scanInteger returns the offset just past the integer starting at data[i].
+func scanInteger(data []byte, i int) (int, error) {
+	return Limits{}.scanInteger(data, i)
+}
+
+func (l Limits) scanInteger(data []byte, i int) (int, error) {
+	start := i
+	i++
+	if i < len(data) && data[i] == '-' {
+		i++
+	}
+	digits := i
+	for i < len(data) && data[i] >= '0' && data[i] <= '9' {
+		i++
+	}
+	if i >= len(data) {
+		return i, newSyntaxError(int64(i), ErrUnexpectedEOF)
+	}
+	if data[i] != 'e' || i == digits {
+		return i, newSyntaxError(int64(start), errors.New("malformed integer"))
+	}
+	if i-digits > l.intDigits() {
+		return i, newSyntaxError(int64(start), ErrIntegerTooLong)
+	}
+	return i + 1, nil
+}
+
+// scanString returns the offset just past the byte string starting at data[i].
+func scanString(data []byte, i int) (int, error) {
+	return Limits{}.scanString(data, i)
+}
+
+func (l Limits) scanString(data []byte, i int) (int, error) {
+	start := i
+	n := 0
+	for ; i < len(data) && data[i] >= '0' && data[i] <= '9'; i++ {
+		if n > len(data) {
+			return i, newSyntaxError(int64(start), fmt.Errorf("byte string length exceeds input: %w", ErrUnexpectedEOF))
+		}
+		n = n*10 + int(data[i]-'0')
+	}
+	if i >= len(data) {
+		return i, newSyntaxError(int64(i), ErrUnexpectedEOF)
+	}
+	if data[i] != ':' {
+		return i, newSyntaxError(int64(i), errors.New("missing ':' after byte string length"))
+	}
+	i++
+	if l.MaxStringLen > 0 && n > l.MaxStringLen {
+		return i, newSyntaxError(int64(start), ErrStringTooLong)
+	}
+	if n > len(data)-i {
+		return len(data), newSyntaxError(int64(len(data)), ErrUnexpectedEOF)
+	}
+	return i + n, nil
+}
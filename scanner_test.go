@@ -0,0 +1,62 @@
+//go:build !bencode_lite
+
+package bencode
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"i0e", true},
+		{"i-1e", true},
+		{"i42e", true},
+		{"0:", true},
+		{"4:spam", true},
+		{"le", true},
+		{"de", true},
+		{"l4:spami42ee", true},
+		{"d3:bar4:spam3:fooi42ee", true},
+		{"", false},
+		{"i-0e", false},
+		{"i03e", false},
+		{"i-03e", false},
+		{"ie", false},
+		{"i-e", false},
+		{"iabce", false},
+		{"i1", false},
+		{"5:spam", false},
+		{"4spam", false},
+		{"l", false},
+		{"d", false},
+		{"di1ei2ee", false},
+		{"d3:fooe", false},
+		{"i1ei2e", false},
+		{"x", false},
+		{strings.Repeat("l", maxNestingDepth) + strings.Repeat("e", maxNestingDepth), true},
+		{strings.Repeat("l", maxNestingDepth+1) + strings.Repeat("e", maxNestingDepth+1), false},
+	}
+	for _, tt := range tests {
+		if got := Valid([]byte(tt.in)); got != tt.want {
+			t.Errorf("Valid(%.20q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestValidAllocs(t *testing.T) {
+	for _, in := range []string{
+		"d4:infod6:lengthi1e4:name4:spamee",
+		"d4:infod6:lengthi-0e4:name4:spamee",
+		"d4:infod6:lengthi1e4:name9:spamee",
+		"d4:infod6:lengthi1e4:name4:spame",
+	} {
+		data := []byte(in)
+		if n := testing.AllocsPerRun(100, func() { Valid(data) }); n != 0 {
+			t.Errorf("Valid(%q) allocates %v times", in, n)
+		}
+	}
+}
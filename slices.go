@@ -0,0 +1,206 @@
+package bencode
+
+import (
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Slices of strings, integers and byte strings, such as file paths and
+// announce lists, make up much of typical documents. They are encoded and
+// decoded through their typed elements rather than one reflect.Value each.
+
+var (
+	stringType = reflect.TypeOf("")
+	int64Type  = reflect.TypeOf(int64(0))
+	bytesType  = reflect.TypeOf([]byte(nil))
+)
+
+// sliceAs returns the slice held by v, whose underlying type must be []T.
+func sliceAs[T any](v reflect.Value) []T {
+	if v.CanAddr() {
+		return *(*[]T)(unsafe.Pointer(v.UnsafeAddr()))
+	}
+	return v.Convert(reflect.TypeOf([]T(nil))).Interface().([]T)
+}
+
+// primitiveSliceEncoder returns the encoder of t if it is a slice of plain
+// strings, int64s or []byte whose elements have no registered encoder.
+func primitiveSliceEncoder(t reflect.Type) (encoderFunc, bool) {
+	if _, ok := typeEncoders.Load(t.Elem()); ok {
+		return nil, false
+	}
+	switch t.Elem() {
+	case stringType:
+		return stringSliceEncoder, true
+	case int64Type:
+		return int64SliceEncoder, true
+	case bytesType:
+		return bytesSliceEncoder, true
+	}
+	return nil, false
+}
+
+func stringSliceEncoder(e *encodeState, v reflect.Value) error {
+	if _, err := e.WriteString("l"); err != nil {
+		return err
+	}
+	for _, s := range sliceAs[string](v) {
+		if err := e.writeString(s); err != nil {
+			return err
+		}
+	}
+	_, err := e.WriteString("e")
+	return err
+}
+
+func int64SliceEncoder(e *encodeState, v reflect.Value) error {
+	if _, err := e.WriteString("l"); err != nil {
+		return err
+	}
+	for _, n := range sliceAs[int64](v) {
+		if err := e.writeInt(n); err != nil {
+			return err
+		}
+	}
+	_, err := e.WriteString("e")
+	return err
+}
+
+func bytesSliceEncoder(e *encodeState, v reflect.Value) error {
+	if _, err := e.WriteString("l"); err != nil {
+		return err
+	}
+	for _, b := range sliceAs[[]byte](v) {
+		if err := e.writeStringHeader(len(b)); err != nil {
+			return err
+		}
+		if _, err := e.Write(b); err != nil {
+			return err
+		}
+	}
+	_, err := e.WriteString("e")
+	return err
+}
+
+// parsePrimitiveList decodes a list into v if it is an addressable slice of
+// plain strings, int64s or []byte, reporting false if v is none of these.
+// Like parseList, it reuses the capacity of v, and leaves in it the elements
+// decoded before an error.
+func parsePrimitiveList(d *decodeState, v reflect.Value) (bool, error) {
+	if !v.CanAddr() || atomic.LoadInt32(&haveTypeDecoders) != 0 {
+		return false, nil
+	}
+	p := unsafe.Pointer(v.UnsafeAddr())
+	switch v.Type().Elem() {
+	case stringType:
+		return true, parseListOf(d, (*[]string)(p), func(b []byte) string {
+			return bytesAsString(b)
+		})
+	case bytesType:
+		return true, parseListOf(d, (*[][]byte)(p), func(b []byte) []byte {
+			return b
+		})
+	case int64Type:
+		return true, parseInt64List(d, (*[]int64)(p))
+	}
+	return false, nil
+}
+
+// grow makes room for one more element in s, doubling its capacity like
+// parseList rather than starting from one.
+func grow[T any](s []T) []T {
+	if len(s) < cap(s) {
+		return s
+	}
+	return append(make([]T, 0, 2*len(s)+4), s...)
+}
+
+// parseListOf decodes a list of byte strings into *p, converting each with conv.
+func parseListOf[T any](d *decodeState, p *[]T, conv func([]byte) T) error {
+	s := (*p)[:0]
+	defer func() { *p = s }()
+	for {
+		b, err := d.readByte()
+		if err != nil {
+			return d.failAt(len(s), err)
+		}
+		if b == 'e' {
+			d.emit(TraceEnd, d.Offset-1, d.depth-1, nil)
+			break
+		}
+		if b < '0' || b > '9' {
+			// Let the generic path report the mismatch.
+			var x T
+			if err = d.unreadByte(); err != nil {
+				return err
+			}
+			d.pushIndex(len(s))
+			if _, err = parseValue(d, reflect.ValueOf(&x).Elem()); err != nil {
+				return err
+			}
+			d.pop()
+			s = append(grow(s), x)
+			continue
+		}
+		d.Reset()
+		if err = d.WriteByte(b); err != nil {
+			return err
+		}
+		length, err := d.readStringLength()
+		if err != nil {
+			return d.failAt(len(s), err)
+		}
+		data, err := d.readLength(length)
+		if err != nil {
+			return d.failAt(len(s), err)
+		}
+		s = append(grow(s), conv(data))
+	}
+	if s == nil {
+		s = []T{}
+	}
+	return nil
+}
+
+func parseInt64List(d *decodeState, p *[]int64) error {
+	s := (*p)[:0]
+	defer func() { *p = s }()
+	for {
+		b, err := d.readByte()
+		if err != nil {
+			return d.failAt(len(s), err)
+		}
+		if b == 'e' {
+			d.emit(TraceEnd, d.Offset-1, d.depth-1, nil)
+			break
+		}
+		if b != 'i' {
+			var n int64
+			if err = d.unreadByte(); err != nil {
+				return err
+			}
+			d.pushIndex(len(s))
+			if _, err = parseValue(d, reflect.ValueOf(&n).Elem()); err != nil {
+				return err
+			}
+			d.pop()
+			s = append(grow(s), n)
+			continue
+		}
+		digits, err := d.readInt()
+		if err != nil {
+			return d.failAt(len(s), err)
+		}
+		n, err := strconv.ParseInt(digits, 10, 64)
+		if err != nil {
+			return d.failAt(len(s), d.typeError(IntegerKind, int64Type))
+		}
+		s = append(grow(s), n)
+	}
+	if s == nil {
+		s = []int64{}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package bencode
+
+// DecodeStats describes the input read by a call to Decoder.Decode, so that
+// servers can watch for payloads out of the ordinary.
+type DecodeStats struct {
+	Bytes        int64 // input bytes consumed
+	Values       int64 // integers, byte strings, lists and dicts read, dict keys included
+	MaxDepth     int   // deepest nesting of lists and dicts reached
+	MaxStringLen int64 // length of the longest byte string, dict keys included
+}
+
+// Stats returns the statistics of the last call to Decode. After a failed
+// Decode, they cover the input read until it stopped.
+func (dec *Decoder) Stats() DecodeStats {
+	return dec.d.stats
+}
+
+// count accounts for a token read nested depth lists and dicts deep, size
+// being the length of a byte string.
+func (s *DecodeStats) count(tok TraceToken, depth int, size int64) {
+	switch tok {
+	case TraceList, TraceDict:
+		if depth+1 > s.MaxDepth {
+			s.MaxDepth = depth + 1
+		}
+	case TraceString:
+		if size > s.MaxStringLen {
+			s.MaxStringLen = size
+		}
+	case TraceEnd:
+		return
+	}
+	s.Values++
+}
@@ -3,14 +3,20 @@ package bencode
 import (
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
-	"sync"
 )
 
 type encodeStructField struct {
-	i         int
-	tag       string
-	omitEmpty bool
+	i   int
+	tag string
+	// encodedKey is tag encoded as a byte string, ready to be written.
+	encodedKey string
+	omitEmpty  bool
+	set        bool
+	hex        bool
+	// runes is set for a []rune field tagged utf8, carried as a byte string.
+	runes bool
 }
 
 type encodeFieldsSortType []encodeStructField
@@ -19,7 +25,7 @@ func (ef encodeFieldsSortType) Len() int           { return len(ef) }
 func (ef encodeFieldsSortType) Swap(i, j int)      { ef[i], ef[j] = ef[j], ef[i] }
 func (ef encodeFieldsSortType) Less(i, j int) bool { return ef[i].tag < ef[j].tag }
 
-var encodeFieldCache sync.Map
+var encodeFieldCache typeCache // map[reflect.Type][]encodeStructField
 
 func cachedTypeFields(t reflect.Type) []encodeStructField {
 	if f, ok := encodeFieldCache.Load(t); ok {
@@ -49,10 +55,14 @@ func encodeFields(t reflect.Type) []encodeStructField {
 			i:         i,
 			tag:       f.Name,
 			omitEmpty: tv.OmitEmpty(),
+			set:       tv.Set(),
+			hex:       tv.Hex(),
+			runes:     tv.UTF8() && isRuneSlice(f.Type),
 		}
 		if tv.Key() != "" {
 			ef.tag = tv.Key()
 		}
+		ef.encodedKey = strconv.Itoa(len(ef.tag)) + ":" + ef.tag
 
 		current = append(current, ef)
 	}
@@ -88,33 +98,69 @@ func (t tag) HasOpt(opt string) bool {
 	return false
 }
 
+// without returns the tag with the option opt removed.
+func (t tag) without(opt string) tag {
+	u := tag{t[0]}
+	for _, s := range t[1:] {
+		if s != opt {
+			u = append(u, s)
+		}
+	}
+	return u
+}
+
 func (t tag) OmitEmpty() bool {
 	return t.HasOpt("omitempty")
 }
 
+// Set reports whether a map[string]struct{} field is encoded as a sorted list of its keys.
+func (t tag) Set() bool {
+	return t.HasOpt("set")
+}
+
+// Hex reports whether a []byte or [N]byte field is carried as a lowercase hex byte string.
+func (t tag) Hex() bool {
+	return t.HasOpt("hex")
+}
+
+// UTF8 reports whether a field holds text, checked to be valid UTF-8 by
+// decoders that validate it.
+func (t tag) UTF8() bool {
+	return t.HasOpt("utf8")
+}
+
+// isRuneSlice reports whether t is a []rune, or equally a []int32, which a
+// utf8 tag makes a UTF-8 byte string instead of a list of integers.
+func isRuneSlice(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Int32
+}
+
 func (t tag) IgnoreUnmarshalTypeError() bool {
 	return t.HasOpt("ignore_unmarshal_type_error")
 }
 
-type structField struct {
-	r   reflect.StructField
-	tag tag
+// fieldDecoder is the precompiled plan for decoding one struct field.
+type fieldDecoder struct {
+	index    int
+	key      string
+	exported bool
+	// parse decodes the field, skipping the checks parseValue does for
+	// types that cannot need them.
+	parse func(d *decodeState, v reflect.Value) (bool, error)
 }
 
-var decodeFieldCache sync.Map
+var decodeFieldCache typeCache // map[reflect.Type]map[string]*fieldDecoder
 
-func getStructFieldForKey(t reflect.Type, key string) (structField, bool) {
+func cachedFieldDecoders(t reflect.Type) map[string]*fieldDecoder {
 	v, ok := decodeFieldCache.Load(t)
 	if !ok {
 		v, _ = decodeFieldCache.LoadOrStore(t, decodeFields(t))
 	}
-
-	sf, h := v.(map[string]structField)[key]
-	return sf, h
+	return v.(map[string]*fieldDecoder)
 }
 
-func decodeFields(t reflect.Type) map[string]structField {
-	m := make(map[string]structField)
+func decodeFields(t reflect.Type) map[string]*fieldDecoder {
+	m := make(map[string]*fieldDecoder)
 
 	for i, n := 0, t.NumField(); i < n; i++ {
 		f := t.Field(i)
@@ -131,7 +177,30 @@ func decodeFields(t reflect.Type) map[string]structField {
 			key = f.Name
 		}
 
-		m[key] = structField{f, tags}
+		m[key] = &fieldDecoder{
+			index:    i,
+			key:      key,
+			exported: f.PkgPath == "",
+			parse:    fieldParser(f.Type, tags),
+		}
 	}
 	return m
 }
+
+// fieldParser picks the decoding function for a field of type t.
+func fieldParser(t reflect.Type, tags tag) func(d *decodeState, v reflect.Value) (bool, error) {
+	if tags.UTF8() && isRuneSlice(t) {
+		return parseRunesValue
+	}
+	if tags.UTF8() {
+		return parseUTF8Value(fieldParser(t, tags.without("utf8")))
+	}
+	switch {
+	case tags.Hex():
+		return parseHexValue
+	case t.Kind() == reflect.Ptr || t.Kind() == reflect.Interface,
+		t.Implements(unmarshalerType), reflect.PtrTo(t).Implements(unmarshalerType):
+		return parseValue
+	}
+	return parsePlainValue
+}
@@ -0,0 +1,247 @@
+package bencode
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// A Token is a piece of a bencode document: an integer, a byte string, the
+// start of a list or dict, or the end of the innermost one left open. The
+// entries of a dict are its keys and values in turn.
+type Token struct {
+	Kind TokenKind
+	// Data holds the digits of an integer, with its sign, or the payload of
+	// a byte string.
+	Data []byte
+}
+
+// TokenKind is the kind of a Token.
+type TokenKind uint8
+
+const (
+	TokenInteger TokenKind = iota + 1 // an integer
+	TokenString                       // a byte string
+	TokenList                         // the start of a list
+	TokenDict                         // the start of a dict
+	TokenEnd                          // the end of a list or dict
+)
+
+func (k TokenKind) String() string {
+	switch k {
+	case TokenInteger:
+		return "integer"
+	case TokenString:
+		return "string"
+	case TokenList:
+		return "list"
+	case TokenDict:
+		return "dict"
+	case TokenEnd:
+		return "end"
+	}
+	return "invalid"
+}
+
+// A TokenReader reads a document token by token, such as to convert it to
+// another format or to filter it without decoding it whole. ReadToken
+// returns io.EOF when the input ends between top-level values. The Data of
+// the tokens it returns may be retained.
+type TokenReader interface {
+	ReadToken() (Token, error)
+}
+
+// A TokenWriter writes a document token by token. WriteToken fails on a token
+// that cannot come next, such as a list where a dict key is expected.
+type TokenWriter interface {
+	WriteToken(Token) error
+}
+
+// Transcode writes to dst the tokens read from src until src returns io.EOF.
+// *Decoder is a TokenReader and *Encoder a TokenWriter, so that documents can
+// be bridged to and from other token-based formats, or rewritten as they
+// stream through a function wrapping either side.
+func Transcode(dst TokenWriter, src TokenReader) error {
+	for {
+		t, err := src.ReadToken()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err = dst.WriteToken(t); err != nil {
+			return err
+		}
+	}
+}
+
+// tokenStack holds the lists and dicts left open by a sequence of tokens, to
+// check what can come next: 'l' for a list, 'd' for a dict expecting a key,
+// and 'v' for a dict expecting the value of a key.
+type tokenStack []byte
+
+// next accounts for a token of the given kind, failing if it cannot come next.
+func (s *tokenStack) next(kind TokenKind) error {
+	if n := len(*s); n > 0 {
+		switch top := (*s)[n-1]; {
+		case kind == TokenEnd && top == 'v':
+			return errors.New("missing value")
+		case kind == TokenEnd:
+			*s = (*s)[:n-1]
+			return nil
+		case top == 'd' && kind != TokenString:
+			return errors.New("dictionary key is not a byte string")
+		case top == 'd':
+			(*s)[n-1] = 'v'
+			return nil
+		case top == 'v':
+			(*s)[n-1] = 'd'
+		}
+	} else if kind == TokenEnd {
+		return errors.New("unexpected 'e'")
+	}
+	switch kind {
+	case TokenList:
+		*s = append(*s, 'l')
+	case TokenDict:
+		*s = append(*s, 'd')
+	}
+	return nil
+}
+
+// value accounts for a whole value read or written between tokens, by Decode
+// or Encode.
+func (s tokenStack) value() {
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'd':
+			s[n-1] = 'v'
+		case 'v':
+			s[n-1] = 'd'
+		}
+	}
+}
+
+// tokenKind returns the kind of the token starting with b, or zero.
+func tokenKind(b byte) TokenKind {
+	switch {
+	case b == 'i':
+		return TokenInteger
+	case b == 'l':
+		return TokenList
+	case b == 'd':
+		return TokenDict
+	case b == 'e':
+		return TokenEnd
+	case b >= '0' && b <= '9':
+		return TokenString
+	}
+	return 0
+}
+
+// ReadToken reads the next token of the input. Calls to Decode can come in
+// between to read whole values, except where a dict key is expected. Integers
+// must be written as BEP 3 requires, without a leading zero or a negative
+// zero, or ReadToken fails with a *SyntaxError.
+func (dec *Decoder) ReadToken() (Token, error) {
+	d := &dec.d
+	d.open, d.broken = 0, false
+	if len(dec.tokens) == 0 {
+		if _, err := d.Scanner.ReadByte(); err != nil {
+			d.broken = true
+			return Token{}, err
+		}
+		if err := d.Scanner.UnreadByte(); err != nil {
+			d.broken = true
+			return Token{}, err
+		}
+	}
+	var t Token
+	dec.err = dec.withScratch(func() error {
+		b, err := d.readByte()
+		if err != nil {
+			return err
+		}
+		if t.Kind = tokenKind(b); t.Kind == 0 {
+			return d.unknownValueType(b)
+		}
+		if err = dec.tokens.next(t.Kind); err != nil {
+			return d.syntaxError(d.Offset-1, err)
+		}
+		switch t.Kind {
+		case TokenList, TokenDict:
+			d.emitOpen(b)
+			return d.enter()
+		case TokenEnd:
+			d.depth--
+			d.emit(TraceEnd, d.Offset-1, d.depth, nil)
+		case TokenInteger:
+			start := d.Offset - 1
+			s, err := d.readInt()
+			if err != nil {
+				return err
+			}
+			if !validIntegerDigits(stringAsBytes(s)) {
+				return d.syntaxError(start, fmt.Errorf("malformed integer %q", s))
+			}
+			t.Data = []byte(s)
+		default:
+			if err = d.WriteByte(b); err != nil {
+				return err
+			}
+			length, err := d.readStringLength()
+			if err != nil {
+				return err
+			}
+			t.Data, err = d.readLength(length)
+			return err
+		}
+		return nil
+	})
+	if dec.err != nil {
+		return Token{}, dec.err
+	}
+	return t, nil
+}
+
+// WriteToken writes a token to the stream. Calls to Encode can come in
+// between to write whole values, except where a dict key is expected. The
+// Data of an integer token is checked as ReadToken checks it.
+func (enc *Encoder) WriteToken(t Token) error {
+	b := enc.scratch[:0]
+	switch t.Kind {
+	case TokenInteger:
+		b = append(b, 'i')
+		b = append(b, t.Data...)
+		b = append(b, 'e')
+		if _, err := scanInteger(b, 0); err != nil || !validIntegerDigits(t.Data) {
+			return newError("invalid integer token %q", t.Data)
+		}
+	case TokenString:
+		b = strconv.AppendInt(b, int64(len(t.Data)), 10)
+		b = append(b, ':')
+	case TokenList:
+		b = append(b, 'l')
+	case TokenDict:
+		b = append(b, 'd')
+	case TokenEnd:
+		b = append(b, 'e')
+	default:
+		return newError("invalid token kind %d", t.Kind)
+	}
+	if err := enc.tokens.next(t.Kind); err != nil {
+		return newError("invalid %s token: %w", t.Kind, err)
+	}
+	enc.scratch = b
+	if _, err := enc.w.Write(b); err != nil {
+		return err
+	}
+	if t.Kind == TokenString && len(t.Data) > 0 {
+		if _, err := enc.w.Write(t.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+//go:build !bencode_lite
+
+package bencode
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadToken(t *testing.T) {
+	dec := NewDecoder(strings.NewReader("d1:ai-12e1:bli0e2:xyee"))
+	want := []Token{
+		{TokenDict, nil},
+		{TokenString, []byte("a")},
+		{TokenInteger, []byte("-12")},
+		{TokenString, []byte("b")},
+		{TokenList, nil},
+		{TokenInteger, []byte("0")},
+		{TokenString, []byte("xy")},
+		{TokenEnd, nil},
+		{TokenEnd, nil},
+	}
+	for i, w := range want {
+		tok, err := dec.ReadToken()
+		if err != nil {
+			t.Fatalf("token %d: %v", i, err)
+		}
+		if tok.Kind != w.Kind || !bytes.Equal(tok.Data, w.Data) {
+			t.Fatalf("token %d = %v %q, want %v %q", i, tok.Kind, tok.Data, w.Kind, w.Data)
+		}
+	}
+	if _, err := dec.ReadToken(); err != io.EOF {
+		t.Fatalf("ReadToken at the end = %v, want io.EOF", err)
+	}
+}
+
+func TestReadTokenMalformedInteger(t *testing.T) {
+	tests := []struct {
+		in     string
+		offset int64
+	}{
+		{"iabce", 0},
+		{"i-0e", 0},
+		{"i03e", 0},
+		{"i-e", 0},
+		{"ie", 0},
+		{"i1-2e", 0},
+		{"li1ei007ee", 4},
+	}
+	for _, tt := range tests {
+		dec := NewDecoder(strings.NewReader(tt.in))
+		var err error
+		for err == nil {
+			_, err = dec.ReadToken()
+		}
+		var se *SyntaxError
+		if !errors.As(err, &se) {
+			t.Errorf("%q: got %v, want a *SyntaxError", tt.in, err)
+			continue
+		}
+		if se.Offset != tt.offset {
+			t.Errorf("%q: error at offset %d, want %d", tt.in, se.Offset, tt.offset)
+		}
+	}
+}
+
+func TestWriteToken(t *testing.T) {
+	var w bytes.Buffer
+	enc := NewEncoder(&w)
+	for _, data := range []string{"-0", "03", "abc", "", "-", "1-2"} {
+		if err := enc.WriteToken(Token{Kind: TokenInteger, Data: []byte(data)}); err == nil {
+			t.Errorf("WriteToken accepted the integer %q", data)
+		}
+	}
+	if w.Len() != 0 {
+		t.Fatalf("invalid tokens wrote %q", w.Bytes())
+	}
+	if err := enc.WriteToken(Token{Kind: TokenString}); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.WriteToken(Token{Kind: TokenEnd}); err == nil {
+		t.Fatal("WriteToken accepted an end outside of a list or dict")
+	}
+}
+
+func TestTranscode(t *testing.T) {
+	in := "d1:ai-12e1:bli0e2:xyd1:ci1eeee"
+	var w bytes.Buffer
+	if err := Transcode(NewEncoder(&w), NewDecoder(strings.NewReader(in))); err != nil {
+		t.Fatal(err)
+	}
+	if w.String() != in {
+		t.Fatalf("Transcode = %q, want %q", w.String(), in)
+	}
+
+	// Decode and Encode can come in between tokens.
+	dec := NewDecoder(strings.NewReader("l1:xd1:ai1eee"))
+	if tok, err := dec.ReadToken(); err != nil || tok.Kind != TokenList {
+		t.Fatalf("ReadToken = %v, %v", tok, err)
+	}
+	var s string
+	var m map[string]int
+	if err := dec.Decode(&s); err != nil || s != "x" {
+		t.Fatalf("Decode = %q, %v", s, err)
+	}
+	if err := dec.Decode(&m); err != nil || !reflect.DeepEqual(m, map[string]int{"a": 1}) {
+		t.Fatalf("Decode = %v, %v", m, err)
+	}
+	if tok, err := dec.ReadToken(); err != nil || tok.Kind != TokenEnd {
+		t.Fatalf("ReadToken = %v, %v", tok, err)
+	}
+}
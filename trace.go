@@ -0,0 +1,83 @@
+package bencode
+
+import "fmt"
+
+// TraceToken is the kind of a token reported to a trace hook.
+type TraceToken uint8
+
+const (
+	TraceInteger TraceToken = iota + 1 // an integer, whose digits are the data
+	TraceString                        // a byte string, whose payload is the data
+	TraceList                          // the start of a list
+	TraceDict                          // the start of a dict
+	TraceEnd                           // the end of a list or dict
+)
+
+func (t TraceToken) String() string {
+	switch t {
+	case TraceInteger:
+		return "integer"
+	case TraceString:
+		return "string"
+	case TraceList:
+		return "list"
+	case TraceDict:
+		return "dict"
+	case TraceEnd:
+		return "end"
+	}
+	return "invalid"
+}
+
+// A TraceEvent describes a token read by a Decoder. The entries of a dict are
+// reported as its keys and values in turn.
+type TraceEvent struct {
+	Token  TraceToken
+	Offset int64 // input offset of the first byte of the token
+	Depth  int   // number of lists and dicts the token is in
+	// Data holds the digits of an integer or the payload of a byte string.
+	// It is only valid during the call to the hook, and is nil for byte
+	// strings skipped without being read, such as the values of unknown keys.
+	Data []byte
+}
+
+func (e TraceEvent) String() string {
+	if e.Token == TraceInteger || e.Token == TraceString {
+		return fmt.Sprintf("%d: %*s%s %q", e.Offset, 2*e.Depth, "", e.Token, e.Data)
+	}
+	return fmt.Sprintf("%d: %*s%s", e.Offset, 2*e.Depth, "", e.Token)
+}
+
+// SetTrace makes the decoder call fn with every token it reads, in input
+// order, such as to log exactly what was parsed of the input of another
+// client. A nil fn, the default, turns tracing off.
+func (dec *Decoder) SetTrace(fn func(ev TraceEvent)) {
+	dec.d.trace = fn
+}
+
+// emitOpen reports the start of the list or dict opened by b, just read.
+func (d *decodeState) emitOpen(b byte) {
+	if b == 'd' {
+		d.emit(TraceDict, d.Offset-1, d.depth, nil)
+	} else {
+		d.emit(TraceList, d.Offset-1, d.depth, nil)
+	}
+}
+
+// emit accounts for a token in the statistics, and reports it to the trace
+// hook, if any.
+func (d *decodeState) emit(tok TraceToken, offset int64, depth int, data []byte) {
+	d.stats.count(tok, depth, int64(len(data)))
+	if d.trace != nil {
+		d.trace(TraceEvent{Token: tok, Offset: offset, Depth: depth, Data: data})
+	}
+}
+
+// emitSkipped reports a byte string of the given length, skipped without
+// being read.
+func (d *decodeState) emitSkipped(offset int64, depth int, length int64) {
+	d.stats.count(TraceString, depth, length)
+	if d.trace != nil {
+		d.trace(TraceEvent{Token: TraceString, Offset: offset, Depth: depth})
+	}
+}
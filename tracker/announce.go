@@ -0,0 +1,95 @@
+//go:build !bencode_lite
+
+// Package tracker provides the bencoded messages exchanged with BitTorrent
+// HTTP trackers (BEP 3, BEP 23 and BEP 48).
+package tracker
+
+import (
+	"net"
+	"net/netip"
+	"strconv"
+
+	"go.x2ox.com/bencode"
+	"go.x2ox.com/bencode/compact"
+)
+
+// AnnounceResponse is the dictionary a tracker returns for an announce request.
+// Use Err and Warning, or ParseAnnounceResponse, to get the failure and the
+// warning as typed errors.
+type AnnounceResponse struct {
+	FailureReason  string         `bencode:"failure reason,omitempty"`
+	RetryIn        RetryIn        `bencode:"retry in,omitempty"`
+	WarningMessage string         `bencode:"warning message,omitempty"`
+	Interval       int64          `bencode:"interval,omitempty"`
+	MinInterval    int64          `bencode:"min interval,omitempty"`
+	TrackerID      string         `bencode:"tracker id,omitempty"`
+	Complete       int64          `bencode:"complete,omitempty"`
+	Incomplete     int64          `bencode:"incomplete,omitempty"`
+	Peers          Peers          `bencode:"peers,omitempty"`
+	Peers6         compact.Peers6 `bencode:"peers6,omitempty"`
+}
+
+// AllPeers returns the IPv4 and IPv6 peers of r in a single list.
+func (r *AnnounceResponse) AllPeers() Peers {
+	all := append(Peers(nil), r.Peers...)
+	return append(all, peersFromAddrs(nil, r.Peers6)...)
+}
+
+// Peer is a peer returned by a tracker. Peers from the compact model carry no ID.
+type Peer struct {
+	ID   []byte `bencode:"peer id,omitempty"`
+	IP   string `bencode:"ip"`
+	Port uint16 `bencode:"port"`
+}
+
+// AddrPort returns the address of p. It fails if IP is a host name rather than an address.
+func (p Peer) AddrPort() (netip.AddrPort, error) {
+	addr, err := netip.ParseAddr(p.IP)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	return netip.AddrPortFrom(addr, p.Port), nil
+}
+
+func (p Peer) String() string {
+	return net.JoinHostPort(p.IP, strconv.Itoa(int(p.Port)))
+}
+
+// Peers is a peer list that decodes from both the dictionary model, a list of
+// dicts, and the compact model of BEP 23, a byte string of 6-byte entries.
+// It encodes in the compact model when every peer has an IPv4 address and no ID.
+type Peers []Peer
+
+// MarshalBencode encodes ps in the compact model when possible, and in the dictionary model otherwise.
+func (ps Peers) MarshalBencode() ([]byte, error) {
+	addrs := make(compact.Peers, 0, len(ps))
+	for _, p := range ps {
+		addr, err := p.AddrPort()
+		if err != nil || !addr.Addr().Is4() || len(p.ID) != 0 {
+			return bencode.Marshal([]Peer(ps))
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs.MarshalBencode()
+}
+
+// UnmarshalBencode decodes either peer model.
+func (ps *Peers) UnmarshalBencode(data []byte) error {
+	if len(data) > 0 && data[0] == 'l' {
+		return bencode.Unmarshal(data, (*[]Peer)(ps))
+	}
+	var addrs compact.Peers
+	if err := addrs.UnmarshalBencode(data); err != nil {
+		return err
+	}
+	*ps = peersFromAddrs(*ps, addrs)
+	return nil
+}
+
+func peersFromAddrs(ps Peers, addrs []netip.AddrPort) Peers {
+	ps = ps[:0]
+	for _, a := range addrs {
+		ps = append(ps, Peer{IP: a.Addr().String(), Port: a.Port()})
+	}
+	return ps
+}
@@ -0,0 +1,80 @@
+//go:build !bencode_lite
+
+package tracker
+
+import (
+	"reflect"
+	"testing"
+
+	"go.x2ox.com/bencode"
+)
+
+func TestAnnounceResponsePeerModels(t *testing.T) {
+	want := Peers{{IP: "10.0.0.1", Port: 6881}, {IP: "192.168.1.2", Port: 80}}
+	for _, tt := range []struct {
+		name, data string
+	}{
+		{"compact", "d8:intervali1800e5:peers12:\x0a\x00\x00\x01\x1a\xe1\xc0\xa8\x01\x02\x00\x50e"},
+		{"dictionary", "d8:intervali1800e5:peersld2:ip8:10.0.0.14:porti6881eed2:ip11:192.168.1.24:porti80eeee"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var r AnnounceResponse
+			if err := bencode.Unmarshal([]byte(tt.data), &r); err != nil {
+				t.Fatal(err)
+			}
+			if r.Interval != 1800 || !reflect.DeepEqual(r.Peers, want) {
+				t.Fatalf("got interval %d, peers %v", r.Interval, r.Peers)
+			}
+		})
+	}
+}
+
+func TestAnnounceResponseAllPeers(t *testing.T) {
+	data := "d5:peers6:\x0a\x00\x00\x01\x1a\xe16:peers618:" +
+		"\x20\x01\x0d\xb8\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01\x00\x50e"
+	var r AnnounceResponse
+	if err := bencode.Unmarshal([]byte(data), &r); err != nil {
+		t.Fatal(err)
+	}
+	want := Peers{{IP: "10.0.0.1", Port: 6881}, {IP: "2001:db8::1", Port: 80}}
+	if got := r.AllPeers(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("AllPeers = %v, want %v", got, want)
+	}
+}
+
+func TestPeersMarshal(t *testing.T) {
+	tests := []struct {
+		name  string
+		peers Peers
+		want  string
+	}{
+		{"compact", Peers{{IP: "10.0.0.1", Port: 6881}}, "6:\x0a\x00\x00\x01\x1a\xe1"},
+		{"peer id", Peers{{ID: []byte("id"), IP: "10.0.0.1", Port: 1}}, "ld2:ip8:10.0.0.17:peer id2:id4:porti1eee"},
+		{"host name", Peers{{IP: "example.com", Port: 1}}, "ld2:ip11:example.com4:porti1eee"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := bencode.Marshal(tt.peers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Fatalf("Marshal = %q, want %q", b, tt.want)
+			}
+			var got Peers
+			if err = bencode.Unmarshal(b, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.peers) {
+				t.Fatalf("round trip = %v, want %v", got, tt.peers)
+			}
+		})
+	}
+}
+
+func TestPeersRejectsTruncatedCompact(t *testing.T) {
+	var ps Peers
+	if err := bencode.Unmarshal([]byte("5:\x0a\x00\x00\x01\x1a"), &ps); err == nil {
+		t.Fatalf("Unmarshal of a 5-byte compact peer string succeeded: %v", ps)
+	}
+}
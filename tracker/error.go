@@ -0,0 +1,122 @@
+//go:build !bencode_lite
+
+package tracker
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.x2ox.com/bencode"
+)
+
+// RetryIn is the "retry in" hint of a failed response (BEP 31): the number of
+// minutes to wait before retrying, or RetryNever. Zero means no hint.
+type RetryIn int64
+
+// RetryNever asks the client not to retry at all.
+const RetryNever RetryIn = -1
+
+// MarshalBencode encodes r as an integer, or as the string "never".
+func (r RetryIn) MarshalBencode() ([]byte, error) {
+	if r < 0 {
+		return []byte("5:never"), nil
+	}
+	return bencode.Marshal(int64(r))
+}
+
+// UnmarshalBencode decodes an integer number of minutes or the string "never".
+func (r *RetryIn) UnmarshalBencode(data []byte) error {
+	if len(data) > 0 && data[0] == 'i' {
+		return bencode.Unmarshal(data, (*int64)(r))
+	}
+	var s string
+	if err := bencode.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if s != "never" {
+		return fmt.Errorf("tracker: invalid retry in %q", s)
+	}
+	*r = RetryNever
+	return nil
+}
+
+// FailureError is the refusal of a request by a tracker, reported in the
+// "failure reason" key.
+type FailureError struct {
+	Reason  string
+	RetryIn RetryIn
+}
+
+func (e *FailureError) Error() string {
+	switch {
+	case e.RetryIn == RetryNever:
+		return "tracker: " + e.Reason + " (do not retry)"
+	case e.RetryIn > 0:
+		return "tracker: " + e.Reason + " (retry in " + strconv.FormatInt(int64(e.RetryIn), 10) + " minutes)"
+	}
+	return "tracker: " + e.Reason
+}
+
+// Retry returns how long to wait before retrying, and false if the tracker
+// asked not to retry. Without a hint it returns 0 and true.
+func (e *FailureError) Retry() (time.Duration, bool) {
+	if e.RetryIn == RetryNever {
+		return 0, false
+	}
+	return time.Duration(e.RetryIn) * time.Minute, true
+}
+
+// WarningError is a warning that a tracker sent along with a successful
+// response, reported in the "warning message" key.
+type WarningError struct {
+	Message string
+}
+
+func (e *WarningError) Error() string {
+	return "tracker: warning: " + e.Message
+}
+
+// Err returns a *FailureError if the tracker refused the announce, and nil otherwise.
+func (r *AnnounceResponse) Err() error {
+	if r.FailureReason == "" {
+		return nil
+	}
+	return &FailureError{Reason: r.FailureReason, RetryIn: r.RetryIn}
+}
+
+// Warning returns a *WarningError if the tracker sent a warning, and nil otherwise.
+func (r *AnnounceResponse) Warning() error {
+	if r.WarningMessage == "" {
+		return nil
+	}
+	return &WarningError{Message: r.WarningMessage}
+}
+
+// Err returns a *FailureError if the tracker refused the scrape, and nil otherwise.
+func (r *ScrapeResponse) Err() error {
+	if r.FailureReason == "" {
+		return nil
+	}
+	return &FailureError{Reason: r.FailureReason, RetryIn: r.RetryIn}
+}
+
+// ParseAnnounceResponse decodes an announce response. If the tracker refused
+// the announce, it returns the response along with a *FailureError.
+func ParseAnnounceResponse(data []byte) (*AnnounceResponse, error) {
+	var r AnnounceResponse
+	if err := bencode.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return &r, r.Err()
+}
+
+// ParseScrapeResponse decodes a scrape response. If the tracker refused the
+// scrape, it returns the response along with a *FailureError.
+func ParseScrapeResponse(data []byte) (*ScrapeResponse, error) {
+	var r ScrapeResponse
+	if err := bencode.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return &r, r.Err()
+}
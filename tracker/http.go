@@ -0,0 +1,67 @@
+//go:build !bencode_lite
+
+package tracker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go.x2ox.com/bencode"
+)
+
+// DecodeHTTPResponse reads the body of the response of a tracker to an
+// announce or scrape into v, such as an *AnnounceResponse, and closes it.
+// Bodies of more than maxSize bytes are rejected, unless maxSize is zero or
+// less, and reading stops with the error of the context of the request once
+// it is done. If the tracker refused the request, v is decoded all the same
+// and a *FailureError is returned. A status other than 2xx without a failure
+// reason is an error too.
+func DecodeHTTPResponse(resp *http.Response, v interface{}, maxSize int64) error {
+	defer resp.Body.Close()
+	ctx := context.Background()
+	if resp.Request != nil {
+		ctx = resp.Request.Context()
+	}
+	var r io.Reader = ctxReader{ctx, resp.Body}
+	if maxSize > 0 {
+		if resp.ContentLength > maxSize {
+			return fmt.Errorf("tracker: response of %d bytes exceeds the max size of %d", resp.ContentLength, maxSize)
+		}
+		r = io.LimitReader(r, maxSize+1)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if maxSize > 0 && int64(len(data)) > maxSize {
+		return fmt.Errorf("tracker: response exceeds the max size of %d", maxSize)
+	}
+
+	var failure struct {
+		FailureReason string  `bencode:"failure reason"`
+		RetryIn       RetryIn `bencode:"retry in"`
+	}
+	if bencode.Unmarshal(data, &failure) == nil && failure.FailureReason != "" {
+		_ = bencode.Unmarshal(data, v)
+		return &FailureError{Reason: failure.FailureReason, RetryIn: failure.RetryIn}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("tracker: HTTP status %s", resp.Status)
+	}
+	return bencode.Unmarshal(data, v)
+}
+
+// ctxReader reads from r until ctx is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
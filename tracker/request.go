@@ -0,0 +1,222 @@
+//go:build !bencode_lite
+
+package tracker
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.x2ox.com/bencode/metainfo"
+)
+
+// Event is the event parameter of an announce request.
+type Event string
+
+const (
+	EventNone      Event = ""
+	EventStarted   Event = "started"
+	EventStopped   Event = "stopped"
+	EventCompleted Event = "completed"
+)
+
+// AnnounceRequest holds the parameters of an HTTP announce request (BEP 3, BEP 23).
+type AnnounceRequest struct {
+	InfoHash   metainfo.Hash
+	PeerID     [20]byte
+	IP         string
+	Port       uint16
+	Uploaded   int64
+	Downloaded int64
+	Left       int64
+	Event      Event
+	Compact    bool
+	NoPeerID   bool
+	// NumWant is the number of peers wanted; it is left out when nil, and
+	// the tracker then picks the number.
+	NumWant   *int
+	Key       string
+	TrackerID string
+}
+
+// RawQuery returns the query string of r. The raw info_hash and peer_id
+// bytes are percent-encoded byte by byte; every byte outside the unreserved
+// set of RFC 3986 is escaped, spaces included, so that trackers decode them
+// back to the exact bytes whatever their unescaping rules.
+func (r AnnounceRequest) RawQuery() string {
+	var b strings.Builder
+	add := func(key, value string) {
+		if b.Len() > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(escapeBytes(value))
+	}
+	add("info_hash", string(r.InfoHash[:]))
+	add("peer_id", string(r.PeerID[:]))
+	if r.IP != "" {
+		add("ip", r.IP)
+	}
+	add("port", strconv.FormatUint(uint64(r.Port), 10))
+	add("uploaded", strconv.FormatInt(r.Uploaded, 10))
+	add("downloaded", strconv.FormatInt(r.Downloaded, 10))
+	add("left", strconv.FormatInt(r.Left, 10))
+	if r.Event != EventNone {
+		add("event", string(r.Event))
+	}
+	if r.Compact {
+		add("compact", "1")
+	}
+	if r.NoPeerID {
+		add("no_peer_id", "1")
+	}
+	if r.NumWant != nil {
+		add("numwant", strconv.Itoa(*r.NumWant))
+	}
+	if r.Key != "" {
+		add("key", r.Key)
+	}
+	if r.TrackerID != "" {
+		add("trackerid", r.TrackerID)
+	}
+	return b.String()
+}
+
+// URL returns the announce URL for r, appending its parameters to the query
+// the announce URL may already carry.
+func (r AnnounceRequest) URL(announce string) (string, error) {
+	return appendQuery(announce, r.RawQuery())
+}
+
+// ParseAnnounceRequest parses the query string of an announce request, as
+// received by a tracker.
+func ParseAnnounceRequest(rawQuery string) (AnnounceRequest, error) {
+	q, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return AnnounceRequest{}, err
+	}
+	r := AnnounceRequest{
+		IP:        q.Get("ip"),
+		Event:     Event(q.Get("event")),
+		Compact:   q.Get("compact") == "1",
+		NoPeerID:  q.Get("no_peer_id") == "1",
+		Key:       q.Get("key"),
+		TrackerID: q.Get("trackerid"),
+	}
+	if err = parseRaw20(q, "info_hash", r.InfoHash[:]); err != nil {
+		return AnnounceRequest{}, err
+	}
+	if err = parseRaw20(q, "peer_id", r.PeerID[:]); err != nil {
+		return AnnounceRequest{}, err
+	}
+	port, err := strconv.ParseUint(q.Get("port"), 10, 16)
+	if err != nil {
+		return AnnounceRequest{}, fmt.Errorf("tracker: invalid port %q", q.Get("port"))
+	}
+	r.Port = uint16(port)
+	for _, p := range []struct {
+		key string
+		n   *int64
+	}{{"uploaded", &r.Uploaded}, {"downloaded", &r.Downloaded}, {"left", &r.Left}} {
+		if s := q.Get(p.key); s != "" {
+			if *p.n, err = strconv.ParseInt(s, 10, 64); err != nil {
+				return AnnounceRequest{}, fmt.Errorf("tracker: invalid %s %q", p.key, s)
+			}
+		}
+	}
+	if s := q.Get("numwant"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return AnnounceRequest{}, fmt.Errorf("tracker: invalid numwant %q", s)
+		}
+		r.NumWant = &n
+	}
+	switch r.Event {
+	case EventNone, EventStarted, EventStopped, EventCompleted:
+	default:
+		return AnnounceRequest{}, fmt.Errorf("tracker: invalid event %q", r.Event)
+	}
+	return r, nil
+}
+
+// RawQuery returns the query string of r, escaped like AnnounceRequest.RawQuery.
+func (r ScrapeRequest) RawQuery() string {
+	parts := make([]string, len(r.InfoHashes))
+	for i, h := range r.InfoHashes {
+		parts[i] = "info_hash=" + escapeBytes(string(h[:]))
+	}
+	return strings.Join(parts, "&")
+}
+
+// URL returns the scrape URL for r, derived from the announce URL with ScrapeURL.
+func (r ScrapeRequest) URL(announce string) (string, error) {
+	scrape, err := ScrapeURL(announce)
+	if err != nil {
+		return "", err
+	}
+	return appendQuery(scrape, r.RawQuery())
+}
+
+// ParseScrapeRequest parses the query string of a scrape request, as received by a tracker.
+func ParseScrapeRequest(rawQuery string) (ScrapeRequest, error) {
+	q, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return ScrapeRequest{}, err
+	}
+	var r ScrapeRequest
+	for _, s := range q["info_hash"] {
+		var h metainfo.Hash
+		if len(s) != len(h) {
+			return ScrapeRequest{}, fmt.Errorf("tracker: info_hash of %d bytes", len(s))
+		}
+		copy(h[:], s)
+		r.InfoHashes = append(r.InfoHashes, h)
+	}
+	return r, nil
+}
+
+func parseRaw20(q url.Values, key string, dst []byte) error {
+	s, ok := q[key]
+	if !ok {
+		return errors.New("tracker: missing " + key)
+	}
+	if len(s[0]) != len(dst) {
+		return fmt.Errorf("tracker: %s of %d bytes, want %d", key, len(s[0]), len(dst))
+	}
+	copy(dst, s[0])
+	return nil
+}
+
+// appendQuery appends rawQuery to the query of the URL u.
+func appendQuery(u, rawQuery string) (string, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "", err
+	}
+	if parsed.RawQuery != "" {
+		rawQuery = parsed.RawQuery + "&" + rawQuery
+	}
+	parsed.RawQuery = rawQuery
+	return parsed.String(), nil
+}
+
+// escapeBytes percent-encodes every byte of s outside the unreserved set of RFC 3986.
+func escapeBytes(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&15])
+	}
+	return b.String()
+}
@@ -0,0 +1,43 @@
+//go:build !bencode_lite
+
+package tracker
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnnounceRequestDefaultQuery(t *testing.T) {
+	var r AnnounceRequest
+	r.InfoHash[0], r.PeerID[19] = 0xff, ' '
+	r.Port = 6881
+	want := "info_hash=%FF" + strings.Repeat("%00", 19) +
+		"&peer_id=" + strings.Repeat("%00", 19) + "%20" +
+		"&port=6881&uploaded=0&downloaded=0&left=0"
+	if got := r.RawQuery(); got != want {
+		t.Fatalf("RawQuery = %q, want %q", got, want)
+	}
+}
+
+func TestAnnounceRequestNumWant(t *testing.T) {
+	zero := 0
+	r := AnnounceRequest{Port: 1, NumWant: &zero}
+	if !strings.Contains(r.RawQuery(), "&numwant=0") {
+		t.Fatalf("RawQuery = %q, want numwant=0", r.RawQuery())
+	}
+	for _, tt := range []struct {
+		query string
+		want  *int
+	}{
+		{r.RawQuery(), &zero},
+		{AnnounceRequest{Port: 1}.RawQuery(), nil},
+	} {
+		got, err := ParseAnnounceRequest(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (got.NumWant == nil) != (tt.want == nil) || got.NumWant != nil && *got.NumWant != *tt.want {
+			t.Errorf("ParseAnnounceRequest(%q).NumWant = %v, want %v", tt.query, got.NumWant, tt.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+//go:build !bencode_lite
+
+package tracker
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"go.x2ox.com/bencode"
+	"go.x2ox.com/bencode/metainfo"
+)
+
+// ScrapeRequest asks a tracker for the statistics of some torrents (BEP 48).
+// An empty InfoHashes asks for every torrent the tracker is willing to report.
+type ScrapeRequest struct {
+	InfoHashes []metainfo.Hash
+}
+
+// Query returns the query parameters of r, with the raw infohash bytes percent-encoded.
+func (r ScrapeRequest) Query() url.Values {
+	q := make(url.Values)
+	for _, h := range r.InfoHashes {
+		q.Add("info_hash", string(h[:]))
+	}
+	return q
+}
+
+// ScrapeURL derives the scrape URL from an announce URL by the convention of
+// BEP 48: the last path component must start with "announce", which is replaced by "scrape".
+func ScrapeURL(announce string) (string, error) {
+	u, err := url.Parse(announce)
+	if err != nil {
+		return "", err
+	}
+	i := strings.LastIndexByte(u.Path, '/')
+	if !strings.HasPrefix(u.Path[i+1:], "announce") {
+		return "", errors.New("tracker: announce URL does not support scraping")
+	}
+	u.Path = u.Path[:i+1] + "scrape" + u.Path[i+1+len("announce"):]
+	return u.String(), nil
+}
+
+// ScrapeResponse is the dictionary a tracker returns for a scrape request.
+type ScrapeResponse struct {
+	FailureReason string      `bencode:"failure reason,omitempty"`
+	RetryIn       RetryIn     `bencode:"retry in,omitempty"`
+	Files         ScrapeFiles `bencode:"files"`
+}
+
+// ScrapeFile holds the statistics of one torrent.
+type ScrapeFile struct {
+	Complete   int64  `bencode:"complete"`
+	Downloaded int64  `bencode:"downloaded"`
+	Incomplete int64  `bencode:"incomplete"`
+	Name       string `bencode:"name,omitempty"`
+}
+
+// ScrapeFiles maps infohashes to their statistics. On the wire it is a dict
+// keyed by the raw 20-byte infohashes.
+type ScrapeFiles map[metainfo.Hash]ScrapeFile
+
+// MarshalBencode encodes fs as a dict keyed by the raw infohash bytes.
+func (fs ScrapeFiles) MarshalBencode() ([]byte, error) {
+	m := make(map[string]ScrapeFile, len(fs))
+	for h, f := range fs {
+		m[string(h[:])] = f
+	}
+	return bencode.Marshal(m)
+}
+
+// UnmarshalBencode decodes a dict keyed by raw infohash bytes.
+func (fs *ScrapeFiles) UnmarshalBencode(data []byte) error {
+	var m map[string]ScrapeFile
+	if err := bencode.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*fs = make(ScrapeFiles, len(m))
+	for k, f := range m {
+		var h metainfo.Hash
+		if len(k) != len(h) {
+			return fmt.Errorf("tracker: scrape key of %d bytes is not an infohash", len(k))
+		}
+		copy(h[:], k)
+		(*fs)[h] = f
+	}
+	return nil
+}
@@ -26,12 +26,27 @@ func isEmptyValue(v reflect.Value) bool {
 	return v.Interface() == reflect.Zero(v.Type()).Interface()
 }
 
+// isNilInterface reports whether v is an interface holding nothing. Bencode has no null,
+// so dictionary entries with such values are left out when encoding.
+func isNilInterface(v reflect.Value) bool {
+	return v.Kind() == reflect.Interface && v.IsNil()
+}
+
+// isSetType reports whether t is a map with string keys and empty struct values.
+func isSetType(t reflect.Type) bool {
+	return t.Kind() == reflect.Map && t.Key().Kind() == reflect.String &&
+		t.Elem().Kind() == reflect.Struct && t.Elem().NumField() == 0
+}
+
+// bytesAsString returns a string sharing the memory of b, without copying.
+// b must not be modified afterwards; a string taken from a buffer that is
+// reused must not outlive the next write to it.
 func bytesAsString(b []byte) string {
-	if len(b) == 0 {
-		return ""
-	}
-	return *(*string)(unsafe.Pointer(&reflect.StringHeader{
-		Data: uintptr(unsafe.Pointer(&b[0])),
-		Len:  len(b),
-	}))
+	return unsafe.String(unsafe.SliceData(b), len(b))
+}
+
+// stringAsBytes returns a slice sharing the memory of s, without copying.
+// The slice must not be modified.
+func stringAsBytes(s string) []byte {
+	return unsafe.Slice(unsafe.StringData(s), len(s))
 }
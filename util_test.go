@@ -0,0 +1,79 @@
+//go:build !bencode_lite
+
+package bencode
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// The benchmarks below compare bytesAsString with the copying conversion it
+// replaced on the hot paths of the decoder: parsing the digits of integers
+// and byte string lengths out of the decode buffer, and storing decoded byte
+// strings, freshly allocated by readLength, into string values.
+
+var benchInt int64
+
+func BenchmarkParseIntDigits(b *testing.B) {
+	digits := []byte("-1234567890123")
+	b.Run("bytesAsString", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			n, _ := strconv.ParseInt(bytesAsString(digits), 10, 64)
+			benchInt += n
+		}
+	})
+	b.Run("copy", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			n, _ := strconv.ParseInt(string(digits), 10, 64)
+			benchInt += n
+		}
+	})
+}
+
+func BenchmarkSetStringField(b *testing.B) {
+	for _, size := range []int{8, 64, 1024} {
+		payload := []byte(strings.Repeat("x", size))
+		var s string
+		v := reflect.ValueOf(&s).Elem()
+		b.Run(strconv.Itoa(size)+"/bytesAsString", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				buf := append([]byte(nil), payload...) // as allocated by readLength
+				v.SetString(bytesAsString(buf))
+			}
+		})
+		b.Run(strconv.Itoa(size)+"/copy", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				buf := append([]byte(nil), payload...)
+				v.SetString(string(buf))
+			}
+		})
+	}
+}
+
+// BenchmarkUnmarshalStrings measures a decode dominated by these paths.
+func BenchmarkUnmarshalStrings(b *testing.B) {
+	var doc strings.Builder
+	doc.WriteString("l")
+	for i := 0; i < 100; i++ {
+		doc.WriteString("d4:name20:" + strings.Repeat("n", 20) + "4:sizei" + strconv.Itoa(i*1000003) + "ee")
+	}
+	doc.WriteString("e")
+	data := []byte(doc.String())
+	var v []struct {
+		Name string `bencode:"name"`
+		Size int64  `bencode:"size"`
+	}
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := Unmarshal(data, &v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package bencode
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Severity grades an Issue.
+type Severity uint8
+
+const (
+	// SeverityWarning marks valid bencode that is not in canonical form.
+	SeverityWarning Severity = iota + 1
+	// SeverityError marks malformed input and values over the limits, which
+	// decoding rejects.
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return "unknown"
+}
+
+// An Issue is a problem found by Validate.
+type Issue struct {
+	Severity Severity
+	Rule     LintRule // rule of a canonical-form issue, zero for the others
+	Path     Path     // location of the offending value, or of the entry for key issues
+	Offset   int      // byte offset of the offending value or key
+	Message  string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("offset %d: %s: %s: %s", i.Offset, i.Path, i.Severity, i.Message)
+}
+
+// Validate checks data in a single pass and reports, in input order, its
+// syntax errors, the values over the default limits, and the constructs that
+// are not in canonical form, as Lint does. A syntax error ends the check, and
+// is then the last issue. Data is valid canonical bencode if no issue is
+// reported.
+func Validate(data []byte) []Issue {
+	return Limits{}.Validate(data)
+}
+
+// Validate is like the Validate function, reporting the values over l.
+func (l Limits) Validate(data []byte) []Issue {
+	v := validator{data: data, limits: l}
+	if end, ok := v.value(0, 0); ok && end != len(data) {
+		v.fail(newSyntaxError(int64(end), ErrTrailingData))
+	}
+	return v.issues
+}
+
+// validator holds the state of Validate.
+type validator struct {
+	data   []byte
+	limits Limits
+	path   Path
+	issues []Issue
+}
+
+func (v *validator) report(sev Severity, rule LintRule, offset int, format string, a ...interface{}) {
+	v.issues = append(v.issues, Issue{
+		Severity: sev,
+		Rule:     rule,
+		Path:     append(Path(nil), v.path...),
+		Offset:   offset,
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
+// fail reports the *SyntaxError err, after which the check cannot go on.
+func (v *validator) fail(err error) {
+	e := err.(*SyntaxError)
+	v.report(SeverityError, 0, int(e.Offset), "%s", e.Err)
+}
+
+// value checks the value starting at data[i], nested depth levels deep, and
+// returns the offset just past it, or false after a syntax error.
+func (v *validator) value(i, depth int) (int, bool) {
+	if i >= len(v.data) {
+		v.fail(newSyntaxError(int64(i), ErrUnexpectedEOF))
+		return i, false
+	}
+	switch b := v.data[i]; {
+	case b == 'i':
+		end, err := scanInteger(v.data, i)
+		if err != nil {
+			v.fail(err)
+			return end, false
+		}
+		v.integer(i, v.data[i+1:end-1])
+		return end, true
+	case b >= '0' && b <= '9':
+		end, payload, ok := v.byteString(i)
+		if ok {
+			v.stringLength(i, end-payload, "string")
+		}
+		return end, ok
+	case b == 'l' || b == 'd':
+		if depth >= maxNestingDepth {
+			v.fail(newSyntaxError(int64(i), ErrDepthExceeded))
+			return i, false
+		}
+		if v.limits.MaxDepth > 0 && depth == v.limits.MaxDepth {
+			v.report(SeverityError, 0, i, "nesting exceeds the max depth of %d", v.limits.MaxDepth)
+		}
+		if b == 'l' {
+			return v.list(i+1, depth+1)
+		}
+		return v.dict(i+1, depth+1)
+	default:
+		v.fail(newUnknownValueType(int64(i), b))
+		return i, false
+	}
+}
+
+func (v *validator) integer(offset int, digits []byte) {
+	d := digits
+	negative := len(d) > 0 && d[0] == '-'
+	if negative {
+		d = d[1:]
+	}
+	if v.limits.MaxIntDigits > 0 && len(d) > v.limits.MaxIntDigits {
+		v.report(SeverityError, 0, offset, "integer of %d digits exceeds the max of %d", len(d), v.limits.MaxIntDigits)
+	}
+	switch {
+	case negative && len(d) > 0 && d[0] == '0':
+		v.report(SeverityWarning, LintNegativeZero, offset, "integer %q is negative zero or has a leading zero", digits)
+	case len(d) > 1 && d[0] == '0':
+		v.report(SeverityWarning, LintLeadingZero, offset, "integer %q has a leading zero", digits)
+	}
+}
+
+// byteString checks the byte string starting at data[i], and returns the
+// offsets of its end and of its payload.
+func (v *validator) byteString(i int) (int, int, bool) {
+	end, err := scanString(v.data, i)
+	if err != nil {
+		v.fail(err)
+		return end, 0, false
+	}
+	payload := i
+	for v.data[payload] != ':' {
+		payload++
+	}
+	return end, payload + 1, true
+}
+
+// stringLength checks the byte string starting at data[i] with a payload of
+// n bytes against the limits and the canonical form.
+func (v *validator) stringLength(i, n int, what string) {
+	if v.limits.MaxStringLen > 0 && n > v.limits.MaxStringLen {
+		v.report(SeverityError, 0, i, "byte string of %d bytes exceeds the max length of %d", n, v.limits.MaxStringLen)
+	}
+	if v.data[i] == '0' && v.data[i+1] != ':' {
+		v.report(SeverityWarning, LintStringLengthLeadingZero, i, "%s length has a leading zero", what)
+	}
+}
+
+// list checks the elements of a list starting at data[i], up to its end.
+func (v *validator) list(i, depth int) (int, bool) {
+	for n := 0; ; n++ {
+		if i >= len(v.data) {
+			v.fail(newSyntaxError(int64(i), ErrUnexpectedEOF))
+			return i, false
+		}
+		if v.data[i] == 'e' {
+			return i + 1, true
+		}
+		v.path = append(v.path, PathElem{Index: n, IsIndex: true})
+		end, ok := v.value(i, depth)
+		v.path = v.path[:len(v.path)-1]
+		if !ok {
+			return end, false
+		}
+		i = end
+	}
+}
+
+// dict checks the entries of a dict starting at data[i], up to its end.
+func (v *validator) dict(i, depth int) (int, bool) {
+	var (
+		seen = make(map[string]int)
+		prev string
+	)
+	for n := 0; ; n++ {
+		if i >= len(v.data) {
+			v.fail(newSyntaxError(int64(i), ErrUnexpectedEOF))
+			return i, false
+		}
+		if v.data[i] == 'e' {
+			return i + 1, true
+		}
+		if v.data[i] < '0' || v.data[i] > '9' {
+			v.fail(newSyntaxError(int64(i), errors.New("dictionary key is not a byte string")))
+			return i, false
+		}
+		end, payload, ok := v.byteString(i)
+		if !ok {
+			return end, false
+		}
+		k := string(v.data[payload:end])
+		v.path = append(v.path, PathElem{Key: k})
+		v.stringLength(i, end-payload, "key")
+		if !utf8.ValidString(k) {
+			v.report(SeverityWarning, LintInvalidUTF8Key, i, "key %q is not valid UTF-8", k)
+		}
+		if first, dup := seen[k]; dup {
+			v.report(SeverityWarning, LintDuplicateKey, i, "key %q is repeated, first at offset %d", k, first)
+		} else {
+			if n > 0 && k < prev {
+				v.report(SeverityWarning, LintUnsortedKey, i, "key %q sorts before the preceding key %q", k, prev)
+			}
+			seen[k] = i
+		}
+		prev = k
+		end, ok = v.value(end, depth)
+		v.path = v.path[:len(v.path)-1]
+		if !ok {
+			return end, false
+		}
+		i = end
+	}
+}
@@ -0,0 +1,317 @@
+package bencode
+
+import (
+	"math/big"
+	"strconv"
+)
+
+// Kind is the type of a bencode value.
+type Kind uint8
+
+const (
+	InvalidKind Kind = iota
+	IntegerKind
+	StringKind
+	ListKind
+	DictKind
+)
+
+func (k Kind) String() string {
+	switch k {
+	case IntegerKind:
+		return "integer"
+	case StringKind:
+		return "string"
+	case ListKind:
+		return "list"
+	case DictKind:
+		return "dict"
+	}
+	return "invalid"
+}
+
+// kindOf returns the kind of the encoded value starting at raw[0].
+func kindOf(raw []byte) Kind {
+	switch raw[0] {
+	case 'i':
+		return IntegerKind
+	case 'l':
+		return ListKind
+	case 'd':
+		return DictKind
+	}
+	return StringKind
+}
+
+// Value is a node of a parsed bencode document. The zero Value is invalid and is
+// what accessors return for missing keys, out-of-range indices and kind mismatches,
+// so lookups can be chained without intermediate checks.
+type Value struct {
+	kind    Kind
+	offset  int    // position of raw within the parsed input
+	raw     []byte // the encoded value as found in the input
+	str     []byte // string payload, or the digits of an integer
+	list    []Value
+	keys    []string // dict keys in input order, parallel to list
+	keySpan [][2]int // offsets of the encoded keys, parallel to keys
+	shallow bool     // list and keys are not populated yet, see expand
+}
+
+// Parse parses data, which must hold exactly one bencode value, into a Value.
+// The returned Value does not retain data.
+func Parse(data []byte) (Value, error) {
+	if err := checkValid(data); err != nil {
+		return Value{}, err
+	}
+	v, _ := parseNode(append([]byte(nil), data...), 0)
+	return v, nil
+}
+
+// parseNode builds the Value starting at data[i], which must already be validated,
+// and returns it along with the offset just past it.
+func parseNode(data []byte, i int) (Value, int) {
+	start := i
+	switch data[i] {
+	case 'i':
+		end, _ := scanInteger(data, i)
+		return Value{kind: IntegerKind, offset: start, raw: data[start:end], str: data[start+1 : end-1]}, end
+	case 'l':
+		v := Value{kind: ListKind, offset: start}
+		for i++; data[i] != 'e'; {
+			var e Value
+			e, i = parseNode(data, i)
+			v.list = append(v.list, e)
+		}
+		v.raw = data[start : i+1]
+		return v, i + 1
+	case 'd':
+		v := Value{kind: DictKind, offset: start}
+		for i++; data[i] != 'e'; {
+			var k, e Value
+			k, i = parseNode(data, i)
+			e, i = parseNode(data, i)
+			v.keys = append(v.keys, string(k.str))
+			v.keySpan = append(v.keySpan, [2]int{k.offset, i - len(e.raw)})
+			v.list = append(v.list, e)
+		}
+		v.raw = data[start : i+1]
+		return v, i + 1
+	default:
+		end, _ := scanString(data, i)
+		colon := start
+		for data[colon] != ':' {
+			colon++
+		}
+		return Value{kind: StringKind, offset: start, raw: data[start:end], str: data[colon+1 : end]}, end
+	}
+}
+
+// expand populates the children of a shallow list or dict, as handed out by Walk.
+func (v Value) expand() Value {
+	if !v.shallow {
+		return v
+	}
+	nv, _ := parseNode(v.raw, 0)
+	nv.rebase(v.offset)
+	return nv
+}
+
+// Kind returns the kind of v.
+func (v Value) Kind() Kind { return v.kind }
+
+// Exists reports whether v is a valid value.
+func (v Value) Exists() bool { return v.kind != InvalidKind }
+
+// Raw returns the encoded form of v. Subtrees that were not modified since
+// parsing are returned byte for byte as they appeared in the input.
+func (v Value) Raw() []byte {
+	if v.raw != nil || v.kind == InvalidKind {
+		return v.raw
+	}
+	return v.appendEncoded(nil)
+}
+
+// appendEncoded appends the encoded form of v to b, reusing the original
+// encoding of every subtree that has not been modified.
+func (v Value) appendEncoded(b []byte) []byte {
+	if v.raw != nil {
+		return append(b, v.raw...)
+	}
+	switch v.kind {
+	case ListKind:
+		b = append(b, 'l')
+		for _, e := range v.list {
+			b = e.appendEncoded(b)
+		}
+	case DictKind:
+		b = append(b, 'd')
+		for i, k := range v.keys {
+			b = strconv.AppendInt(b, int64(len(k)), 10)
+			b = append(b, ':')
+			b = append(b, k...)
+			b = v.list[i].appendEncoded(b)
+		}
+	}
+	return append(b, 'e')
+}
+
+// Span returns the [start, end) byte offsets of v within the input it was parsed from.
+// Values decoded through UnmarshalBencode report offsets relative to their own encoding.
+// The span of a modified or constructed value is meaningless.
+func (v Value) Span() (start, end int) {
+	return v.offset, v.offset + len(v.raw)
+}
+
+// KeySpan returns the [start, end) byte offsets of the encoded key of the last
+// entry named key in a dict, covering the length prefix and the key bytes.
+func (v Value) KeySpan(key string) (start, end int, ok bool) {
+	v = v.expand()
+	if v.kind != DictKind {
+		return 0, 0, false
+	}
+	for i := len(v.keys) - 1; i >= 0; i-- {
+		if v.keys[i] == key && i < len(v.keySpan) {
+			return v.keySpan[i][0], v.keySpan[i][1], true
+		}
+	}
+	return 0, 0, false
+}
+
+// Int returns the integer held by v, or 0 if v is not an integer or does not fit in an int64.
+func (v Value) Int() int64 {
+	if v.kind != IntegerKind {
+		return 0
+	}
+	n, _ := strconv.ParseInt(string(v.str), 10, 64)
+	return n
+}
+
+// BigInt returns the integer held by v with arbitrary precision, or nil if v is not an integer.
+func (v Value) BigInt() *big.Int {
+	if v.kind != IntegerKind {
+		return nil
+	}
+	n, _ := new(big.Int).SetString(string(v.str), 10)
+	return n
+}
+
+// Bytes returns the contents of a byte string, or nil if v is not a string.
+func (v Value) Bytes() []byte {
+	if v.kind != StringKind {
+		return nil
+	}
+	return v.str
+}
+
+// String returns the contents of a byte string, or "" if v is not a string.
+func (v Value) String() string {
+	return string(v.Bytes())
+}
+
+// Len returns the number of elements of a list or entries of a dict, and 0 otherwise.
+func (v Value) Len() int {
+	v = v.expand()
+	if v.kind != ListKind && v.kind != DictKind {
+		return 0
+	}
+	return len(v.list)
+}
+
+// List returns the elements of a list, or nil if v is not a list.
+func (v Value) List() []Value {
+	v = v.expand()
+	if v.kind != ListKind {
+		return nil
+	}
+	return v.list
+}
+
+// Index returns the i'th element of a list, or an invalid Value.
+func (v Value) Index(i int) Value {
+	v = v.expand()
+	if v.kind != ListKind || i < 0 || i >= len(v.list) {
+		return Value{}
+	}
+	return v.list[i]
+}
+
+// Keys returns the keys of a dict in the order they appear in the input.
+func (v Value) Keys() []string {
+	v = v.expand()
+	if v.kind != DictKind {
+		return nil
+	}
+	return v.keys
+}
+
+// Dict returns the entries of a dict as a map, or nil if v is not a dict.
+// If a key occurs more than once, the last occurrence wins.
+func (v Value) Dict() map[string]Value {
+	v = v.expand()
+	if v.kind != DictKind {
+		return nil
+	}
+	m := make(map[string]Value, len(v.keys))
+	for i, k := range v.keys {
+		m[k] = v.list[i]
+	}
+	return m
+}
+
+// Get returns the value stored under key in a dict, or an invalid Value.
+// If a key occurs more than once, the last occurrence wins.
+func (v Value) Get(key string) Value {
+	v = v.expand()
+	if v.kind != DictKind {
+		return Value{}
+	}
+	for i := len(v.keys) - 1; i >= 0; i-- {
+		if v.keys[i] == key {
+			return v.list[i]
+		}
+	}
+	return Value{}
+}
+
+// Interface converts v into the generic form produced by Unmarshal into an interface{}:
+// int64, string, []interface{} or map[string]interface{}.
+func (v Value) Interface() interface{} {
+	v = v.expand()
+	switch v.kind {
+	case IntegerKind:
+		return v.Int()
+	case StringKind:
+		return v.String()
+	case ListKind:
+		l := make([]interface{}, len(v.list))
+		for i, e := range v.list {
+			l[i] = e.Interface()
+		}
+		return l
+	case DictKind:
+		m := make(map[string]interface{}, len(v.keys))
+		for i, k := range v.keys {
+			m[k] = v.list[i].Interface()
+		}
+		return m
+	}
+	return nil
+}
+
+// MarshalBencode returns the encoded form of v.
+func (v Value) MarshalBencode() ([]byte, error) {
+	if v.kind == InvalidKind {
+		return nil, newError("cannot marshal an invalid Value")
+	}
+	return v.Raw(), nil
+}
+
+// UnmarshalBencode parses data into v.
+func (v *Value) UnmarshalBencode(data []byte) error {
+	nv, err := Parse(data)
+	if err != nil {
+		return err
+	}
+	*v = nv
+	return nil
+}
@@ -0,0 +1,145 @@
+package bencode
+
+import (
+	"math/big"
+	"sort"
+	"strconv"
+)
+
+// NewInt returns an integer Value.
+func NewInt(n int64) Value {
+	raw := strconv.AppendInt([]byte{'i'}, n, 10)
+	return Value{kind: IntegerKind, raw: append(raw, 'e'), str: raw[1:]}
+}
+
+// NewBigInt returns an integer Value of arbitrary size.
+func NewBigInt(n *big.Int) Value {
+	raw := n.Append([]byte{'i'}, 10)
+	return Value{kind: IntegerKind, raw: append(raw, 'e'), str: raw[1:]}
+}
+
+// NewBytes returns a byte string Value holding a copy of b.
+func NewBytes(b []byte) Value {
+	raw := strconv.AppendInt(nil, int64(len(b)), 10)
+	raw = append(raw, ':')
+	n := len(raw)
+	raw = append(raw, b...)
+	return Value{kind: StringKind, raw: raw, str: raw[n:]}
+}
+
+// NewString returns a byte string Value.
+func NewString(s string) Value {
+	return NewBytes([]byte(s))
+}
+
+// NewList returns a list Value holding elems.
+func NewList(elems ...Value) Value {
+	return Value{kind: ListKind, list: append([]Value(nil), elems...)}
+}
+
+// NewDict returns an empty dict Value.
+func NewDict() Value {
+	return Value{kind: DictKind}
+}
+
+// ValueOf returns the Value for the bencode encoding of x.
+func ValueOf(x interface{}) (Value, error) {
+	b, err := Marshal(x)
+	if err != nil {
+		return Value{}, err
+	}
+	return Parse(b)
+}
+
+// The mutators below work on private copies of the element slices, so that
+// other copies of the Value keep describing their original encoding, and they
+// drop the cached encoding of the modified node only. Untouched subtrees are
+// still emitted byte for byte when the document is encoded again.
+
+func (v *Value) touch() {
+	*v = v.expand()
+	v.raw = nil
+	v.keySpan = nil
+	v.list = append([]Value(nil), v.list...)
+	if v.kind == DictKind {
+		v.keys = append([]string(nil), v.keys...)
+	}
+}
+
+// Set stores x under key in a dict. An existing entry keeps its position;
+// a new entry is inserted before the first greater key, which keeps sorted
+// dicts sorted. Set reports false if v is not a dict.
+func (v *Value) Set(key string, x Value) bool {
+	if v.kind != DictKind || !x.Exists() {
+		return false
+	}
+	v.touch()
+	for i := len(v.keys) - 1; i >= 0; i-- {
+		if v.keys[i] == key {
+			v.list[i] = x
+			return true
+		}
+	}
+	i := sort.Search(len(v.keys), func(i int) bool { return v.keys[i] > key })
+	v.keys = append(v.keys, "")
+	copy(v.keys[i+1:], v.keys[i:])
+	v.keys[i] = key
+	v.list = append(v.list, Value{})
+	copy(v.list[i+1:], v.list[i:])
+	v.list[i] = x
+	return true
+}
+
+// SetIndex replaces the i'th element of a list. It reports false if v is not
+// a list or i is out of range.
+func (v *Value) SetIndex(i int, x Value) bool {
+	if v.kind != ListKind || i < 0 || i >= len(v.list) || !x.Exists() {
+		return false
+	}
+	v.touch()
+	v.list[i] = x
+	return true
+}
+
+// Append adds elems to the end of a list. It reports false if v is not a list.
+func (v *Value) Append(elems ...Value) bool {
+	if v.kind != ListKind {
+		return false
+	}
+	for _, e := range elems {
+		if !e.Exists() {
+			return false
+		}
+	}
+	v.touch()
+	v.list = append(v.list, elems...)
+	return true
+}
+
+// Delete removes every entry named key from a dict. It reports whether anything was removed.
+func (v *Value) Delete(key string) bool {
+	if !v.Get(key).Exists() {
+		return false
+	}
+	v.touch()
+	keys, list := v.keys[:0], v.list[:0]
+	for i, k := range v.keys {
+		if k != key {
+			keys = append(keys, k)
+			list = append(list, v.list[i])
+		}
+	}
+	v.keys, v.list = keys, list
+	return true
+}
+
+// RemoveIndex removes the i'th element of a list. It reports false if v is not
+// a list or i is out of range.
+func (v *Value) RemoveIndex(i int) bool {
+	if v.kind != ListKind || i < 0 || i >= len(v.list) {
+		return false
+	}
+	v.touch()
+	v.list = append(v.list[:i], v.list[i+1:]...)
+	return true
+}
@@ -0,0 +1,106 @@
+package bencode
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// PathElem is one step of a Path: a dict key, or a list index when IsIndex is set.
+type PathElem struct {
+	Key     string
+	Index   int
+	IsIndex bool
+}
+
+// Path locates a value within a document as the sequence of steps from the top-level value.
+type Path []PathElem
+
+// String returns p in the dotted form accepted by Get, Set and Delete,
+// with dots and backslashes in keys escaped.
+func (p Path) String() string {
+	var b strings.Builder
+	for i, e := range p {
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		if e.IsIndex {
+			b.WriteString(strconv.Itoa(e.Index))
+			continue
+		}
+		for j := 0; j < len(e.Key); j++ {
+			if c := e.Key[j]; c == '.' || c == '\\' {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(e.Key[j])
+		}
+	}
+	return b.String()
+}
+
+// SkipValue can be returned by a WalkFunc to skip the children of the list or dict it was called for.
+var SkipValue = errors.New("skip this value")
+
+// SkipAll can be returned by a WalkFunc to stop the walk without reporting an error.
+var SkipAll = errors.New("skip everything and stop the walk")
+
+// WalkFunc is called by Walk for every value of a document.
+// For lists and dicts, v carries the kind, span and raw encoding; its children
+// are only decoded if one of its accessors is used. The Values alias the data
+// passed to Walk, and path is reused between calls, so neither must be retained
+// without copying.
+type WalkFunc func(path Path, v Value) error
+
+// Walk traverses the document in data in depth-first order, calling fn for
+// every value, starting with the top-level value at the empty path. Dict entries
+// are visited in input order. If fn returns SkipValue for a list or dict, its
+// children are skipped; SkipAll stops the walk; any other error stops the walk
+// and is returned by Walk.
+func Walk(data []byte, fn WalkFunc) error {
+	if err := checkValid(data); err != nil {
+		return err
+	}
+	if _, err := walk(data, 0, nil, fn); err != nil && err != SkipAll {
+		return err
+	}
+	return nil
+}
+
+// walk visits the value starting at data[i] and its children, and returns the offset just past it.
+func walk(data []byte, i int, path Path, fn WalkFunc) (int, error) {
+	end, _ := scanValue(data, i)
+	v := Value{offset: i, raw: data[i:end]}
+	switch data[i] {
+	case 'l':
+		v.kind, v.shallow = ListKind, true
+	case 'd':
+		v.kind, v.shallow = DictKind, true
+	default:
+		v, _ = parseNode(data[:end], i)
+	}
+
+	if err := fn(path, v); err == SkipValue {
+		return end, nil
+	} else if err != nil {
+		return end, err
+	}
+
+	var err error
+	switch data[i] {
+	case 'l':
+		for n, j := 0, i+1; data[j] != 'e'; n++ {
+			if j, err = walk(data, j, append(path, PathElem{Index: n, IsIndex: true}), fn); err != nil {
+				return end, err
+			}
+		}
+	case 'd':
+		for j := i + 1; data[j] != 'e'; {
+			keyEnd, _ := scanString(data, j)
+			key := string(stringPayload(data[j:keyEnd]))
+			if j, err = walk(data, keyEnd, append(path, PathElem{Key: key}), fn); err != nil {
+				return end, err
+			}
+		}
+	}
+	return end, nil
+}